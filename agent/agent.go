@@ -14,15 +14,40 @@ import (
 
 // エージェントの設定
 type AgentConfig struct {
-	Port string
+	Port          string
+	PrivilegeMode string // "sudo-password", "sudoers", "logind"
+	Token         string // マネージャとの共有トークン (電源操作と /capabilities で確認、未設定なら確認しない)
 }
 
 // エージェントの初期化
 func initAgent(config *AgentConfig) {
+	// 特権モードに応じた電源操作の実行方法を選択
+	var err error
+	executor, err = newPowerExecutor(config.PrivilegeMode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Agent privilege mode: %s", executor.Mode())
+	if config.Token == "" {
+		log.Printf("WARNING: AGENT_TOKEN is not set; power endpoints accept requests without authentication")
+	}
+
 	// HTTPサーバーのルートハンドラを設定
 	http.HandleFunc("/status", statusHandler)
-	http.HandleFunc("/shutdown", shutdownHandler)
+	// 電源操作はマネージャとの共有トークンで保護する
+	http.HandleFunc("/shutdown", requireToken(config, shutdownHandler))
+	http.HandleFunc("/cancel", requireToken(config, cancelHandler))
+	http.HandleFunc("/reboot", requireToken(config, systemctlHandler("reboot")))
+	http.HandleFunc("/suspend", requireToken(config, systemctlHandler("suspend")))
+	http.HandleFunc("/hibernate", requireToken(config, systemctlHandler("hibernate")))
+	// 能力情報もトークンで保護し、マネージャがパスワードを送る前にトークンを持つことを証明する
+	http.HandleFunc("/capabilities", requireToken(config, capabilitiesHandler))
+	http.HandleFunc("/vm/state", requireToken(config, vmStateHandler))
+	for action := range vmActions {
+		http.HandleFunc("/vm/"+action, requireToken(config, vmHandler(action)))
+	}
 	http.HandleFunc("/cpucheck", cpuHandler)
+	http.HandleFunc("/info", infoHandler(config.Port))
 
 	// サーバーを起動
 	log.Printf("Agent starting on port %s", config.Port)
@@ -50,30 +75,47 @@ func statusHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Status Confirm Endpoint Successfully finished")
 }
 
-// shutdownHandler は、シャットダウンリクエストを処理します。
-func shutdownHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Shutdown Request Endpoint start")
+// PowerRequest は /shutdown, /cancel, /reboot, /suspend, /hibernate リクエストのペイロードです。
+type PowerRequest struct {
+	Password string `json:"password"` // sudo-password モードの場合のみ必要
+	Delay    int    `json:"delay"`    // シャットダウンまでの猶予 (分)。0 の場合は即時
+	Message  string `json:"message"`  // ログイン中のユーザーへ送る wall メッセージ
+}
+
+// decodePowerRequest は、電源操作リクエストを読み取り、特権モードに応じてパスワードの有無を検証します。
+// 失敗した場合はエラー応答を書き込み false を返します。
+func decodePowerRequest(w http.ResponseWriter, r *http.Request) (*PowerRequest, bool) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return nil, false
 	}
 
-	var body map[string]string
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	var req PowerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
+		return nil, false
 	}
 
-	password, exists := body["password"]
-	if !exists {
+	if executor.RequiresPassword() && req.Password == "" {
 		http.Error(w, "Password required", http.StatusBadRequest)
+		return nil, false
+	}
+	return &req, true
+}
+
+// shutdownHandler は、シャットダウンリクエストを処理します。
+func shutdownHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Shutdown Request Endpoint start")
+	req, ok := decodePowerRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Delay < 0 {
+		http.Error(w, "Delay must be zero or positive", http.StatusBadRequest)
 		return
 	}
 
-	// sudo shutdownコマンドを実行
-	cmd := exec.Command("sudo", "-S", "shutdown", "-h", "now")
-	cmd.Stdin = strings.NewReader(password + "\n")
-	output, err := cmd.CombinedOutput()
+	output, err := executor.Shutdown(req.Password, req.Delay, req.Message)
 	if err != nil {
 		log.Printf("Shutdown failed: %v, Output: %s", err, output)
 		http.Error(w, "Shutdown failed", http.StatusInternalServerError)
@@ -82,8 +124,91 @@ func shutdownHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Shutdown successful: %s", output)
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Shutdown initiated successfully"))
-	log.Printf("Status Confirm Endpoint Successfully finished")
+	if req.Delay > 0 {
+		fmt.Fprintf(w, "Shutdown scheduled in %d minute(s)", req.Delay)
+	} else {
+		w.Write([]byte("Shutdown initiated successfully"))
+	}
+	log.Printf("Shutdown Request Endpoint Successfully finished")
+}
+
+// cancelHandler は、予約済みのシャットダウンを取り消します。
+func cancelHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Cancel Shutdown Endpoint start")
+	req, ok := decodePowerRequest(w, r)
+	if !ok {
+		return
+	}
+
+	output, err := executor.Cancel(req.Password, req.Message)
+	if err != nil {
+		log.Printf("Cancel shutdown failed: %v, Output: %s", err, output)
+		http.Error(w, "Cancel shutdown failed", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Cancel shutdown successful: %s", output)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Scheduled shutdown cancelled"))
+	log.Printf("Cancel Shutdown Endpoint Successfully finished")
+}
+
+// systemctlHandler は、reboot, suspend, hibernate を実行するハンドラを返します。
+func systemctlHandler(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s Request Endpoint start", action)
+		req, ok := decodePowerRequest(w, r)
+		if !ok {
+			return
+		}
+
+		// ホストが対応していない操作は実行前に拒否する
+		if !hasCapability(action) {
+			log.Printf("%s is not supported on this host", action)
+			http.Error(w, fmt.Sprintf("%s not supported on this host", action), http.StatusNotImplemented)
+			return
+		}
+
+		output, err := executor.SystemAction(req.Password, action)
+		if err != nil {
+			log.Printf("%s failed: %v, Output: %s", action, err, output)
+			http.Error(w, action+" failed", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("%s successful: %s", action, output)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "%s initiated successfully", action)
+		log.Printf("%s Request Endpoint Successfully finished", action)
+	}
+}
+
+// hasCapability は、指定された操作がこのホストで実行可能かを返します。
+func hasCapability(action string) bool {
+	for _, a := range executor.Capabilities() {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// capabilitiesHandler は、このホストで実行可能な電源操作の一覧と特権モード、libvirt の利用可否を返します。
+func capabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Capabilities Endpoint start")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"actions":        executor.Capabilities(),
+		"privilege_mode": executor.Mode(),
+		"libvirt":        hasVirsh(),
+	})
+	log.Printf("Capabilities Endpoint Successfully finished")
 }
 
 // ただrunningを返す
@@ -161,8 +286,16 @@ func main() {
 		}
 	}
 
+	// 特権モードを環境変数から取得（デフォルトは従来どおりパスワードを受け取る sudo-password）
+	mode := os.Getenv("AGENT_PRIVILEGE_MODE")
+	if mode == "" {
+		mode = modeSudoPassword
+	}
+
 	config := &AgentConfig{
-		Port: port,
+		Port:          port,
+		PrivilegeMode: mode,
+		Token:         os.Getenv("AGENT_TOKEN"),
 	}
 
 	// エージェントを初期化
@@ -0,0 +1,36 @@
+// auth.go
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"srv_mng/internal/agentapi"
+)
+
+// requireToken は、マネージャとの共有トークン (AGENT_TOKEN) を確認してからハンドラを呼び出すハンドラを返します。
+// トークンは "Authorization: Bearer <token>" ヘッダーで受け取り、特権モードに関係なく確認します。
+// AGENT_TOKEN が未設定の場合は、従来のエージェントと同様に確認せずに実行します。
+// トークンが一致し、リクエストに nonce が付いている場合は、トークンを持つことの証明を応答ヘッダーに付けます。
+func requireToken(config *AgentConfig, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.Token == "" {
+			next(w, r)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(config.Token)) != 1 {
+			log.Printf("Rejected %s from %s: missing or invalid token", r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="power_agent"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if nonce := r.Header.Get(agentapi.NonceHeader); nonce != "" {
+			w.Header().Set(agentapi.ProofHeader, agentapi.TokenProof(config.Token, nonce))
+		}
+		next(w, r)
+	}
+}
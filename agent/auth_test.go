@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"srv_mng/internal/agentapi"
+)
+
+func TestRequireToken(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	cases := []struct {
+		name      string
+		token     string
+		header    string
+		nonce     string
+		wantCode  int
+		wantProof bool
+	}{
+		{"no token configured", "", "", "", http.StatusOK, false},
+		{"no token configured ignores nonce", "", "", "n1", http.StatusOK, false},
+		{"missing header", "secret", "", "", http.StatusUnauthorized, false},
+		{"wrong token", "secret", "Bearer wrong", "n1", http.StatusUnauthorized, false},
+		{"not bearer", "secret", "Basic secret", "", http.StatusUnauthorized, false},
+		{"valid token", "secret", "Bearer secret", "", http.StatusOK, false},
+		{"valid token with nonce", "secret", "Bearer secret", "n1", http.StatusOK, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			handler := requireToken(&AgentConfig{Token: c.token}, ok)
+			req := httptest.NewRequest(http.MethodPost, "/shutdown", nil)
+			if c.header != "" {
+				req.Header.Set("Authorization", c.header)
+			}
+			if c.nonce != "" {
+				req.Header.Set(agentapi.NonceHeader, c.nonce)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != c.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, c.wantCode)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate is missing on 401")
+			}
+			proof := rec.Header().Get(agentapi.ProofHeader)
+			if c.wantProof != (proof != "") {
+				t.Fatalf("proof = %q, want present=%v", proof, c.wantProof)
+			}
+			if c.wantProof && !agentapi.ValidProof(c.token, c.nonce, proof) {
+				t.Errorf("proof %q does not match the token", proof)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// info.go
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+)
+
+// InterfaceInfo は、ネットワークインターフェースの情報です。
+type InterfaceInfo struct {
+	Name       string   `json:"name"`
+	MAC        string   `json:"mac"`
+	IPs        []string `json:"ips"`        // CIDR 表記 (例: 192.168.1.10/24)
+	Broadcasts []string `json:"broadcasts"` // IPv4 アドレスごとのブロードキャストアドレス
+}
+
+// HostInfo は /info のレスポンスです。管理サーバーのディスカバリ (サブネットの探索) が、ターゲットの登録内容を作るために使用します。
+type HostInfo struct {
+	Agent         string          `json:"agent"` // 常に "power_agent" (探索時にエージェントであることの確認に使用)
+	Hostname      string          `json:"hostname"`
+	Port          string          `json:"port"`
+	PrivilegeMode string          `json:"privilege_mode"`
+	Interfaces    []InterfaceInfo `json:"interfaces"`
+}
+
+// collectInterfaces は、起動中でループバック以外の、MAC アドレスを持つインターフェースの一覧を返します。
+func collectInterfaces() ([]InterfaceInfo, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	result := []InterfaceInfo{}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		info := InterfaceInfo{Name: iface.Name, MAC: iface.HardwareAddr.String(), IPs: []string{}, Broadcasts: []string{}}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Printf("Failed to get addresses of %s: %v", iface.Name, err)
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			info.IPs = append(info.IPs, ipnet.String())
+			// ブロードキャストアドレスは IPv4 のみ (ホスト部のビットをすべて 1 にしたアドレス)
+			if ip4 := ipnet.IP.To4(); ip4 != nil && len(ipnet.Mask) == net.IPv4len {
+				bcast := make(net.IP, net.IPv4len)
+				for i := range bcast {
+					bcast[i] = ip4[i] | ^ipnet.Mask[i]
+				}
+				info.Broadcasts = append(info.Broadcasts, bcast.String())
+			}
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// infoHandler は、ホスト名と、ネットワークインターフェースごとの MAC アドレス・IP アドレス・ブロードキャストアドレスを返します。
+func infoHandler(port string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Info Endpoint start")
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Printf("Failed to get hostname: %v", err)
+		}
+		ifaces, err := collectInterfaces()
+		if err != nil {
+			log.Printf("Failed to get network interfaces: %v", err)
+			http.Error(w, "Failed to get network interfaces", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(HostInfo{
+			Agent:         "power_agent",
+			Hostname:      hostname,
+			Port:          port,
+			PrivilegeMode: executor.Mode(),
+			Interfaces:    ifaces,
+		})
+		log.Printf("Info Endpoint Successfully finished")
+	}
+}
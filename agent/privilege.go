@@ -0,0 +1,242 @@
+// privilege.go
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// 特権モード
+const (
+	// modeSudoPassword はマネージャから受け取ったパスワードを sudo -S に渡す従来のモードです。
+	modeSudoPassword = "sudo-password"
+	// modeSudoers は NOPASSWD の sudoers ルールを前提に sudo -n で実行するモードです。
+	modeSudoers = "sudoers"
+	// modeLogind は systemd-logind の D-Bus API を呼び出すモードです（polkit で許可が必要）。
+	modeLogind = "logind"
+)
+
+// powerExecutor は、特権モードごとの電源操作の実行方法を表します。
+type powerExecutor interface {
+	Mode() string
+	RequiresPassword() bool
+	Shutdown(password string, delay int, message string) (string, error)
+	Cancel(password string, message string) (string, error)
+	SystemAction(password string, action string) (string, error)
+	Capabilities() []string
+}
+
+// executor は initAgent で選択された電源操作の実行方法です。
+var executor powerExecutor
+
+// newPowerExecutor は、特権モード名から powerExecutor を生成します。
+func newPowerExecutor(mode string) (powerExecutor, error) {
+	switch mode {
+	case modeSudoPassword:
+		return &sudoExecutor{nopasswd: false}, nil
+	case modeSudoers:
+		return &sudoExecutor{nopasswd: true}, nil
+	case modeLogind:
+		return &logindExecutor{}, nil
+	default:
+		return nil, fmt.Errorf("unknown privilege mode: %s", mode)
+	}
+}
+
+// sudoExecutor は、sudo 経由で shutdown/systemctl を実行します。
+type sudoExecutor struct {
+	nopasswd bool
+}
+
+func (e *sudoExecutor) Mode() string {
+	if e.nopasswd {
+		return modeSudoers
+	}
+	return modeSudoPassword
+}
+
+func (e *sudoExecutor) RequiresPassword() bool {
+	return !e.nopasswd
+}
+
+func (e *sudoExecutor) Shutdown(password string, delay int, message string) (string, error) {
+	// shutdown -h <when> [message] の引数を組み立てる
+	when := "now"
+	if delay > 0 {
+		when = "+" + strconv.Itoa(delay)
+	}
+	args := []string{"shutdown", "-h", when}
+	if message != "" {
+		args = append(args, message)
+	}
+	return e.run(password, args...)
+}
+
+func (e *sudoExecutor) Cancel(password string, message string) (string, error) {
+	// shutdown -c [message] で予約を取り消す
+	args := []string{"shutdown", "-c"}
+	if message != "" {
+		args = append(args, message)
+	}
+	return e.run(password, args...)
+}
+
+func (e *sudoExecutor) SystemAction(password string, action string) (string, error) {
+	return e.run(password, "systemctl", action)
+}
+
+// Capabilities は、shutdown/cancel を常に利用可能とし、systemctl の有無と /sys/power/state の内容から残りを判定します。
+func (e *sudoExecutor) Capabilities() []string {
+	actions := []string{"shutdown", "cancel"}
+
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		return actions
+	}
+	actions = append(actions, "reboot")
+
+	// /sys/power/state に mem があればサスペンド、disk があればハイバネートが可能
+	state, err := os.ReadFile("/sys/power/state")
+	if err != nil {
+		return actions
+	}
+	for _, s := range strings.Fields(string(state)) {
+		switch s {
+		case "mem":
+			actions = append(actions, "suspend")
+		case "disk":
+			actions = append(actions, "hibernate")
+		}
+	}
+	return actions
+}
+
+// run は sudo でコマンドを実行します。
+// sudoers モードでは -n を付けてパスワード入力を求めず、NOPASSWD ルールがなければ失敗させます。
+func (e *sudoExecutor) run(password string, args ...string) (string, error) {
+	var cmd *exec.Cmd
+	if e.nopasswd {
+		cmd = exec.Command("sudo", append([]string{"-n"}, args...)...)
+	} else {
+		cmd = exec.Command("sudo", append([]string{"-S"}, args...)...)
+		cmd.Stdin = strings.NewReader(password + "\n")
+	}
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// logindExecutor は、systemd-logind の D-Bus API (org.freedesktop.login1.Manager) を呼び出します。
+// パスワードは使用せず、権限は polkit のルールで付与します。
+type logindExecutor struct{}
+
+func (e *logindExecutor) Mode() string {
+	return modeLogind
+}
+
+func (e *logindExecutor) RequiresPassword() bool {
+	return false
+}
+
+func (e *logindExecutor) Shutdown(_ string, delay int, message string) (string, error) {
+	if message != "" {
+		if err := e.call("SetWallMessage", message, true); err != nil {
+			return "", err
+		}
+	}
+
+	if delay > 0 {
+		at := time.Now().Add(time.Duration(delay) * time.Minute)
+		if err := e.call("ScheduleShutdown", "poweroff", uint64(at.UnixMicro())); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("poweroff scheduled at %s", at.Format(time.RFC3339)), nil
+	}
+
+	if err := e.call("PowerOff", false); err != nil {
+		return "", err
+	}
+	return "poweroff requested", nil
+}
+
+func (e *logindExecutor) Cancel(_ string, message string) (string, error) {
+	if message != "" {
+		if err := e.call("SetWallMessage", message, true); err != nil {
+			return "", err
+		}
+	}
+
+	if err := e.call("CancelScheduledShutdown"); err != nil {
+		return "", err
+	}
+	return "scheduled shutdown cancelled", nil
+}
+
+func (e *logindExecutor) SystemAction(_ string, action string) (string, error) {
+	// reboot -> Reboot, suspend -> Suspend, hibernate -> Hibernate
+	method := strings.ToUpper(action[:1]) + action[1:]
+	if err := e.call(method, false); err != nil {
+		return "", err
+	}
+	return action + " requested", nil
+}
+
+// Capabilities は、logind の Can* メソッドが "yes" を返す操作を利用可能とします。
+func (e *logindExecutor) Capabilities() []string {
+	var actions []string
+	checks := []struct {
+		action string
+		method string
+	}{
+		{"shutdown", "CanPowerOff"},
+		{"reboot", "CanReboot"},
+		{"suspend", "CanSuspend"},
+		{"hibernate", "CanHibernate"},
+	}
+	for _, c := range checks {
+		result, err := e.query(c.method)
+		if err != nil || result != "yes" {
+			continue
+		}
+		actions = append(actions, c.action)
+		if c.action == "shutdown" {
+			actions = append(actions, "cancel")
+		}
+	}
+	return actions
+}
+
+// call は login1 Manager のメソッドを呼び出します。
+func (e *logindExecutor) call(method string, args ...interface{}) error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect to system bus: %v", err)
+	}
+	defer conn.Close()
+
+	obj := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	if err := obj.Call("org.freedesktop.login1.Manager."+method, 0, args...).Err; err != nil {
+		return fmt.Errorf("logind %s failed: %v", method, err)
+	}
+	return nil
+}
+
+// query は login1 Manager の Can* メソッドを呼び出し、結果の文字列を返します。
+func (e *logindExecutor) query(method string) (string, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to system bus: %v", err)
+	}
+	defer conn.Close()
+
+	var result string
+	obj := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	if err := obj.Call("org.freedesktop.login1.Manager."+method, 0).Store(&result); err != nil {
+		return "", fmt.Errorf("logind %s failed: %v", method, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,128 @@
+// vm.go
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"srv_mng/internal/agentapi"
+)
+
+// libvirtURI は virsh の接続先です。環境変数 AGENT_LIBVIRT_URI で変更できます。
+func libvirtURI() string {
+	if uri := os.Getenv("AGENT_LIBVIRT_URI"); uri != "" {
+		return uri
+	}
+	return "qemu:///system"
+}
+
+// hasVirsh は、このホストで virsh が利用可能かを返します。
+func hasVirsh() bool {
+	_, err := exec.LookPath("virsh")
+	return err == nil
+}
+
+// runVirsh は virsh コマンドを実行します。
+// libvirt への接続権限は sudo ではなく、エージェントの実行ユーザーを libvirt グループに所属させて付与します。
+func runVirsh(args ...string) (string, error) {
+	cmd := exec.Command("virsh", append([]string{"-c", libvirtURI()}, args...)...)
+	output, err := cmd.CombinedOutput()
+	return strings.TrimSpace(string(output)), err
+}
+
+// VMRequest は /vm/* リクエストのペイロードです。
+type VMRequest struct {
+	Domain string `json:"domain"`
+}
+
+// vmActions は /vm/<action> と virsh サブコマンドの対応です。
+var vmActions = map[string]string{
+	"start":    "start",
+	"shutdown": "shutdown",
+	"destroy":  "destroy",
+	"reboot":   "reboot",
+	"reset":    "reset",
+}
+
+// vmHandler は、ドメインに対して virsh start/shutdown/destroy/reboot/reset を実行するハンドラを返します。
+func vmHandler(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("VM %s Endpoint start", action)
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req VMRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Domain == "" {
+			http.Error(w, "Domain required", http.StatusBadRequest)
+			return
+		}
+		if !agentapi.DomainNamePattern.MatchString(req.Domain) {
+			http.Error(w, "Invalid domain name", http.StatusBadRequest)
+			return
+		}
+		if !hasVirsh() {
+			http.Error(w, "virsh not available on this host", http.StatusNotImplemented)
+			return
+		}
+
+		// "--" 以降はオプションではなくドメイン名として扱わせる
+		output, err := runVirsh(vmActions[action], "--", req.Domain)
+		if err != nil {
+			log.Printf("VM %s failed for %s: %v, Output: %s", action, req.Domain, err, output)
+			http.Error(w, fmt.Sprintf("virsh %s failed: %s", action, output), http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("VM %s successful for %s: %s", action, req.Domain, output)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(output))
+		log.Printf("VM %s Endpoint Successfully finished", action)
+	}
+}
+
+// vmStateHandler は、virsh domstate の結果を返します。
+func vmStateHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("VM State Endpoint start")
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	domain := r.URL.Query().Get("domain")
+	if domain == "" {
+		http.Error(w, "Domain required", http.StatusBadRequest)
+		return
+	}
+	if !agentapi.DomainNamePattern.MatchString(domain) {
+		http.Error(w, "Invalid domain name", http.StatusBadRequest)
+		return
+	}
+	if !hasVirsh() {
+		http.Error(w, "virsh not available on this host", http.StatusNotImplemented)
+		return
+	}
+
+	// "running", "shut off", "paused", "in shutdown", "crashed", "pmsuspended" など
+	state, err := runVirsh("domstate", "--", domain)
+	if err != nil {
+		log.Printf("VM state failed for %s: %v, Output: %s", domain, err, state)
+		http.Error(w, fmt.Sprintf("virsh domstate failed: %s", state), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"domain": domain, "state": state})
+	log.Printf("VM State Endpoint Successfully finished")
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"srv_mng/service"
+	"srv_mng/utils"
+	"strconv"
+	"strings"
+)
+
+// ansibleGroupInvalidChars は、Ansible のグループ名に使えない文字です (英数字と _ のみ使用可能)。
+var ansibleGroupInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// ansibleGroupName は、タグや種別を Ansible のグループ名に変換します (例: "env=prod" → "env_prod")。
+func ansibleGroupName(name string) string {
+	group := ansibleGroupInvalidChars.ReplaceAllString(name, "_")
+	if group != "" && group[0] >= '0' && group[0] <= '9' {
+		group = "_" + group
+	}
+	// Ansible が予約しているグループ名と重ならないようにする
+	if group == "all" || group == "ungrouped" || group == "_meta" {
+		group = "tag_" + group
+	}
+	return group
+}
+
+// ansibleHostVars は、Ansible のホスト変数を返します。パスワードなどの秘密情報は含めません。
+func ansibleHostVars(t service.MonitorTarget) map[string]interface{} {
+	vars := map[string]interface{}{
+		"ansible_host": t.HostIP,
+		"host_ip":      t.HostIP,
+		"ssh_user":     t.SSHUser,
+		"srv_mng_type": t.Type,
+		"srv_mng_tags": t.Tags,
+	}
+	if t.Tags == nil {
+		vars["srv_mng_tags"] = []string{}
+	}
+	if t.SSHUser != "" {
+		vars["ansible_user"] = t.SSHUser
+	}
+	if port, err := strconv.Atoi(t.SSHPort); err == nil {
+		vars["ansible_port"] = port
+	}
+	return vars
+}
+
+// AnsibleInventoryHandler は GET /targets/ansible-inventory を処理するハンドラです。
+// Ansible の動的インベントリ (ansible-inventory -i <スクリプト> --list の形式) の JSON を返します。
+// グループは種別 (type_host など) とタグ (web, env_prod など) から作成し、ホスト変数は _meta.hostvars にまとめて返します。
+// ?status=Running (または Running|Degraded、Running,Degraded) で監視結果の状態による絞り込み、?selector= でタグによる絞り込みができます。
+func AnsibleInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var filters []statusFilter
+	if v := query.Get("status"); v != "" {
+		var err error
+		// "Running,Degraded" のようにカンマで区切った場合も、いずれかに一致するものとする
+		if filters, err = parseStatusFilters([]string{"status=" + strings.ReplaceAll(v, ",", "|")}); err != nil {
+			utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: fmt.Sprintf("Invalid 'status' parameter: %v", err)})
+			return
+		}
+	}
+
+	targets, err := service.ListMonitorTargets()
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{})
+		return
+	}
+
+	// ?status= の指定がある場合のみ、バックグラウンド監視の最新結果を参照する
+	statuses := map[string]service.TargetStatus{}
+	if len(filters) > 0 {
+		snapshot, err := service.GetStatusSnapshot()
+		if err != nil {
+			writeServiceError(w, r, err, utils.JSONResponse{})
+			return
+		}
+		for _, s := range snapshot {
+			statuses[s.Name] = s
+		}
+	}
+
+	selector := query.Get("selector")
+	hostvars := map[string]interface{}{}
+	groups := map[string][]string{}
+	for _, t := range targets {
+		if !service.MatchSelector(t.Tags, selector) {
+			continue
+		}
+		if len(filters) > 0 {
+			// 監視結果がまだない (登録直後など) ターゲットは状態が分からないため含めない
+			s, ok := statuses[t.Name]
+			if !ok || !filters[0].match(s) {
+				continue
+			}
+		}
+
+		hostvars[t.Name] = ansibleHostVars(t)
+		names := []string{ansibleGroupName("type_" + t.Type)}
+		for _, tag := range t.Tags {
+			names = append(names, ansibleGroupName(tag))
+		}
+		for _, name := range names {
+			// "env=prod" と "env_prod" のように同じグループ名になるタグがあっても、ホストは1回だけ追加する
+			// (1つのターゲットのグループはまとめて追加するため、末尾のホストとの比較で重複を判定できる)
+			if hosts := groups[name]; len(hosts) == 0 || hosts[len(hosts)-1] != t.Name {
+				groups[name] = append(hosts, t.Name)
+			}
+		}
+	}
+
+	children := make([]string, 0, len(groups))
+	for name := range groups {
+		children = append(children, name)
+	}
+	sort.Strings(children)
+
+	inventory := map[string]interface{}{
+		"_meta": map[string]interface{}{"hostvars": hostvars},
+		"all":   map[string]interface{}{"children": children},
+	}
+	for name, hosts := range groups {
+		inventory[name] = map[string]interface{}{"hosts": hosts}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(inventory); err != nil {
+		log.Printf("[ERROR] Error encoding ansible inventory response: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"srv_mng/service"
+)
+
+func TestAnsibleGroupName(t *testing.T) {
+	for _, c := range []struct{ name, want string }{
+		{"web", "web"},
+		{"env=prod", "env_prod"},
+		{"rack-A/1.2", "rack_A_1_2"},
+		{"ラック", "___"},
+		{"1st-floor", "_1st_floor"},
+		{"all", "tag_all"},
+		{"ungrouped", "tag_ungrouped"},
+		{"_meta", "tag__meta"},
+		{"all-in-one", "all_in_one"},
+		{"", ""},
+	} {
+		if got := ansibleGroupName(c.name); got != c.want {
+			t.Errorf("ansibleGroupName(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// ansibleInventory は、GET /targets/ansible-inventory の応答をグループ名ごとのホストとホスト変数に分けて返します。
+func ansibleInventory(t *testing.T, query string) (map[string][]string, map[string]map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	AnsibleInventoryHandler(rec, httptest.NewRequest("GET", "/targets/ansible-inventory"+query, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, body = %s", query, rec.Code, rec.Body)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("%s: unmarshal: %v", query, err)
+	}
+	var meta struct {
+		Hostvars map[string]map[string]interface{} `json:"hostvars"`
+	}
+	var all struct {
+		Children []string `json:"children"`
+	}
+	json.Unmarshal(raw["_meta"], &meta)
+	json.Unmarshal(raw["all"], &all)
+
+	groups := map[string][]string{}
+	for _, name := range all.Children {
+		var group struct {
+			Hosts []string `json:"hosts"`
+		}
+		if err := json.Unmarshal(raw[name], &group); err != nil {
+			t.Fatalf("%s: group %q: %v", query, name, err)
+		}
+		groups[name] = group.Hosts
+	}
+	if len(raw) != len(groups)+2 {
+		t.Errorf("%s: %d top-level keys, want the %d children plus _meta and all", query, len(raw), len(groups))
+	}
+	return groups, meta.Hostvars
+}
+
+// saveTarget は、テスト用のターゲットを登録します。
+func saveTarget(t *testing.T, target service.MonitorTarget) {
+	t.Helper()
+	if err := service.SaveMonitorTarget(&target); err != nil {
+		t.Fatalf("SaveMonitorTarget(%s): %v", target.Name, err)
+	}
+}
+
+func TestAnsibleInventory(t *testing.T) {
+	newTestDB(t)
+	// "env=prod" と "env_prod" は同じグループ名になる
+	saveTarget(t, service.MonitorTarget{Name: "ans-app01", Type: "host", HostIP: "172.16.1.11", Port: "8080", SSHUser: "deploy", SSHPass: "secret", SSHPort: "2222",
+		Tags: []string{"env=prod", "env_prod", "all", "1u"}})
+	saveTarget(t, service.MonitorTarget{Name: "ans-app02", Type: "host", HostIP: "172.16.1.12", Port: "8080", Tags: []string{"env_prod", "env=prod"}})
+	saveTarget(t, service.MonitorTarget{Name: "ans-db01", Type: "vm", HostIP: "172.16.1.21", Port: "8080", Tags: []string{"env=dev"}})
+
+	groups, hostvars := ansibleInventory(t, "")
+	want := map[string][]string{
+		"type_host": {"ans-app01", "ans-app02"},
+		"type_vm":   {"ans-db01"},
+		"env_prod":  {"ans-app01", "ans-app02"},
+		"env_dev":   {"ans-db01"},
+		"tag_all":   {"ans-app01"},
+		"_1u":       {"ans-app01"},
+	}
+	if len(groups) != len(want) {
+		t.Errorf("groups = %v, want %v", groups, want)
+	}
+	for name, hosts := range want {
+		// 同じグループ名になるタグが複数あっても、ホストは1回だけ含める
+		if !slices.Equal(groups[name], hosts) {
+			t.Errorf("group %s = %q, want %q", name, groups[name], hosts)
+		}
+	}
+
+	vars := hostvars["ans-app01"]
+	if vars["ansible_host"] != "172.16.1.11" || vars["ansible_user"] != "deploy" || vars["ansible_port"] != float64(2222) {
+		t.Errorf("hostvars[ans-app01] = %v", vars)
+	}
+	for _, v := range vars {
+		if v == "secret" {
+			t.Errorf("hostvars[ans-app01] contains the SSH password: %v", vars)
+		}
+	}
+	if _, ok := hostvars["ans-app02"]["ansible_user"]; ok {
+		t.Errorf("hostvars[ans-app02] = %v, want no ansible_user without ssh_user", hostvars["ans-app02"])
+	}
+
+	groups, hostvars = ansibleInventory(t, "?selector=env%3Ddev")
+	if len(hostvars) != 1 || !slices.Equal(groups["env_dev"], []string{"ans-db01"}) || groups["env_prod"] != nil {
+		t.Errorf("selector env=dev: groups = %v", groups)
+	}
+}
+
+func TestAnsibleInventoryStatusFilter(t *testing.T) {
+	newTestDB(t)
+	// メンテナンス中のターゲットは死活確認を行わずに Maintenance となる
+	saveTarget(t, service.MonitorTarget{Name: "ans-maint01", Type: "host", HostIP: "172.16.2.11", Port: "8080", Maintenance: true, Tags: []string{"web"}})
+	saveTarget(t, service.MonitorTarget{Name: "ans-maint02", Type: "host", HostIP: "172.16.2.12", Port: "8080", Maintenance: true})
+	saveTarget(t, service.MonitorTarget{Name: "ans-down01", Type: "host", HostIP: "127.0.0.1", Port: "1", Tags: []string{"web"}})
+
+	for _, c := range []struct {
+		query string
+		want  []string
+	}{
+		{"?status=Maintenance", []string{"ans-maint01", "ans-maint02"}},
+		{"?status=Maintenance&selector=web", []string{"ans-maint01"}},
+		{"?status=Running", []string{}},
+		{"?status=Sleeping", []string{}},
+		{"?status=Running,Maintenance", []string{"ans-maint01", "ans-maint02"}},
+		{"?status=Running|Maintenance", []string{"ans-maint01", "ans-maint02"}},
+		{"", []string{"ans-down01", "ans-maint01", "ans-maint02"}},
+	} {
+		groups, hostvars := ansibleInventory(t, c.query)
+		if got := groups["type_host"]; len(got) != len(c.want) || (len(got) > 0 && !slices.Equal(got, c.want)) {
+			t.Errorf("%q: type_host = %q, want %q", c.query, got, c.want)
+		}
+		if len(hostvars) != len(c.want) {
+			t.Errorf("%q: %d hostvars, want %d", c.query, len(hostvars), len(c.want))
+		}
+	}
+
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+	"srv_mng/utils"
+	"strings"
+)
+
+// adminKey は、管理者のトークンで認証されたことを context に保存するキーです。
+type adminKey struct{}
+
+// RequireToken は、環境変数 SRVMNG_API_TOKEN または SRVMNG_ADMIN_TOKEN が設定されている場合に API へのアクセスをトークンで保護します。
+// トークンは "Authorization: Bearer <token>" ヘッダーで送ります。
+// ヘッダーを付けられない EventSource のため、/events に限り ?access_token= でも受け付けます。
+// 動作確認用の "/" とダッシュボードの静的ファイルは保護しません。
+// 環境変数 SRVMNG_ADMIN_TOKEN のトークンは管理者として扱い、秘密情報を含むエクスポートなどを許可します (IsAdmin)。
+// SRVMNG_ADMIN_TOKEN のみを設定した場合は、すべての API で管理者のトークンが必要です。
+func RequireToken(next http.Handler) http.Handler {
+	token := os.Getenv("SRVMNG_API_TOKEN")
+	adminToken := os.Getenv("SRVMNG_ADMIN_TOKEN")
+	if token == "" && adminToken == "" {
+		return next
+	}
+	if token != "" {
+		log.Printf("[INFO] API token authentication enabled")
+	}
+	if adminToken != "" {
+		log.Printf("[INFO] Admin token enabled")
+	}
+	if token == "" {
+		log.Printf("[INFO] SRVMNG_API_TOKEN is not set: all API requests require the admin token")
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" || strings.HasPrefix(r.URL.Path, "/dashboard") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && isEventsPath(r.URL.Path) {
+			given = r.URL.Query().Get("access_token")
+		}
+		if adminToken != "" && subtle.ConstantTimeCompare([]byte(given), []byte(adminToken)) == 1 {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminKey{}, true)))
+			return
+		}
+		// SRVMNG_ADMIN_TOKEN のみを設定した場合は、管理者のトークン以外をすべて拒否する
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="srv_mng"`)
+			utils.WriteError(w, r, http.StatusUnauthorized, utils.CodeUnauthorized, utils.JSONResponse{Message: "Missing or invalid API token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isEventsPath は、path が Server-Sent Events の配信エンドポイント (/events と旧パス) かを返します。
+func isEventsPath(path string) bool {
+	return path == "/api/v1/events" || path == "/events"
+}
+
+// IsAdmin は、リクエストが管理者のトークン (SRVMNG_ADMIN_TOKEN) で認証されているかを返します。
+// SRVMNG_ADMIN_TOKEN が設定されていない場合は常に false です。
+func IsAdmin(r *http.Request) bool {
+	admin, _ := r.Context().Value(adminKey{}).(bool)
+	return admin
+}
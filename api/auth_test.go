@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// authStatus は、RequireToken を通したリクエストの応答ステータスと、管理者として扱われたかを返します。
+func authStatus(t *testing.T, path, header string) (int, bool) {
+	t.Helper()
+	var admin bool
+	handler := RequireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin = IsAdmin(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", path, nil)
+	if header != "" {
+		req.Header.Set("Authorization", "Bearer "+header)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec.Code, admin
+}
+
+func TestRequireToken(t *testing.T) {
+	for _, c := range []struct {
+		name            string
+		apiToken, admin string
+		path, header    string
+		wantCode        int
+		wantAdmin       bool
+	}{
+		{"no tokens configured", "", "", "/api/v1/targets", "", http.StatusOK, false},
+		{"api token", "api", "", "/api/v1/targets", "api", http.StatusOK, false},
+		{"missing api token", "api", "", "/api/v1/targets", "", http.StatusUnauthorized, false},
+		{"wrong api token", "api", "", "/api/v1/targets", "wrong", http.StatusUnauthorized, false},
+		{"admin token", "api", "admin", "/api/v1/targets", "admin", http.StatusOK, true},
+		{"admin only: missing token", "", "admin", "/api/v1/targets", "", http.StatusUnauthorized, false},
+		{"admin only: wrong token", "", "admin", "/api/v1/targets", "wrong", http.StatusUnauthorized, false},
+		{"admin only: admin token", "", "admin", "/api/v1/targets", "admin", http.StatusOK, true},
+		{"dashboard is public", "api", "admin", "/dashboard/", "", http.StatusOK, false},
+		{"query token on events", "api", "", "/api/v1/events?access_token=api", "", http.StatusOK, false},
+		{"query token on legacy events", "api", "", "/events?access_token=api", "", http.StatusOK, false},
+		{"query token elsewhere", "api", "", "/api/v1/targets?access_token=api", "", http.StatusUnauthorized, false},
+		{"admin query token elsewhere", "api", "admin", "/api/v1/targets/export?include_secrets=true&access_token=admin", "", http.StatusUnauthorized, false},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("SRVMNG_API_TOKEN", c.apiToken)
+			t.Setenv("SRVMNG_ADMIN_TOKEN", c.admin)
+			code, admin := authStatus(t, c.path, c.header)
+			if code != c.wantCode || admin != c.wantAdmin {
+				t.Errorf("code = %d, admin = %t, want %d, %t", code, admin, c.wantCode, c.wantAdmin)
+			}
+		})
+	}
+}
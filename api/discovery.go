@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"srv_mng/service"
+	"srv_mng/utils"
+)
+
+// DiscoveryRequest は POST /discovery/scans のリクエストボディです。
+type DiscoveryRequest struct {
+	CIDR  string   `json:"cidr"`  // 探索する IPv4 のネットワーク (例: 192.168.1.0/24)
+	Ports []string `json:"ports"` // power_agent のポート (省略時は 8080)
+}
+
+// writeDiscoveryError は、探索や候補が存在しない場合は not_found、それ以外は writeServiceError でエラーを返します。
+// (ターゲットが存在しない場合の target_not_found とは区別する)
+func writeDiscoveryError(w http.ResponseWriter, r *http.Request, err error, resp utils.JSONResponse) {
+	if errors.Is(err, service.ErrNotFound) {
+		if resp.Message == "" {
+			resp.Message = err.Error()
+		}
+		utils.WriteError(w, r, http.StatusNotFound, utils.CodeNotFound, resp)
+		return
+	}
+	writeServiceError(w, r, err, resp)
+}
+
+// writeDiscoveryJSON は、ディスカバリの応答を JSON で返します。
+func writeDiscoveryJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[ERROR] Error encoding discovery response: %v", err)
+	}
+}
+
+// StartDiscoveryHandler は POST /discovery/scans を処理するハンドラです。
+// 指定したサブネットで power_agent が応答するホストの探索をバックグラウンドで開始し、202 で探索の情報を返します。
+// 進捗は Location ヘッダーの GET /discovery/scans/{id} で確認できます。
+func StartDiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	var req DiscoveryRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: "Invalid JSON format in request body"})
+		return
+	}
+
+	scan, err := service.StartDiscovery(req.CIDR, req.Ports)
+	if err != nil {
+		writeDiscoveryError(w, r, err, utils.JSONResponse{Status: "failure", Message: fmt.Sprintf("Failed to start discovery: %v", err)})
+		return
+	}
+	w.Header().Set("Location", "/api/v1/discovery/scans/"+scan.ID)
+	writeDiscoveryJSON(w, http.StatusAccepted, scan)
+}
+
+// DiscoveryScansHandler は GET /discovery/scans を処理するハンドラです。探索の結果を新しい順に返します。
+func DiscoveryScansHandler(w http.ResponseWriter, r *http.Request) {
+	writeDiscoveryJSON(w, http.StatusOK, service.ListDiscoveryScans())
+}
+
+// DiscoveryScanHandler は GET /discovery/scans/{id} を処理するハンドラです。探索の進捗と結果を返します。
+func DiscoveryScanHandler(w http.ResponseWriter, r *http.Request) {
+	scan, err := service.GetDiscoveryScan(r.PathValue("id"))
+	if err != nil {
+		writeDiscoveryError(w, r, err, utils.JSONResponse{})
+		return
+	}
+	writeDiscoveryJSON(w, http.StatusOK, scan)
+}
+
+// PendingTargetsHandler は GET /discovery/pending を処理するハンドラです。登録待ちの候補をアドレス順に返します。
+func PendingTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	writeDiscoveryJSON(w, http.StatusOK, service.ListPendingTargets())
+}
+
+// AcceptPendingTargetHandler は POST /discovery/pending/{host_ip}/accept を処理するハンドラです。
+// 候補をターゲットとして登録し、201 で登録した設定を返します。
+// リクエストボディに JSON で指定した項目 (name、tags、ssh_user など) は、候補の値を上書きして登録します。ボディは省略できます。
+func AcceptPendingTargetHandler(w http.ResponseWriter, r *http.Request) {
+	hostIP := r.PathValue("host_ip")
+	patch, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: fmt.Sprintf("Failed to read request body: %v", err)})
+		return
+	}
+	if len(patch) > 0 && !json.Valid(patch) {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: "Invalid JSON format in request body"})
+		return
+	}
+
+	config, err := service.AcceptPendingTarget(hostIP, patch)
+	if err != nil {
+		writeDiscoveryError(w, r, err, utils.JSONResponse{Status: "failure", Message: fmt.Sprintf("Failed to accept pending target: %v", err)})
+		return
+	}
+	writeDiscoveryJSON(w, http.StatusCreated, config.Redacted())
+}
+
+// DismissPendingTargetHandler は DELETE /discovery/pending/{host_ip} を処理するハンドラです。登録しない候補を削除します。
+func DismissPendingTargetHandler(w http.ResponseWriter, r *http.Request) {
+	hostIP := r.PathValue("host_ip")
+	if err := service.DismissPendingTarget(hostIP); err != nil {
+		writeDiscoveryError(w, r, err, utils.JSONResponse{Status: "failure"})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.JSONResponse{Status: "success", Message: fmt.Sprintf("Pending target '%s' dismissed.", hostIP)})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"srv_mng/service"
+	"srv_mng/utils"
+	"time"
+)
+
+// writeServiceError は、サービス層のエラーの種類に応じた HTTP ステータスとエラーコードで応答します。
+// resp には Target など、エラー以外に返す項目を指定します。
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error, resp utils.JSONResponse) {
+	if resp.Message == "" {
+		resp.Message = err.Error()
+	}
+	// 検証エラーは、誤りのある項目の一覧を error.details で返す
+	var ve *service.ValidationError
+	if errors.As(err, &ve) {
+		resp.Error = &utils.ErrorDetail{Details: ve.Errors}
+	}
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		utils.WriteError(w, r, http.StatusNotFound, utils.CodeTargetNotFound, resp)
+	case errors.Is(err, service.ErrInvalid):
+		utils.WriteError(w, r, http.StatusUnprocessableEntity, utils.CodeValidationFailed, resp)
+	case errors.Is(err, service.ErrConflict):
+		utils.WriteError(w, r, http.StatusConflict, utils.CodeConflict, resp)
+	case errors.Is(err, service.ErrUnavailable):
+		utils.WriteError(w, r, http.StatusServiceUnavailable, utils.CodeUnavailable, resp)
+	default:
+		utils.WriteError(w, r, http.StatusInternalServerError, utils.CodeInternal, resp)
+	}
+}
+
+// requestIDPattern は、クライアントが X-Request-ID で指定できるリクエスト ID の形式です。
+// ログにそのまま出力するため、英数字と一部の記号のみを受け付けます。
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// newRequestID は、16文字の16進数のリクエスト ID を作成します。
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder は、アクセスログのために応答のステータスコードを記録します。
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap は、http.NewResponseController が元の ResponseWriter の Flush などを使えるようにします (/events で使用)。
+func (rec *statusRecorder) Unwrap() http.ResponseWriter { return rec.ResponseWriter }
+
+// RequestID は、リクエストごとに ID を割り当て、X-Request-ID ヘッダーで返します。
+// クライアントが X-Request-ID を指定した場合はその値を使うため、クライアント側のログと突き合わせられます。
+// ID はエラー応答の error.request_id とログにも出力します。
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(utils.WithRequestID(r.Context(), id)))
+		log.Printf("[INFO] [%s] %s %s %d (%s)", id, r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	})
+}
+
+// discardWriter は、ServeMux の既定の 404/405 応答からステータスと Allow ヘッダーだけを取り出します。
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(status int)      { d.status = status }
+
+// JSONErrors は、ServeMux に一致するルートがない場合の応答 (404 / 405) を共通のエラー形式にします。
+func JSONErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// 一致しない理由 (パスがない / メソッドが違う) は ServeMux に判定させる
+		d := &discardWriter{header: http.Header{}}
+		mux.ServeHTTP(d, r)
+		switch d.status {
+		case http.StatusMethodNotAllowed:
+			w.Header().Set("Allow", d.header.Get("Allow"))
+			utils.WriteError(w, r, http.StatusMethodNotAllowed, utils.CodeMethodNotAllowed, utils.JSONResponse{Message: "Method " + r.Method + " is not allowed for " + r.URL.Path})
+		case http.StatusNotFound:
+			utils.WriteError(w, r, http.StatusNotFound, utils.CodeNotFound, utils.JSONResponse{Message: "No API endpoint at " + r.URL.Path})
+		default:
+			// パスの正規化によるリダイレクトなど
+			for k, v := range d.header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(d.status)
+		}
+	})
+}
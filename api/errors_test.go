@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"srv_mng/service"
+	"srv_mng/utils"
+)
+
+// newTestDB は、一時ディレクトリの SQLite でサービス層の DB を初期化し、テストの終了時に閉じます。
+func newTestDB(t *testing.T) {
+	t.Helper()
+	if err := service.InitDB("file:" + filepath.Join(t.TempDir(), "monitor.db") + "?_sync=OFF"); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { service.CloseDB() })
+	// main と同様に、初期データの挿入の失敗は無視する (テーブルは作成済み)
+	if err := service.CreateInitialTables(); err != nil {
+		t.Logf("CreateInitialTables: %v", err)
+	}
+}
+
+// testHandler は、main と同じミドルウェアを通したターゲット管理のハンドラを返します。
+func testHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /targets/register", RegisterTargetHandler)
+	mux.HandleFunc("GET /targets/{name}", GetTargetHandler)
+	mux.HandleFunc("PATCH /targets/{name}", UpdateTargetHandler)
+	return RequestID(JSONErrors(mux))
+}
+
+// serve は、リクエストを testHandler で処理し、応答と JSON の本文を返します。
+func serve(t *testing.T, method, path, body, requestID string) (*httptest.ResponseRecorder, utils.JSONResponse) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	rec := httptest.NewRecorder()
+	testHandler().ServeHTTP(rec, req)
+
+	var resp utils.JSONResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: response is not JSON: %q", method, path, rec.Body.String())
+	}
+	return rec, resp
+}
+
+// TestServiceErrorStatus は、サービス層のエラーの種類が HTTP ステータスとエラーコードに対応することを確認します。
+func TestServiceErrorStatus(t *testing.T) {
+	type errorCase struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}
+	check := func(t *testing.T, c errorCase) utils.JSONResponse {
+		t.Helper()
+		rec, resp := serve(t, c.method, c.path, c.body, "")
+		if rec.Code != c.status || resp.Error == nil || resp.Error.Code != c.code {
+			t.Errorf("%s: status = %d, error = %+v, want %d %s", c.name, rec.Code, resp.Error, c.status, c.code)
+		}
+		return resp
+	}
+
+	// DB が利用できない場合
+	check(t, errorCase{"no database", "GET", "/targets/web01", "", http.StatusServiceUnavailable, utils.CodeUnavailable})
+
+	newTestDB(t)
+	if rec, _ := serve(t, "POST", "/targets/register", `{"name":"web01","type":"host","host_ip":"172.16.0.11","port":"8080"}`, ""); rec.Code != http.StatusOK {
+		t.Fatalf("register: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	for _, c := range []errorCase{
+		{"unknown target", "GET", "/targets/web02", "", http.StatusNotFound, utils.CodeTargetNotFound},
+		{"patch unknown target", "PATCH", "/targets/web02", `{"port":"22"}`, http.StatusNotFound, utils.CodeTargetNotFound},
+		{"rename", "PATCH", "/targets/web01", `{"name":"web02"}`, http.StatusConflict, utils.CodeConflict},
+		{"invalid patch", "PATCH", "/targets/web01", `{"port":"70000"}`, http.StatusUnprocessableEntity, utils.CodeValidationFailed},
+		{"malformed JSON", "PATCH", "/targets/web01", `{"port":`, http.StatusBadRequest, utils.CodeBadRequest},
+		{"no route", "GET", "/nowhere", "", http.StatusNotFound, utils.CodeNotFound},
+		{"wrong method", "DELETE", "/targets/register", "", http.StatusMethodNotAllowed, utils.CodeMethodNotAllowed},
+	} {
+		check(t, c)
+	}
+
+	// 検証エラーは誤りのある項目を error.details で返す
+	resp := check(t, errorCase{"invalid target", "POST", "/targets/register", `{"name":"web03","type":"host","host_ip":"172.16.0.13","port":"70000","mac_address":"xx"}`,
+		http.StatusUnprocessableEntity, utils.CodeValidationFailed})
+	details, _ := json.Marshal(resp.Error.Details)
+	for _, field := range []string{`"field":"port"`, `"field":"mac_address"`} {
+		if !strings.Contains(string(details), field) {
+			t.Errorf("error.details = %s, want %s", details, field)
+		}
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	// 指定した ID は応答ヘッダーと error.request_id でそのまま返す
+	rec, resp := serve(t, "GET", "/nowhere", "", "client-42.retry_1")
+	if got := rec.Header().Get("X-Request-ID"); got != "client-42.retry_1" {
+		t.Errorf("X-Request-ID = %q, want the client's ID", got)
+	}
+	if resp.Error == nil || resp.Error.RequestID != "client-42.retry_1" {
+		t.Errorf("error = %+v, want request_id client-42.retry_1", resp.Error)
+	}
+
+	// 形式が不正な ID (ログの改ざんを防ぐため) や未指定の場合は新しい ID を割り当てる
+	for _, given := range []string{"", "bad id\nINJECTED", strings.Repeat("a", 65)} {
+		rec, resp := serve(t, "GET", "/nowhere", "", given)
+		id := rec.Header().Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) || id == given || len(id) != 16 {
+			t.Errorf("given %q: X-Request-ID = %q, want a new 16-character ID", given, id)
+		}
+		if resp.Error == nil || resp.Error.RequestID != id {
+			t.Errorf("given %q: error.request_id = %+v, want %q", given, resp.Error, id)
+		}
+	}
+}
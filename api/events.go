@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"srv_mng/service"
+	"srv_mng/utils"
+	"strconv"
+	"time"
+)
+
+// sseHeartbeat は、プロキシなどで接続が切られないようコメント行を送る間隔です。
+const sseHeartbeat = 15 * time.Second
+
+// EventsHandler は /events を処理するハンドラです。
+// 状態変化・電源操作の進捗・アラートを Server-Sent Events (text/event-stream) で配信します。
+// Last-Event-ID ヘッダー (または ?last_event_id=) を指定すると、リングバッファに残っているイベントから再開します。
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: "Invalid Last-Event-ID."})
+			return
+		}
+		lastID = id
+	}
+
+	// サーバ全体の WriteTimeout でストリームが切断されないよう、この接続のみ無効にする
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("[ERROR] Failed to disable write deadline for /events: %v", err)
+	}
+
+	ch, backlog, complete, unsubscribe := service.SubscribeEvents(lastID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// 初回接続、または再送できないイベントがある場合は現在のステータス一覧を送る
+	if lastID == 0 || !complete {
+		statuses, err := service.GetStatusSnapshot()
+		if err != nil {
+			log.Printf("[ERROR] Failed to load status snapshot for /events: %v", err)
+		} else if err := writeSSE(w, 0, "snapshot", statuses); err != nil {
+			return
+		}
+	}
+	for _, ev := range backlog {
+		if err := writeSSE(w, ev.ID, ev.Type, ev.Data); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.Printf("[ERROR] Streaming is not supported for /events: %v", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-ch:
+			if err := writeSSE(w, ev.ID, ev.Type, ev.Data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSE は、1件のイベントを SSE 形式で書き込みます。id が0の場合は id フィールドを省略します。
+func writeSSE(w http.ResponseWriter, id uint64, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("[ERROR] Error encoding event '%s': %v", eventType, err)
+		return nil
+	}
+	if id > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, payload)
+	return err
+}
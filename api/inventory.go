@@ -0,0 +1,225 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"srv_mng/service"
+	"srv_mng/utils"
+	"strings"
+)
+
+// maxInventorySize は、インポートで受け付けるファイルの最大サイズです。
+const maxInventorySize = 10 << 20
+
+// inventoryContentTypes は、インベントリの形式と Content-Type の対応です。
+var inventoryContentTypes = map[string]string{
+	"yaml": "application/yaml; charset=utf-8",
+	"json": "application/json; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+}
+
+// inventoryMediaTypes は、インポートの Content-Type とエクスポートの Accept で受け付けるメディアタイプです。
+var inventoryMediaTypes = []mediaFormat{
+	{"application/json", "json"},
+	{"application/yaml", "yaml"},
+	{"application/x-yaml", "yaml"},
+	{"text/yaml", "yaml"},
+	{"text/x-yaml", "yaml"},
+	{"text/csv", "csv"},
+	{"application/csv", "csv"},
+}
+
+// inventoryExtensions は、インポートするファイルの拡張子と形式の対応です。
+var inventoryExtensions = map[string]string{
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".csv":  "csv",
+}
+
+// queryInventoryFormat は、?format= で指定された形式を返します。指定がない場合は空文字を返します。
+func queryInventoryFormat(r *http.Request) (string, error) {
+	f := strings.ToLower(r.URL.Query().Get("format"))
+	if f == "yml" {
+		f = "yaml"
+	}
+	if f != "" && !slices.Contains(service.InventoryFormats, f) {
+		return "", fmt.Errorf("unknown format '%s' (must be one of: %s)", f, strings.Join(service.InventoryFormats, ", "))
+	}
+	return f, nil
+}
+
+// ImportTargetsHandler は POST /targets/import を処理するハンドラです。
+// multipart/form-data の "file"、またはリクエストボディそのものを YAML・JSON・CSV のインベントリとして読み込みます。
+// 形式は ?format=、Content-Type、ファイルの拡張子、内容の順に判定します。
+// ?mode=upsert (デフォルト) は追加・更新のみ、?mode=replace はファイルにないターゲットを削除します。
+// ?dry_run=true の場合は DB を変更せず、反映した場合の差分を返します。
+func ImportTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	mode := query.Get("mode")
+	if mode == "" {
+		mode = service.ImportUpsert
+	}
+	if mode != service.ImportUpsert && mode != service.ImportReplace {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: fmt.Sprintf("'mode' must be '%s' or '%s'.", service.ImportUpsert, service.ImportReplace)})
+		return
+	}
+	format, err := queryInventoryFormat(r)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: err.Error()})
+		return
+	}
+
+	data, contentType, filename, err := readInventoryBody(w, r)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: err.Error()})
+		return
+	}
+	if format == "" {
+		format = detectInventoryFormat(data, contentType, filename)
+	}
+
+	targets, err := service.DecodeTargets(data, format)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: fmt.Sprintf("Failed to read %s inventory: %v", format, err)})
+		return
+	}
+
+	result, err := service.ImportTargets(targets, mode, query.Get("dry_run") == "true")
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{Status: "failure", Message: fmt.Sprintf("Failed to import targets: %v", err)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("[ERROR] Error encoding import response: %v", err)
+	}
+}
+
+// readInventoryBody は、インポートするインベントリの内容と、その Content-Type・ファイル名を返します。
+func readInventoryBody(w http.ResponseWriter, r *http.Request) ([]byte, string, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxInventorySize)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to read request body: %v", err)
+		}
+		return data, mediaType, "", nil
+	}
+
+	if err := r.ParseMultipartForm(maxInventorySize); err != nil {
+		return nil, "", "", fmt.Errorf("failed to parse multipart form: %v", err)
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, "", "", fmt.Errorf("missing 'file' field in multipart form")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to read uploaded file: %v", err)
+	}
+	partType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	return data, partType, header.Filename, nil
+}
+
+// detectInventoryFormat は、Content-Type、ファイルの拡張子、内容の順にインベントリの形式を判定します。
+// 判定できない場合は、内容が "[" か "{" で始まれば JSON、それ以外は YAML とします。
+func detectInventoryFormat(data []byte, contentType, filename string) string {
+	for _, m := range inventoryMediaTypes {
+		if m.mediaType == contentType {
+			return m.format
+		}
+	}
+	if format, ok := inventoryExtensions[strings.ToLower(filepath.Ext(filename))]; ok {
+		return format
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return "json"
+	}
+	return "yaml"
+}
+
+// ExportTargetsHandler は GET /targets/export を処理するハンドラです。
+// 登録済みのターゲット設定を ?format= または Accept ヘッダーの形式 (YAML・JSON・CSV、デフォルトは JSON) で返します。
+// 出力は POST /targets/import でそのまま読み込めます。?selector= でタグによる絞り込みができます。
+// パスワードなどの秘密情報は、管理者のトークンで ?include_secrets=true を指定した場合のみ含めます。
+func ExportTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format, err := queryInventoryFormat(r)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: err.Error()})
+		return
+	}
+	if format == "" {
+		format = negotiateFormat(r.Header.Get("Accept"), inventoryMediaTypes, "json")
+	}
+	includeSecrets := query.Get("include_secrets") == "true"
+	if includeSecrets && !IsAdmin(r) {
+		utils.WriteError(w, r, http.StatusForbidden, utils.CodeForbidden, utils.JSONResponse{Message: "'include_secrets' requires the admin token (SRVMNG_ADMIN_TOKEN)."})
+		return
+	}
+
+	targets, err := service.ListMonitorTargets()
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{})
+		return
+	}
+	selector := query.Get("selector")
+	result := []service.MonitorTarget{}
+	for _, t := range targets {
+		if !service.MatchSelector(t.Tags, selector) {
+			continue
+		}
+		if !includeSecrets {
+			t = t.Redacted()
+		}
+		result = append(result, t)
+	}
+	if includeSecrets {
+		log.Printf("[INFO] [%s] Exporting %d targets with secrets", utils.RequestID(r.Context()), len(result))
+	}
+
+	body, err := service.EncodeTargets(result, format)
+	if err != nil {
+		log.Printf("[ERROR] Error encoding targets export (%s): %v", format, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, utils.CodeInternal, utils.JSONResponse{Message: "Error encoding targets export"})
+		return
+	}
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Content-Type", inventoryContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="targets.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// InventoryDriftHandler は GET /inventory/drift を処理するハンドラです。
+// インベントリファイル (INVENTORY_FILE) の内容と DB の差分を返します。差分がない場合は in_sync が true になります。
+func InventoryDriftHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := service.InventoryDrift()
+	if errors.Is(err, service.ErrNotFound) {
+		// INVENTORY_FILE が未設定の場合 (ターゲットが存在しない場合の target_not_found とは区別する)
+		utils.WriteError(w, r, http.StatusNotFound, utils.CodeNotFound, utils.JSONResponse{Message: err.Error()})
+		return
+	}
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("[ERROR] Error encoding inventory drift response: %v", err)
+	}
+}
@@ -2,44 +2,54 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
 	"srv_mng/service" // サービス層 (ビジネスロジック)
 	"srv_mng/utils"   // utilsパッケージを使用
+	"strconv"
 	"strings"
+	"unicode"
 )
 
-// PowerActionRequest は /power/start, /power/stop リクエストのペイロード
+// PowerActions は /power/{action} で受け付けるアクションの一覧です。
+var PowerActions = []string{"start", "stop", "cancel", "reboot", "suspend", "hibernate"}
+
+// PowerActionRequest は /power/<action> リクエストのペイロード
 type PowerActionRequest struct {
-	Target string `json:"target"`
+	Target  string `json:"target"`
+	Delay   int    `json:"delay,omitempty"`   // stop のみ: シャットダウンまでの猶予 (分)
+	Message string `json:"message,omitempty"` // stop/cancel のみ: ログイン中のユーザーへの wall メッセージ
+	Force   bool   `json:"force,omitempty"`   // stop のみ: 強制停止 (対応するドライバのみ)
 }
 
-// PowerHandler は /power/start と /power/stop を処理するハンドラです。
+// PowerHandler は POST /power/{action} (start, stop, cancel, reboot, suspend, hibernate) を処理するハンドラです。
 func PowerHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		utils.WriteJSON(w, http.StatusMethodNotAllowed, utils.JSONResponse{Status: "error", Message: "Only POST method is supported"})
-		return
-	}
-
-	// URLからアクション (start/stop) を取得
-	pathParts := strings.Split(r.URL.Path, "/")
-	action := pathParts[len(pathParts)-1]
+	// URLからアクション (start/stop/cancel/reboot/suspend/hibernate) を取得
+	action := r.PathValue("action")
 
 	// アクション名が不正でないかチェック
-	if action != "start" && action != "stop" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.JSONResponse{Status: "error", Message: fmt.Sprintf("Invalid action '%s'. Must be 'start' or 'stop'.", action)})
+	if !slices.Contains(PowerActions, action) {
+		utils.WriteError(w, r, http.StatusNotFound, utils.CodeNotFound, utils.JSONResponse{Message: fmt.Sprintf("Invalid action '%s'. Must be one of 'start', 'stop', 'cancel', 'reboot', 'suspend' or 'hibernate'.", action)})
 		return
 	}
 
 	var req PowerActionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.JSONResponse{Status: "error", Message: "Invalid JSON format or missing required fields in request body"})
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: "Invalid JSON format or missing required fields in request body"})
 		return
 	}
 
 	targetName := req.Target
 	if targetName == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.JSONResponse{Status: "error", Message: "Missing 'target' parameter in request."})
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: "Missing 'target' parameter in request."})
+		return
+	}
+
+	if req.Delay < 0 {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: "'delay' must be zero or a positive number of minutes."})
 		return
 	}
 
@@ -47,35 +57,29 @@ func PowerHandler(w http.ResponseWriter, r *http.Request) {
 	// service.GetTargetConfig() は DB から targetName に一致するレコードを検索します
 	config, err := service.GetTargetConfig(targetName)
 	if err != nil {
-		// DB接続エラー、またはターゲットが見つからない場合
-		utils.WriteJSON(w, http.StatusBadRequest, utils.JSONResponse{
-			Status:  "error",
-			Message: fmt.Sprintf("Target configuration fetch failed: %s", err.Error()),
-		})
-		return
-	}
-
-	// ホストターゲット（IP/MAC/User/Passが必要なもの）か確認
-	if config.Type != "host" {
-		// host 以外のタイプは電源制御の対象外とする
-		utils.WriteJSON(w, http.StatusBadRequest, utils.JSONResponse{
-			Status:  "error",
-			Message: fmt.Sprintf("Power control only supported for 'host' type targets. Target '%s' is type '%s'.", config.Name, config.Type),
-		})
+		// DB接続エラー (503)、またはターゲットが見つからない場合 (404)
+		writeServiceError(w, r, err, utils.JSONResponse{Target: targetName, Message: fmt.Sprintf("Target configuration fetch failed: %s", err.Error())})
 		return
 	}
 
 	// サービス層の実行
-	output, err := service.ExecutePowerScript(action, config)
+	opts := service.PowerOptions{Delay: req.Delay, Message: req.Message, Force: req.Force}
+	output, err := service.ExecutePowerScript(action, config, opts)
 
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.JSONResponse{
+		resp := utils.JSONResponse{
 			Status:       "failure",
 			Action:       action,
 			Target:       config.Name,
 			Message:      err.Error(),
 			ScriptOutput: output,
-		})
+		}
+		// 操作の前に拒否した場合 (未対応の操作、同じ操作が進行中など) はその種類で、実行に失敗した場合は 500 で応答する
+		if errors.Is(err, service.ErrInvalid) || errors.Is(err, service.ErrConflict) || errors.Is(err, service.ErrUnavailable) {
+			writeServiceError(w, r, err, resp)
+		} else {
+			utils.WriteError(w, r, http.StatusInternalServerError, utils.CodePowerFailed, resp)
+		}
 		return
 	}
 
@@ -88,51 +92,165 @@ func PowerHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// StatusHandler は /status を処理するハンドラです。JSONまたはプレーンテキストを返します。
+// CapabilitiesHandler は /power/capabilities を処理するハンドラです。
+// クエリパラメータ target で指定したターゲットが実行可能な電源操作の一覧を返します。
+func CapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	targetName := r.URL.Query().Get("target")
+	if targetName == "" {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: "Missing 'target' query parameter."})
+		return
+	}
+
+	config, err := service.GetTargetConfig(targetName)
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{Target: targetName, Message: fmt.Sprintf("Target configuration fetch failed: %s", err.Error())})
+		return
+	}
+
+	caps, err := service.GetPowerCapabilities(config)
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{Target: config.Name})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(caps); err != nil {
+		log.Printf("[ERROR] Error encoding capabilities response: %v", err)
+	}
+}
+
+// StatusHandler は /status を処理するハンドラです。
+// Accept ヘッダーまたは ?format= に応じて JSON・YAML・CSV・Markdown・テキストの表を返します。
+// ?fields= で列、?sort= で順序、?selector= と ?filter= で対象を指定できます。
 func StatusHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		utils.WriteJSON(w, http.StatusMethodNotAllowed, utils.JSONResponse{Status: "error", Message: "Only GET method is supported"})
+	// 出力形式と絞り込み・並べ替えの指定を先に検証する (?refresh=true の死活確認を無駄に実行しないため)
+	query := r.URL.Query()
+	format, err := statusFormat(r)
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: err.Error()})
+		return
+	}
+	fields, err := parseStatusFields(query.Get("fields"))
+	if err == nil && fields != nil && format == "text" {
+		err = fmt.Errorf("'fields' cannot be used with the text format; use format=table instead")
+	}
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: err.Error()})
+		return
+	}
+	compare, err := parseStatusSort(query.Get("sort"))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: err.Error()})
+		return
+	}
+	filters, err := parseStatusFilters(query["filter"])
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: err.Error()})
 		return
 	}
 
 	// サービス層からすべてのターゲットのステータスを取得
-	statuses, err := service.GetAllTargetsStatus()
+	// 通常はバックグラウンド監視の最新結果を返し、?refresh=true の場合のみその場で死活確認を行う (状態は確定させない)
+	var statuses []service.TargetStatus
+	if query.Get("refresh") == "true" {
+		statuses, err = service.ProbeStatuses()
+	} else {
+		statuses, err = service.GetStatusSnapshot()
+	}
 	if err != nil {
-		// 設定ファイルロードエラー時は、JSON/Plain Textどちらの場合でもエラーを返す
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("ERROR: Configuration loading failed: %s\n", err.Error())))
+		// 設定の読み込みに失敗した場合は、要求された形式にかかわらず共通のエラー形式 (JSON) で返す
+		writeServiceError(w, r, err, utils.JSONResponse{Message: fmt.Sprintf("Configuration loading failed: %s", err.Error())})
 		return
 	}
 
-	accept := r.Header.Get("Accept")
+	// ?selector= (例: "web,env=prod") でタグによる絞り込み、?filter= で状態・種別・タグによる絞り込み
+	selector := query.Get("selector")
+	filtered := []service.TargetStatus{}
+	for _, s := range statuses {
+		if selector != "" && !service.MatchSelector(s.Tags, selector) {
+			continue
+		}
+		matched := true
+		for _, f := range filters {
+			if !f.match(s) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			filtered = append(filtered, s)
+		}
+	}
+	statuses = filtered
 
-	// 1. Acceptヘッダーがない、または明示的にJSONが含まれている場合、JSONを返す
-	// JSONをデフォルトにします。
-	// CLI/curl向けに、text/plainが明示的に要求された場合のみプレーンテキストを返すようにロジックを反転させます。
-	isPlainTextRequested := strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+	// ?sort= の指定がない場合は、登録順 (監視結果の順) のまま返す
+	if compare != nil {
+		slices.SortStableFunc(statuses, compare)
+	}
+
+	body, err := renderStatuses(statuses, format, fields)
+	if err != nil {
+		log.Printf("[ERROR] Error formatting status response (%s): %v", format, err)
+		utils.WriteError(w, r, http.StatusInternalServerError, utils.CodeInternal, utils.JSONResponse{Message: "Error formatting status response"})
+		return
+	}
+	// Accept によって応答が変わるため、キャッシュが形式を取り違えないようにする
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("Content-Type", statusContentTypes[format])
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
 
-	if isPlainTextRequested {
-		// プレーンテキストを返す（CLIのデフォルト）
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+// StatusHistoryHandler は /status/history を処理するハンドラです。
+// 確定した状態変化の履歴を新しい順に返します。?target= で絞り込み、?limit= で件数を指定します (デフォルト100)。
+func StatusHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Message: "'limit' must be a positive integer."})
+			return
+		}
+		limit = n
+	}
 
-		// プレーンテキスト形式でデータを整形
-		output := formatStatusAsPlainText(statuses)
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(output))
+	history, err := service.GetStatusHistory(r.URL.Query().Get("target"), limit)
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{})
 		return
 	}
 
-	// 2. それ以外（Acceptヘッダーがない、またはJSONが優先される）の場合、JSONを返す
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		log.Printf("[ERROR] Error encoding status history response: %v", err)
+	}
+}
 
-	// JSONとしてエンコード
-	if err := json.NewEncoder(w).Encode(statuses); err != nil {
-		http.Error(w, "Error encoding JSON response", http.StatusInternalServerError)
+// MetricsHandler は /status/metrics を処理するハンドラです。
+// バックグラウンド監視で記録した直近のメトリクスをターゲットごとに返します。?target= で絞り込みます。
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	metrics := service.GetMetrics(r.URL.Query().Get("target"))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(metrics); err != nil {
+		log.Printf("[ERROR] Error encoding metrics response: %v", err)
 	}
 }
 
+// displayStatus は、"AgentDown" などの状態名を "AGENT DOWN" のような表示用の大文字表記に変換します。
+func displayStatus(status string) string {
+	var sb strings.Builder
+	for i, r := range status {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(rune(status[i-1])) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
 // formatStatusAsPlainText は service.TargetStatus スライスを ASCII 表形式に整形します。
 func formatStatusAsPlainText(statuses []service.TargetStatus) string {
 	// ヘッダー
@@ -145,15 +263,28 @@ func formatStatusAsPlainText(statuses []service.TargetStatus) string {
 
 	// 各ターゲットに対して結果を整形
 	for _, s := range statuses {
-		// プレーンテキストとして固定幅で整形
+		// プレーンテキストとして固定幅で整形 (フラップ中は状態の後ろに表示)
+		status := displayStatus(s.Status)
+		if s.Flapping {
+			status += " (FLAPPING)"
+		}
 		line := fmt.Sprintf(
 			"%-12s%-25s%-25s%s\n",
 			s.Type,
 			s.Name,
 			s.HostPort,
-			strings.ToUpper(s.Status),
+			status,
 		)
 		sb.WriteString(line)
+
+		// 追加のヘルスチェック結果をターゲットの下に字下げして表示
+		for _, c := range s.Checks {
+			result := "OK"
+			if !c.OK {
+				result = "FAIL"
+			}
+			sb.WriteString(fmt.Sprintf("    - %-8s%-25s%-6s%s\n", c.Type, c.Name, result, c.Message))
+		}
 	}
 
 	return sb.String()
@@ -5,56 +5,68 @@ import (
 	"fmt"
 	"net/http"
 	"srv_mng/service"
+	"srv_mng/utils"
 )
 
-// RegResponse はターゲット登録APIの応答構造体です。
-type RegResponse struct {
-	Status  string `json:"status"`
-	Target  string `json:"target,omitempty"`
-	Message string `json:"message"`
-}
-
 // RegisterTargetHandler は /targets/register を処理するハンドラです。
 // POSTリクエストを受け付け、DBに新しいターゲット設定を保存または既存のものを更新します。
 func RegisterTargetHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, `{"status":"error", "message":"Only POST method is supported"}`, http.StatusMethodNotAllowed)
-		return
-	}
-
 	// リクエストボディを service.MonitorTarget 構造体としてデコード
 	var config service.MonitorTarget
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-		resp := RegResponse{
-			Status:  "error",
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{
 			Message: fmt.Sprintf("Invalid JSON format or missing required fields: %v", err),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(resp)
+		})
 		return
 	}
 
-	// 1. service層にDB保存を依頼
+	// 1. service層にDB保存を依頼 (設定の検証エラーは 422、DB のエラーは 503)
 	if err := service.SaveMonitorTarget(&config); err != nil {
-		resp := RegResponse{
+		writeServiceError(w, r, err, utils.JSONResponse{
 			Status:  "failure",
 			Target:  config.Name,
 			Message: fmt.Sprintf("Failed to save target configuration: %v", err),
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(resp)
+		})
 		return
 	}
 
 	// 成功応答
-	resp := RegResponse{
+	utils.WriteJSON(w, http.StatusOK, utils.JSONResponse{
 		Status:  "success",
 		Target:  config.Name,
 		Message: fmt.Sprintf("Target '%s' configuration successfully saved or updated.", config.Name),
+	})
+}
+
+// MaintenanceRequest はメンテナンスモード切替APIのリクエスト構造体です。
+type MaintenanceRequest struct {
+	Target  string `json:"target"`
+	Enabled bool   `json:"enabled"`
+}
+
+// MaintenanceHandler は /targets/maintenance を処理するハンドラです。
+// POSTリクエストを受け付け、ターゲットのメンテナンスモードを切り替えます。
+func MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var req MaintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Target == "" {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{
+			Message: "Invalid JSON format or missing 'target' field",
+		})
+		return
+	}
+
+	if err := service.SetMaintenance(req.Target, req.Enabled); err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{
+			Status:  "failure",
+			Target:  req.Target,
+			Message: fmt.Sprintf("Failed to update maintenance mode: %v", err),
+		})
+		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+
+	utils.WriteJSON(w, http.StatusOK, utils.JSONResponse{
+		Status:  "success",
+		Target:  req.Target,
+		Message: fmt.Sprintf("Maintenance mode for target '%s' set to %t.", req.Target, req.Enabled),
+	})
 }
@@ -0,0 +1,404 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"srv_mng/service"
+	"srv_mng/utils"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// statusContentTypes は、/status の出力形式と Content-Type の対応です。
+var statusContentTypes = map[string]string{
+	"json":     "application/json; charset=utf-8",
+	"yaml":     "application/yaml; charset=utf-8",
+	"csv":      "text/csv; charset=utf-8",
+	"markdown": "text/markdown; charset=utf-8",
+	"table":    "text/plain; charset=utf-8",
+	"text":     "text/plain; charset=utf-8",
+}
+
+// statusFormatAliases は、?format= で受け付ける別名です。
+var statusFormatAliases = map[string]string{
+	"yml": "yaml",
+	"md":  "markdown",
+}
+
+// mediaFormat は、Accept ヘッダーのメディアタイプと出力形式の対応です。
+type mediaFormat struct{ mediaType, format string }
+
+// statusMediaTypes は、/status で Accept ヘッダーから選択できる形式です。
+// 同じ優先度 (q) の場合は、この順に選択します (JSON を優先する従来の動作に合わせるため)。
+var statusMediaTypes = []mediaFormat{
+	{"application/json", "json"},
+	{"application/yaml", "yaml"},
+	{"application/x-yaml", "yaml"},
+	{"text/yaml", "yaml"},
+	{"text/x-yaml", "yaml"},
+	{"text/csv", "csv"},
+	{"text/markdown", "markdown"},
+	{"text/x-markdown", "markdown"},
+	{"text/plain", "text"},
+}
+
+// statusFormat は、?format= または Accept ヘッダーから出力形式を決定します。
+// ?format= が優先され、どちらもない・対応する形式がない場合は JSON を返します。
+func statusFormat(r *http.Request) (string, error) {
+	if f := strings.ToLower(r.URL.Query().Get("format")); f != "" {
+		if alias, ok := statusFormatAliases[f]; ok {
+			f = alias
+		}
+		if _, ok := statusContentTypes[f]; !ok {
+			return "", fmt.Errorf("unknown format '%s' (must be one of: json, yaml, csv, markdown, table, text)", f)
+		}
+		return f, nil
+	}
+	return negotiateFormat(r.Header.Get("Accept"), statusMediaTypes, "json"), nil
+}
+
+// negotiateFormat は、Accept ヘッダーの優先度 (q) が最も高いメディアタイプの形式を返します。
+// 同じ優先度の場合は mediaTypes の順で選び、対応する形式がない場合は fallback を返します。
+func negotiateFormat(accept string, mediaTypes []mediaFormat, fallback string) string {
+	format, bestQ, bestRank := fallback, 0.0, len(mediaTypes)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		rank := slices.IndexFunc(mediaTypes, func(m mediaFormat) bool { return m.mediaType == mediaType })
+		if rank < 0 || q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && rank < bestRank) {
+			format, bestQ, bestRank = mediaTypes[rank].format, q, rank
+		}
+	}
+	return format
+}
+
+// statusField は、/status の1列分の定義です。
+type statusField struct {
+	name   string                                   // ?fields= と ?sort= で指定する名前 (JSON のキー)
+	header string                                   // 表形式の見出し
+	value  func(s service.TargetStatus) interface{} // JSON・YAML の値
+	text   func(s service.TargetStatus) string      // CSV・表形式の値
+}
+
+// statusFields は、/status で選択できる列です。?fields= を省略した場合はこの順ですべて出力します。
+var statusFields = []statusField{
+	{"type", "TYPE",
+		func(s service.TargetStatus) interface{} { return s.Type },
+		func(s service.TargetStatus) string { return s.Type }},
+	{"name", "NAME",
+		func(s service.TargetStatus) interface{} { return s.Name },
+		func(s service.TargetStatus) string { return s.Name }},
+	{"host_port", "HOST:PORT",
+		func(s service.TargetStatus) interface{} { return s.HostPort },
+		func(s service.TargetStatus) string { return s.HostPort }},
+	{"status", "STATUS",
+		func(s service.TargetStatus) interface{} { return s.Status },
+		func(s service.TargetStatus) string { return s.Status }},
+	{"flapping", "FLAPPING",
+		func(s service.TargetStatus) interface{} { return s.Flapping },
+		func(s service.TargetStatus) string { return strconv.FormatBool(s.Flapping) }},
+	{"since", "SINCE",
+		func(s service.TargetStatus) interface{} {
+			if s.Since.IsZero() {
+				return nil
+			}
+			return s.Since
+		},
+		func(s service.TargetStatus) string {
+			if s.Since.IsZero() {
+				return ""
+			}
+			return s.Since.Format(time.RFC3339)
+		}},
+	{"checks", "CHECKS",
+		func(s service.TargetStatus) interface{} { return s.Checks },
+		func(s service.TargetStatus) string {
+			if len(s.Checks) == 0 {
+				return ""
+			}
+			ok := 0
+			for _, c := range s.Checks {
+				if c.OK {
+					ok++
+				}
+			}
+			return fmt.Sprintf("%d/%d", ok, len(s.Checks))
+		}},
+	{"tags", "TAGS",
+		func(s service.TargetStatus) interface{} { return s.Tags },
+		func(s service.TargetStatus) string { return strings.Join(s.Tags, ",") }},
+}
+
+// lookupStatusField は、名前から列の定義を返します。
+func lookupStatusField(name string) (statusField, bool) {
+	for _, f := range statusFields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return statusField{}, false
+}
+
+// parseStatusFields は ?fields= (例: "name,status,tags") を解釈します。省略した場合は nil を返します。
+func parseStatusFields(value string) ([]statusField, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var fields []statusField
+	for _, name := range strings.Split(value, ",") {
+		f, ok := lookupStatusField(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown field '%s' in 'fields'", name)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// statusSeverity は、?sort=status の順序です。対応が必要な状態を先頭にします。
+var statusSeverity = map[string]int{
+	service.StatusUnreachable:  0,
+	service.StatusAgentDown:    1,
+	service.StatusDegraded:     2,
+	service.StatusUnknown:      3,
+	service.StatusShuttingDown: 4,
+	service.StatusPoweringOn:   5,
+	service.StatusMaintenance:  6,
+	service.StatusRunning:      7,
+}
+
+// parseStatusSort は ?sort= (例: "status,-since") を解釈し、比較関数を返します。
+// 先頭に "-" を付けた項目は降順で、指定した項目がすべて等しい場合は名前順にします。
+func parseStatusSort(value string) (func(a, b service.TargetStatus) int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	type sortKey struct {
+		field statusField
+		desc  bool
+	}
+	var keys []sortKey
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		f, ok := lookupStatusField(strings.TrimPrefix(name, "-"))
+		if !ok {
+			return nil, fmt.Errorf("unknown field '%s' in 'sort'", name)
+		}
+		keys = append(keys, sortKey{f, desc})
+	}
+
+	return func(a, b service.TargetStatus) int {
+		for _, k := range keys {
+			var c int
+			switch k.field.name {
+			case "status":
+				c = statusSeverity[a.Status] - statusSeverity[b.Status]
+			case "since":
+				c = a.Since.Compare(b.Since)
+			default:
+				c = strings.Compare(k.field.text(a), k.field.text(b))
+			}
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.Name, b.Name)
+	}, nil
+}
+
+// statusFilter は ?filter= の1条件です。
+type statusFilter struct {
+	key    string   // status, type, tag
+	values []string // いずれかに一致すれば条件を満たす
+	negate bool     // "!=" の場合は、いずれにも一致しないことを条件とする
+}
+
+// parseStatusFilters は ?filter= (例: "status=AgentDown|Unreachable,type!=container,tag=web") を解釈します。
+// カンマ区切りの条件はすべて満たす必要があり、"|" で区切った値はいずれかに一致すれば条件を満たします。
+// ?filter= を複数指定した場合も、すべての条件を満たすものを返します。
+func parseStatusFilters(values []string) ([]statusFilter, error) {
+	var filters []statusFilter
+	for _, value := range values {
+		for _, term := range strings.Split(value, ",") {
+			term = strings.TrimSpace(term)
+			if term == "" {
+				continue
+			}
+			var f statusFilter
+			var rest string
+			if i, j := strings.Index(term, "!="), strings.Index(term, "="); i >= 0 && i < j {
+				f.key, rest, f.negate = term[:i], term[i+2:], true
+			} else if j >= 0 {
+				f.key, rest = term[:j], term[j+1:]
+			} else {
+				return nil, fmt.Errorf("invalid filter '%s' (expected key=value or key!=value)", term)
+			}
+			f.key = strings.ToLower(strings.TrimSpace(f.key))
+			if f.key != "status" && f.key != "type" && f.key != "tag" {
+				return nil, fmt.Errorf("unknown filter key '%s' (must be status, type or tag)", f.key)
+			}
+			for _, v := range strings.Split(rest, "|") {
+				f.values = append(f.values, strings.TrimSpace(v))
+			}
+			filters = append(filters, f)
+		}
+	}
+	return filters, nil
+}
+
+// normalizeStatus は、"agent_down" や "AGENT DOWN" のような表記でも状態名と一致するよう正規化します。
+func normalizeStatus(status string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(status))
+}
+
+// match は、ステータスが条件を満たすかを返します。
+func (f statusFilter) match(s service.TargetStatus) bool {
+	matched := false
+	for _, v := range f.values {
+		switch f.key {
+		case "status":
+			matched = normalizeStatus(s.Status) == normalizeStatus(v)
+		case "type":
+			matched = strings.EqualFold(s.Type, v)
+		case "tag":
+			matched = slices.Contains(s.Tags, v)
+		}
+		if matched {
+			break
+		}
+	}
+	return matched != f.negate
+}
+
+// renderStatuses は、指定した形式でステータスを整形します。fields が nil の場合はすべての列を出力します。
+func renderStatuses(statuses []service.TargetStatus, format string, fields []statusField) ([]byte, error) {
+	switch format {
+	case "text":
+		return []byte(formatStatusAsPlainText(statuses)), nil
+	case "json":
+		raw, err := statusesJSON(statuses, fields)
+		return append(raw, '\n'), err
+	case "yaml":
+		raw, err := statusesJSON(statuses, fields)
+		if err != nil {
+			return nil, err
+		}
+		return utils.JSONToYAML(raw)
+	}
+
+	if fields == nil {
+		fields = statusFields
+	}
+	rows := make([][]string, len(statuses))
+	for i, s := range statuses {
+		rows[i] = make([]string, len(fields))
+		for j, f := range fields {
+			rows[i][j] = f.text(s)
+		}
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "csv":
+		// 見出しは ?fields= と同じ名前にする (スプレッドシートやスクリプトで扱いやすくするため)
+		cw := csv.NewWriter(&buf)
+		header := make([]string, len(fields))
+		for i, f := range fields {
+			header[i] = f.name
+		}
+		cw.Write(header)
+		cw.WriteAll(rows)
+		if err := cw.Error(); err != nil {
+			return nil, err
+		}
+	case "markdown":
+		escape := strings.NewReplacer("|", `\|`, "\n", " ")
+		header := make([]string, len(fields))
+		sep := make([]string, len(fields))
+		for i, f := range fields {
+			header[i], sep[i] = f.header, "---"
+		}
+		fmt.Fprintf(&buf, "| %s |\n| %s |\n", strings.Join(header, " | "), strings.Join(sep, " | "))
+		for _, row := range rows {
+			cells := make([]string, len(row))
+			for i, c := range row {
+				cells[i] = escape.Replace(c)
+			}
+			fmt.Fprintf(&buf, "| %s |\n", strings.Join(cells, " | "))
+		}
+	case "table":
+		// 列の幅を内容に合わせる (空の値は "-" で表示して列がずれないようにする)
+		tw := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+		header := make([]string, len(fields))
+		for i, f := range fields {
+			header[i] = f.header
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range rows {
+			cells := make([]string, len(row))
+			for i, c := range row {
+				if c == "" {
+					c = "-"
+				}
+				cells[i] = c
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		tw.Flush()
+	}
+	return buf.Bytes(), nil
+}
+
+// statusesJSON は、ステータスを JSON 配列に変換します。
+// fields を指定した場合は、指定した列のみを指定した順で出力します。
+func statusesJSON(statuses []service.TargetStatus, fields []statusField) ([]byte, error) {
+	if fields == nil {
+		return json.Marshal(statuses)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, s := range statuses {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteByte('{')
+		for j, f := range fields {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(f.name)
+			value, err := json.Marshal(f.value(s))
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"srv_mng/service"
+)
+
+// sampleStatuses は、整形のテストで使用するステータスです。
+func sampleStatuses() []service.TargetStatus {
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []service.TargetStatus{
+		{Type: "host", Name: "web01", HostPort: "172.16.0.11:8080", Status: service.StatusRunning, Since: since, Tags: []string{"web", "env=prod"}},
+		{Type: "container", Name: "db", HostPort: "172.16.0.12:5432", Status: service.StatusDegraded, Flapping: true,
+			Checks: []service.CheckResult{{Name: "tcp", Type: "tcp", OK: true}, {Name: "http", Type: "http", OK: false}}},
+		{Type: "vm", Name: "build-server-01", HostPort: "172.16.0.13:22", Status: service.StatusUnreachable, Since: since.Add(time.Hour), Tags: []string{"ci|cd"}},
+	}
+}
+
+func TestStatusFormat(t *testing.T) {
+	for _, c := range []struct {
+		query, accept string
+		want          string
+		wantErr       bool
+	}{
+		{"", "", "json", false},
+		{"", "*/*", "json", false},
+		{"", "application/yaml", "yaml", false},
+		{"", "text/x-yaml", "yaml", false},
+		{"", "text/csv", "csv", false},
+		{"", "text/markdown", "markdown", false},
+		{"", "text/plain", "text", false},
+		{"", "text/html, application/xhtml+xml", "json", false},
+		{"", "text/plain;q=0.5, text/csv", "csv", false},
+		{"", "text/csv;q=0.8, application/yaml;q=0.9", "yaml", false},
+		{"", "text/csv, application/json", "json", false}, // 同じ優先度では JSON を優先する
+		{"", "text/csv;q=0, text/plain", "text", false},
+		{"", "text/csv;q=abc", "json", false},
+		{"format=csv", "application/json", "csv", false}, // ?format= は Accept より優先する
+		{"format=table", "text/csv", "table", false},
+		{"format=YML", "", "yaml", false},
+		{"format=md", "", "markdown", false},
+		{"format=xml", "text/csv", "", true},
+	} {
+		req := httptest.NewRequest("GET", "/api/v1/status?"+c.query, nil)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		got, err := statusFormat(req)
+		if got != c.want || (err != nil) != c.wantErr {
+			t.Errorf("?%s Accept %q: format = %q, err = %v, want %q (error %t)", c.query, c.accept, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+func TestRenderStatuses(t *testing.T) {
+	fields, err := parseStatusFields("name,status,checks,tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		format string
+		fields []statusField
+		want   string
+	}{
+		{"csv", fields, `name,status,checks,tags
+web01,Running,,"web,env=prod"
+db,Degraded,1/2,
+build-server-01,Unreachable,,ci|cd
+`},
+		{"markdown", fields, `| NAME | STATUS | CHECKS | TAGS |
+| --- | --- | --- | --- |
+| web01 | Running |  | web,env=prod |
+| db | Degraded | 1/2 |  |
+| build-server-01 | Unreachable |  | ci\|cd |
+`},
+		{"yaml", fields[:2], `- name: web01
+  status: Running
+- name: db
+  status: Degraded
+- name: build-server-01
+  status: Unreachable
+`},
+		{"json", []statusField{statusFields[4], statusFields[5]}, `[{"flapping":false,"since":"2026-01-02T03:04:05Z"},{"flapping":true,"since":null},{"flapping":false,"since":"2026-01-02T04:04:05Z"}]
+`},
+	} {
+		got, err := renderStatuses(sampleStatuses(), c.format, c.fields)
+		if err != nil {
+			t.Fatalf("renderStatuses(%s): %v", c.format, err)
+		}
+		if string(got) != c.want {
+			t.Errorf("%s:\n got %q\nwant %q", c.format, got, c.want)
+		}
+	}
+}
+
+// TestRenderStatusTable は、表形式の列の幅が最も長い値に合わせて決まることを確認します。
+func TestRenderStatusTable(t *testing.T) {
+	fields, err := parseStatusFields("name,status,since")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := renderStatuses(sampleStatuses(), "table", fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `NAME             STATUS       SINCE
+web01            Running      2026-01-02T03:04:05Z
+db               Degraded     -
+build-server-01  Unreachable  2026-01-02T04:04:05Z
+`
+	if string(got) != want {
+		t.Errorf("table:\n%s\nwant:\n%s", got, want)
+	}
+
+	// 短い値のみの場合は列も狭くなる
+	got, err = renderStatuses(sampleStatuses()[1:2], "table", fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NAME  STATUS    SINCE\ndb    Degraded  -\n"; string(got) != want {
+		t.Errorf("table:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestStatusQueryErrors(t *testing.T) {
+	if _, err := parseStatusFields("name,stauts"); err == nil || err.Error() != "unknown field 'stauts' in 'fields'" {
+		t.Errorf("parseStatusFields: err = %v", err)
+	}
+	if _, err := parseStatusSort("status,-nmae"); err == nil || err.Error() != "unknown field '-nmae' in 'sort'" {
+		t.Errorf("parseStatusSort: err = %v", err)
+	}
+	for _, c := range []struct{ filter, want string }{
+		{"status", "invalid filter 'status' (expected key=value or key!=value)"},
+		{"host=web01", "unknown filter key 'host' (must be status, type or tag)"},
+	} {
+		if _, err := parseStatusFilters([]string{c.filter}); err == nil || err.Error() != c.want {
+			t.Errorf("parseStatusFilters(%q): err = %v, want %q", c.filter, err, c.want)
+		}
+	}
+
+	// 誤った指定は死活確認の前に 400 で返す (DB を初期化していなくても 503 にならない)
+	for _, query := range []string{"format=xml", "fields=bogus", "format=text&fields=name", "sort=bogus", "filter=bogus"} {
+		rec := httptest.NewRecorder()
+		StatusHandler(rec, httptest.NewRequest("GET", "/api/v1/status?"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestStatusSortAndFilter(t *testing.T) {
+	statuses := sampleStatuses()
+	names := func(list []service.TargetStatus) string {
+		var n []string
+		for _, s := range list {
+			n = append(n, s.Name)
+		}
+		return strings.Join(n, ",")
+	}
+
+	for _, c := range []struct{ sort, want string }{
+		{"status", "build-server-01,db,web01"},
+		{"-status", "web01,db,build-server-01"},
+		{"-since", "build-server-01,web01,db"},
+		{"type,name", "db,web01,build-server-01"},
+	} {
+		compare, err := parseStatusSort(c.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sorted := slices.Clone(statuses)
+		slices.SortStableFunc(sorted, compare)
+		if got := names(sorted); got != c.want {
+			t.Errorf("sort=%s: %s, want %s", c.sort, got, c.want)
+		}
+	}
+
+	for _, c := range []struct {
+		filters []string
+		want    string
+	}{
+		{[]string{"status=running|unreachable"}, "web01,build-server-01"},
+		{[]string{"status=DEGRADED"}, "db"},
+		{[]string{"type!=container"}, "web01,build-server-01"},
+		{[]string{"tag=web"}, "web01"},
+		{[]string{"type!=container", "status!=Running"}, "build-server-01"},
+		{[]string{"type=host,tag=db"}, ""},
+	} {
+		filters, err := parseStatusFilters(c.filters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var matched []service.TargetStatus
+		for _, s := range statuses {
+			ok := true
+			for _, f := range filters {
+				ok = ok && f.match(s)
+			}
+			if ok {
+				matched = append(matched, s)
+			}
+		}
+		if got := names(matched); got != c.want {
+			t.Errorf("filter=%v: %s, want %s", c.filters, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"srv_mng/service"
+	"srv_mng/utils"
+)
+
+// TargetsHandler は /targets を処理するハンドラです。
+// 登録済みのターゲット設定を名前順に返します。パスワードなどの秘密情報は空にします。
+// ?selector= (例: "web,env=prod") でタグによる絞り込みができます。
+func TargetsHandler(w http.ResponseWriter, r *http.Request) {
+	targets, err := service.ListMonitorTargets()
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{})
+		return
+	}
+
+	selector := r.URL.Query().Get("selector")
+	result := []service.MonitorTarget{}
+	for _, t := range targets {
+		if service.MatchSelector(t.Tags, selector) {
+			result = append(result, t.Redacted())
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("[ERROR] Error encoding targets response: %v", err)
+	}
+}
+
+// GetTargetHandler は GET /targets/{name} を処理するハンドラです。パスワードなどの秘密情報は空にして返します。
+func GetTargetHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	config, err := service.GetTargetConfig(name)
+	if err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{Target: name})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(config.Redacted()); err != nil {
+		log.Printf("[ERROR] Error encoding target response: %v", err)
+	}
+}
+
+// UpdateTargetHandler は PATCH /targets/{name} を処理するハンドラです。リクエストで指定した項目のみを更新します。
+func UpdateTargetHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	patch, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Target: name, Message: fmt.Sprintf("Failed to read request body: %v", err)})
+		return
+	}
+	if !json.Valid(patch) {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.CodeBadRequest, utils.JSONResponse{Target: name, Message: "Invalid JSON format in request body"})
+		return
+	}
+	if _, err := service.UpdateMonitorTarget(name, patch); err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{Status: "failure", Target: name, Message: fmt.Sprintf("Failed to update target configuration: %v", err)})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.JSONResponse{Status: "success", Target: name, Message: fmt.Sprintf("Target '%s' configuration successfully updated.", name)})
+}
+
+// DeleteTargetHandler は DELETE /targets/{name} を処理するハンドラです。
+func DeleteTargetHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := service.DeleteMonitorTarget(name); err != nil {
+		writeServiceError(w, r, err, utils.JSONResponse{Status: "failure", Target: name, Message: fmt.Sprintf("Failed to delete target: %v", err)})
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, utils.JSONResponse{Status: "success", Target: name, Message: fmt.Sprintf("Target '%s' successfully deleted.", name)})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiError は、マネージャがエラー応答を返したことを表します。
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// connectError は、マネージャに接続できなかったことを表します。
+type connectError struct {
+	server string
+	err    error
+}
+
+func (e *connectError) Error() string {
+	return fmt.Sprintf("cannot connect to %s: %v", e.server, e.err)
+}
+
+func (e *connectError) Unwrap() error { return e.err }
+
+// apiClient は、マネージャの API を呼び出すクライアントです。
+type apiClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newAPIClient(server, token string) *apiClient {
+	return &apiClient{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		// 電源操作は BMC や SSH の応答を待つため長めにする
+		http: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// apiPrefix は、マネージャのバージョン付き API のパスの接頭辞です。
+const apiPrefix = "/api/v1"
+
+// newRequest は、トークンを付けたリクエストを作成します。path は apiPrefix からの相対パスです。
+func (c *apiClient) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.server+apiPrefix+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do は API を呼び出し、応答の JSON を out にデコードします。2xx 以外は apiError を返します。
+func (c *apiClient) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := c.newRequest(context.Background(), method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return &connectError{server: c.server, err: err}
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &apiError{StatusCode: resp.StatusCode, Message: errorMessage(raw)}
+	}
+	if out != nil {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return fmt.Errorf("failed to decode response from %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// errorMessage は、エラー応答の本文から表示するメッセージを取り出します。
+func errorMessage(raw []byte) string {
+	var body struct {
+		Message string `json:"message"`
+		Error   struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(raw, &body) == nil {
+		if body.Message != "" {
+			return body.Message
+		}
+		if body.Error.Message != "" {
+			return body.Error.Message
+		}
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// streamEvents は /events を購読し、イベントを受け取るたびに onEvent を呼び出します。
+// 切断された場合は Last-Event-ID を付けて再接続し、ctx が終了するまで戻りません。
+func (c *apiClient) streamEvents(ctx context.Context, onEvent func(eventType string, data []byte)) error {
+	lastID := ""
+	for {
+		err := c.readEvents(ctx, &lastID, onEvent)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if ae, ok := err.(*apiError); ok {
+			return ae
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(3 * time.Second):
+		}
+	}
+}
+
+// readEvents は、1回の接続でイベントを読み取ります。
+func (c *apiClient) readEvents(ctx context.Context, lastID *string, onEvent func(string, []byte)) error {
+	req, err := c.newRequest(ctx, http.MethodGet, "/events", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+
+	// ストリームは長時間続くため、タイムアウトのないクライアントを使う
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return &connectError{server: c.server, err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		return &apiError{StatusCode: resp.StatusCode, Message: errorMessage(raw)}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var eventType string
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data.Len() > 0 {
+				onEvent(eventType, data.Bytes())
+			}
+			eventType = ""
+			data.Reset()
+		case strings.HasPrefix(line, ":"):
+			// コメント (ハートビート)
+		case strings.HasPrefix(line, "id:"):
+			*lastID = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	return scanner.Err()
+}
+
+// selectorQuery は、セレクタを指定した場合にクエリ文字列を返します。
+func selectorQuery(selector string) string {
+	if selector == "" {
+		return ""
+	}
+	return "?selector=" + url.QueryEscape(selector)
+}
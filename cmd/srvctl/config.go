@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultServer は、設定がない場合に接続するマネージャの URL です。
+const defaultServer = "http://localhost:5001"
+
+// cliConfig は、~/.config/srvctl/config.yaml に保存する設定です。
+type cliConfig struct {
+	Server string `yaml:"server"`
+	Token  string `yaml:"token,omitempty"`
+}
+
+// configPath は、設定ファイルのパスを返します。環境変数 SRVCTL_CONFIG で変更できます。
+func configPath() (string, error) {
+	if path := os.Getenv("SRVCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine config directory: %v", err)
+	}
+	return filepath.Join(dir, "srvctl", "config.yaml"), nil
+}
+
+// loadConfig は設定ファイルを読み込みます。ファイルがない場合は既定値を返します。
+func loadConfig() (*cliConfig, error) {
+	cfg := &cliConfig{Server: defaultServer}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %v", path, err)
+	}
+	if err := yaml.Unmarshal(raw, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	if cfg.Server == "" {
+		cfg.Server = defaultServer
+	}
+	return cfg, nil
+}
+
+// saveConfig は、トークンを含むため所有者のみ読み書きできる権限で設定ファイルを保存します。
+func saveConfig(cfg *cliConfig) (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %v", err)
+	}
+	raw, err := yaml.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		return "", fmt.Errorf("failed to write config %s: %v", path, err)
+	}
+	return path, nil
+}
+
+// cmdConfig は "srvctl config" を実行します。
+func cmdConfig(args []string) error {
+	if len(args) == 0 {
+		return usagef("config requires a subcommand: view, set-server, set-token")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "view":
+		path, _ := configPath()
+		masked := *cfg
+		if masked.Token != "" {
+			masked.Token = "********"
+		}
+		fmt.Printf("# %s\n", path)
+		return yaml.NewEncoder(os.Stdout).Encode(masked)
+	case "set-server":
+		if len(args) != 2 {
+			return usagef("usage: srvctl config set-server <url>")
+		}
+		cfg.Server = args[1]
+	case "set-token":
+		if len(args) != 2 {
+			return usagef("usage: srvctl config set-token <token>")
+		}
+		cfg.Token = args[1]
+	default:
+		return usagef("unknown config subcommand %q", args[0])
+	}
+
+	path, err := saveConfig(cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("saved %s\n", path)
+	return nil
+}
@@ -0,0 +1,224 @@
+// srvctl は、srv_mng マネージャの API を操作するコマンドラインクライアントです。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 終了コード。スクリプトから結果を判定できるよう、失敗の種類ごとに分けています。
+const (
+	exitOK           = 0 // 成功
+	exitFailure      = 1 // API がエラーを返した、または一部の操作が失敗した
+	exitUsage        = 2 // コマンドライン引数の誤り
+	exitUnreachable  = 3 // マネージャに接続できない
+	exitUnauthorized = 4 // トークンが未設定または不正
+	exitNotFound     = 5 // ターゲットが存在しない
+)
+
+const usage = `srvctl - srv_mng マネージャのコマンドラインクライアント
+
+使い方:
+  srvctl status [--watch] [-o table|json|yaml|wide] [-l selector]
+  srvctl tui [-l selector]
+  srvctl start|stop|reboot <target>... | -l selector [--delay N] [--message MSG] [--force]
+  srvctl target ls [-o table|json|yaml|wide] [-l selector]
+  srvctl target add <name> [-f file] [--type T] [--host-ip IP] [--port P] [--tag TAG]... [--set key=value]...
+  srvctl target edit <name> [-f file] [--host-ip IP] [--tag TAG]... [--set key=value]...
+  srvctl target rm <name>...
+  srvctl config view | set-server <url> | set-token <token>
+
+共通オプション:
+  --server URL   マネージャの URL (環境変数 SRVCTL_SERVER、設定ファイルより優先)
+  --token TOKEN  API トークン (環境変数 SRVCTL_TOKEN、設定ファイルより優先)
+
+終了コード:
+  0 成功 / 1 操作の失敗 / 2 引数の誤り / 3 接続できない / 4 認証エラー / 5 ターゲットが存在しない
+`
+
+// usageError は、コマンドライン引数の誤りです。
+type usageError struct{ msg string }
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...interface{}) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// errPartialFailure は、複数ターゲットへの操作のうち一部が失敗したことを表します。個別のエラーは出力済みです。
+var errPartialFailure = errors.New("one or more operations failed")
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run はサブコマンドを実行し、終了コードを返します。
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Print(usage)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	var err error
+	switch args[0] {
+	case "status":
+		err = cmdStatus(args[1:])
+	case "tui":
+		err = cmdTUI(args[1:])
+	case "start", "stop", "reboot":
+		err = cmdPower(args[0], args[1:])
+	case "target":
+		err = cmdTarget(args[1:])
+	case "config":
+		err = cmdConfig(args[1:])
+	default:
+		err = usagef("unknown command %q", args[0])
+	}
+	return exitCode(err)
+}
+
+// exitCode は、エラーの種類を終了コードに変換し、必要に応じてエラーを表示します。
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if errors.Is(err, errPartialFailure) {
+		return exitFailure
+	}
+
+	if !isSilent(err) {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	var ue *usageError
+	var ae *apiError
+	var ce *connectError
+	switch {
+	case errors.As(err, &ue):
+		fmt.Fprintln(os.Stderr, "詳しくは 'srvctl help' を参照してください。")
+		return exitUsage
+	case errors.As(err, &ce):
+		return exitUnreachable
+	case errors.As(err, &ae):
+		switch ae.StatusCode {
+		case 401, 403:
+			return exitUnauthorized
+		case 404:
+			return exitNotFound
+		}
+	}
+	return exitFailure
+}
+
+// globalFlags は、すべてのサブコマンドで使える接続先のオプションです。
+type globalFlags struct {
+	server string
+	token  string
+}
+
+func (g *globalFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&g.server, "server", "", "マネージャの URL")
+	fs.StringVar(&g.token, "token", "", "API トークン")
+}
+
+// client は、設定ファイル・環境変数・オプションの順に接続先を決定してクライアントを作成します。
+func (g *globalFlags) client() (*apiClient, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if v := os.Getenv("SRVCTL_SERVER"); v != "" {
+		cfg.Server = v
+	}
+	if v := os.Getenv("SRVCTL_TOKEN"); v != "" {
+		cfg.Token = v
+	}
+	if g.server != "" {
+		cfg.Server = g.server
+	}
+	if g.token != "" {
+		cfg.Token = g.token
+	}
+	return newAPIClient(cfg.Server, cfg.Token), nil
+}
+
+// newFlagSet は、エラー時に終了せずエラーを返す FlagSet を作成します。
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("srvctl "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "使い方: srvctl %s のオプション:\n", name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs は、位置引数とオプションが混在していても (例: "start web01 --delay 5") すべてのオプションを解析し、
+// 位置引数を返します。"--" 以降の引数は、"-" で始まっていても位置引数として扱います。
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	// fs.Parse は "--" を読み捨てるため、解析の前に "--" 以降を分けておく
+	var rest []string
+	if i := argsTerminator(fs, args); i >= 0 {
+		args, rest = args[:i], args[i+1:]
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, &usageError{msg: err.Error()}
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// argsTerminator は、オプションの値ではない最初の "--" の位置を返します (ない場合は -1)。
+// "--message --" のように値として指定した "--" は区切りとして扱いません。
+func argsTerminator(fs *flag.FlagSet, args []string) int {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return i
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+		name := strings.TrimPrefix(arg[1:], "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		f := fs.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			continue
+		}
+		i++ // 次の引数はオプションの値
+	}
+	return -1
+}
+
+// stringList は、繰り返し指定できる文字列オプションです。
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
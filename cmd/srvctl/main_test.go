@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, exitOK},
+		{"help", fmt.Errorf("parse: %w", flag.ErrHelp), exitOK},
+		{"partial failure", errPartialFailure, exitFailure},
+		{"usage", usagef("unknown command %q", "bogus"), exitUsage},
+		{"unreachable", &connectError{server: "http://localhost:5001", err: errors.New("connection refused")}, exitUnreachable},
+		{"unauthorized", &apiError{StatusCode: 401, Message: "missing token"}, exitUnauthorized},
+		{"forbidden", &apiError{StatusCode: 403, Message: "forbidden"}, exitUnauthorized},
+		{"not found", &apiError{StatusCode: 404, Message: "target 'web01' not found"}, exitNotFound},
+		{"wrapped not found", fmt.Errorf("web01: %w", &apiError{StatusCode: 404}), exitNotFound},
+		{"silent not found", silentError{&apiError{StatusCode: 404}}, exitNotFound},
+		{"conflict", &apiError{StatusCode: 409, Message: "already in progress"}, exitFailure},
+		{"server error", &apiError{StatusCode: 500}, exitFailure},
+		{"other", errors.New("failed to read config"), exitFailure},
+	} {
+		if got := exitCode(c.err); got != c.want {
+			t.Errorf("%s: exitCode = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	for _, c := range []struct {
+		args       []string
+		positional []string
+		delay      int
+		message    string
+		force      bool
+	}{
+		{[]string{"web01", "web02"}, []string{"web01", "web02"}, 0, "", false},
+		{[]string{"web01", "--delay", "5", "web02", "--force"}, []string{"web01", "web02"}, 5, "", true},
+		{[]string{"--force", "web01", "--message=bye", "web02"}, []string{"web01", "web02"}, 0, "bye", true},
+		{[]string{"web01", "--", "--force", "-x"}, []string{"web01", "--force", "-x"}, 0, "", false},
+		{[]string{"--delay", "5", "--", "web01"}, []string{"web01"}, 5, "", false},
+		{[]string{"--force", "--", "web01"}, []string{"web01"}, 0, "", true},
+		// 値として指定した "--" は区切りではない
+		{[]string{"--message", "--", "web01", "--force"}, []string{"web01"}, 0, "--", true},
+		{[]string{"web01", "--"}, []string{"web01"}, 0, "", false},
+	} {
+		fs := newFlagSet("start")
+		delay := fs.Int("delay", 0, "")
+		message := fs.String("message", "", "")
+		force := fs.Bool("force", false, "")
+		positional, err := parseArgs(fs, c.args)
+		if err != nil {
+			t.Errorf("%q: %v", c.args, err)
+			continue
+		}
+		if !slices.Equal(positional, c.positional) || *delay != c.delay || *message != c.message || *force != c.force {
+			t.Errorf("%q: positional %q, delay %d, message %q, force %t, want %q, %d, %q, %t",
+				c.args, positional, *delay, *message, *force, c.positional, c.delay, c.message, c.force)
+		}
+	}
+
+	for _, args := range [][]string{{"web01", "--bogus"}, {"web01", "--delay", "soon"}, {"web01", "--delay"}} {
+		fs := newFlagSet("start")
+		fs.SetOutput(io.Discard)
+		fs.Int("delay", 0, "")
+		var ue *usageError
+		if _, err := parseArgs(fs, args); !errors.As(err, &ue) {
+			t.Errorf("%q: err = %v, want a usage error", args, err)
+		}
+	}
+}
+
+func TestClientConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("SRVCTL_CONFIG", path)
+	t.Setenv("SRVCTL_SERVER", "")
+	t.Setenv("SRVCTL_TOKEN", "")
+
+	check := func(name string, g globalFlags, server, token string) {
+		t.Helper()
+		client, err := g.client()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if client.server != server || client.token != token {
+			t.Errorf("%s: server %q, token %q, want %q, %q", name, client.server, client.token, server, token)
+		}
+	}
+
+	// 設定ファイルがない場合は既定値
+	check("default", globalFlags{}, defaultServer, "")
+
+	if err := os.WriteFile(path, []byte("server: http://file:5001/\ntoken: file-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	check("config file", globalFlags{}, "http://file:5001", "file-token")
+
+	// 環境変数は設定ファイルより、オプションは環境変数より優先する (項目ごとに判定する)
+	t.Setenv("SRVCTL_SERVER", "http://env:5001")
+	check("environment", globalFlags{}, "http://env:5001", "file-token")
+	t.Setenv("SRVCTL_TOKEN", "env-token")
+	check("environment", globalFlags{}, "http://env:5001", "env-token")
+	check("flags", globalFlags{token: "flag-token"}, "http://env:5001", "flag-token")
+	check("flags", globalFlags{server: "http://flag:5001", token: "flag-token"}, "http://flag:5001", "flag-token")
+
+	if err := os.WriteFile(path, []byte("server: [\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&globalFlags{}).client(); err == nil {
+		t.Error("invalid config file was accepted")
+	}
+}
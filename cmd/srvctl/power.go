@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// powerRequest は /power/<action> のリクエストです。
+type powerRequest struct {
+	Target  string `json:"target"`
+	Delay   int    `json:"delay,omitempty"`
+	Message string `json:"message,omitempty"`
+	Force   bool   `json:"force,omitempty"`
+}
+
+// powerResponse は /power/<action> の応答です。
+type powerResponse struct {
+	Status       string `json:"status"`
+	Message      string `json:"message"`
+	ScriptOutput string `json:"script_output"`
+}
+
+// cmdPower は "srvctl start|stop|reboot" を実行します。
+// 複数のターゲットを指定した場合は順に実行し、1つでも失敗すれば終了コード1を返します。
+func cmdPower(action string, args []string) error {
+	var g globalFlags
+	fs := newFlagSet(action)
+	g.register(fs)
+	selector := fs.String("l", "", "タグのセレクタに一致するすべてのターゲットを対象にする (例: web,env=prod)")
+	delay := fs.Int("delay", 0, "シャットダウンまでの猶予 (分, stop のみ)")
+	message := fs.String("message", "", "ログイン中のユーザーへ送るメッセージ (stop のみ)")
+	force := fs.Bool("force", false, "強制的に停止・再起動する (対応するドライバのみ)")
+
+	targets, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if (len(targets) == 0) == (*selector == "") {
+		return usagef("%s requires either target names or -l selector", action)
+	}
+	if *delay < 0 {
+		return usagef("--delay must be 0 or greater")
+	}
+	client, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	if *selector != "" {
+		statuses, err := fetchStatuses(client, *selector)
+		if err != nil {
+			return err
+		}
+		if len(statuses) == 0 {
+			return &apiError{StatusCode: 404, Message: fmt.Sprintf("no targets match selector %q", *selector)}
+		}
+		for _, s := range statuses {
+			targets = append(targets, s.Name)
+		}
+	}
+
+	var lastErr error
+	failed := 0
+	for _, target := range targets {
+		req := powerRequest{Target: target, Delay: *delay, Message: *message, Force: *force}
+		var resp powerResponse
+		if err := client.do("POST", "/power/"+action, req, &resp); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s failed: %v\n", target, action, err)
+			lastErr = err
+			failed++
+			continue
+		}
+		detail := resp.ScriptOutput
+		if detail == "" {
+			detail = resp.Message
+		}
+		fmt.Printf("%s: %s accepted: %s\n", target, action, detail)
+	}
+
+	if failed == 0 {
+		return nil
+	}
+	if len(targets) == 1 {
+		// 単一ターゲットの場合はエラーの種類に応じた終了コードを返す (エラーは表示済み)
+		return silentError{lastErr}
+	}
+	return errPartialFailure
+}
+
+// silentError は、表示済みのエラーを終了コードの判定のためだけに返すラッパーです。
+type silentError struct{ err error }
+
+func (e silentError) Error() string { return e.err.Error() }
+func (e silentError) Unwrap() error { return e.err }
+
+// isSilent は、エラーが表示済みかを返します。
+func isSilent(err error) bool {
+	var se silentError
+	return errors.As(err, &se)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// targetStatus は /status の1件分です。
+type targetStatus struct {
+	Type     string        `json:"type" yaml:"type"`
+	Name     string        `json:"name" yaml:"name"`
+	HostPort string        `json:"host_port" yaml:"host_port"`
+	Status   string        `json:"status" yaml:"status"`
+	Flapping bool          `json:"flapping,omitempty" yaml:"flapping,omitempty"`
+	Since    time.Time     `json:"since,omitzero" yaml:"since,omitempty"`
+	Checks   []checkResult `json:"checks,omitempty" yaml:"checks,omitempty"`
+	Tags     []string      `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// checkResult は、追加のヘルスチェックの結果です。
+type checkResult struct {
+	Name    string `json:"name" yaml:"name"`
+	Type    string `json:"type" yaml:"type"`
+	OK      bool   `json:"ok" yaml:"ok"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// outputFormats は -o で指定できる出力形式です。
+var outputFormats = []string{"table", "wide", "json", "yaml"}
+
+func validateOutput(format string) error {
+	for _, f := range outputFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return usagef("invalid output format %q (must be one of: %s)", format, strings.Join(outputFormats, ", "))
+}
+
+// cmdStatus は "srvctl status" を実行します。
+func cmdStatus(args []string) error {
+	var g globalFlags
+	fs := newFlagSet("status")
+	g.register(fs)
+	output := fs.String("o", "table", "出力形式 (table, wide, json, yaml)")
+	selector := fs.String("l", "", "タグのセレクタ (例: web,env=prod)")
+	watch := fs.Bool("watch", false, "状態の変化を待ち受けて表示を更新する")
+	fs.BoolVar(watch, "w", false, "--watch の短縮形")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("status takes no arguments")
+	}
+	if err := validateOutput(*output); err != nil {
+		return err
+	}
+	client, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	if !*watch {
+		statuses, err := fetchStatuses(client, *selector)
+		if err != nil {
+			return err
+		}
+		return printStatuses(os.Stdout, statuses, *output)
+	}
+	return watchStatuses(client, *selector, *output)
+}
+
+// fetchStatuses は /status を取得します。
+func fetchStatuses(client *apiClient, selector string) ([]targetStatus, error) {
+	var statuses []targetStatus
+	if err := client.do("GET", "/status"+selectorQuery(selector), nil, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// watchStatuses は /events を購読し、イベントを受け取るたびにステータスを再表示します。Ctrl-C で終了します。
+func watchStatuses(client *apiClient, selector, output string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	redraw := func() {
+		statuses, err := fetchStatuses(client, selector)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return
+		}
+		if output == "table" || output == "wide" {
+			// 画面を消去して先頭から描画
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("srvctl status --watch: %s  %s  (Ctrl-C で終了)\n\n", client.server, time.Now().Format("2006-01-02 15:04:05"))
+		} else if output == "yaml" {
+			fmt.Println("---")
+		}
+		printStatuses(os.Stdout, statuses, output)
+	}
+
+	redraw()
+	return client.streamEvents(ctx, func(eventType string, _ []byte) {
+		if eventType == "status" || eventType == "snapshot" {
+			redraw()
+		}
+	})
+}
+
+// printStatuses は、指定した形式でステータスを出力します。
+func printStatuses(w io.Writer, statuses []targetStatus, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	case "yaml":
+		return yaml.NewEncoder(w).Encode(statuses)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if format == "wide" {
+		fmt.Fprintln(tw, "NAME\tTYPE\tHOST:PORT\tSTATUS\tSINCE\tCHECKS\tTAGS")
+	} else {
+		fmt.Fprintln(tw, "NAME\tTYPE\tHOST:PORT\tSTATUS")
+	}
+	for _, s := range statuses {
+		status := s.Status
+		if s.Flapping {
+			status += " (flapping)"
+		}
+		if format == "wide" {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Type, s.HostPort, status, formatSince(s.Since), formatChecks(s.Checks), strings.Join(s.Tags, ","))
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.Type, s.HostPort, status)
+		}
+	}
+	return tw.Flush()
+}
+
+// formatSince は、状態の開始からの経過時間を "5m" のような短い形式で返します。
+func formatSince(since time.Time) string {
+	if since.IsZero() {
+		return "-"
+	}
+	d := time.Since(since)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
+// formatChecks は、ヘルスチェックの成功数を "2/3" の形式で返します。
+func formatChecks(checks []checkResult) string {
+	if len(checks) == 0 {
+		return "-"
+	}
+	ok := 0
+	for _, c := range checks {
+		if c.OK {
+			ok++
+		}
+	}
+	return fmt.Sprintf("%d/%d", ok, len(checks))
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cmdTarget は "srvctl target" を実行します。
+func cmdTarget(args []string) error {
+	if len(args) == 0 {
+		return usagef("target requires a subcommand: ls, add, edit, rm")
+	}
+	switch args[0] {
+	case "ls", "list":
+		return cmdTargetList(args[1:])
+	case "add":
+		return cmdTargetSave(args[1:], false)
+	case "edit":
+		return cmdTargetSave(args[1:], true)
+	case "rm", "delete":
+		return cmdTargetRemove(args[1:])
+	}
+	return usagef("unknown target subcommand %q", args[0])
+}
+
+// cmdTargetList は "srvctl target ls" を実行します。
+func cmdTargetList(args []string) error {
+	var g globalFlags
+	fs := newFlagSet("target ls")
+	g.register(fs)
+	output := fs.String("o", "table", "出力形式 (table, wide, json, yaml)")
+	selector := fs.String("l", "", "タグのセレクタ (例: web,env=prod)")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("target ls takes no arguments")
+	}
+	if err := validateOutput(*output); err != nil {
+		return err
+	}
+	client, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	// 項目の多いターゲット設定は、サーバの JSON をそのまま出力できるよう map で扱う
+	var targets []map[string]interface{}
+	if err := client.do("GET", "/targets"+selectorQuery(*selector), nil, &targets); err != nil {
+		return err
+	}
+	return printTargets(os.Stdout, targets, *output)
+}
+
+// printTargets は、指定した形式でターゲット設定を出力します。
+func printTargets(w io.Writer, targets []map[string]interface{}, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(targets)
+	case "yaml":
+		return yaml.NewEncoder(w).Encode(targets)
+	}
+
+	field := func(t map[string]interface{}, key string) string {
+		switch v := t[key].(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		case []interface{}:
+			parts := make([]string, 0, len(v))
+			for _, p := range v {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			return strings.Join(parts, ",")
+		default:
+			return fmt.Sprint(v)
+		}
+	}
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if format == "wide" {
+		fmt.Fprintln(tw, "NAME\tTYPE\tHOST:PORT\tDRIVER\tMAC\tBROADCAST\tSSH_USER\tMAINTENANCE\tTAGS")
+	} else {
+		fmt.Fprintln(tw, "NAME\tTYPE\tHOST:PORT\tDRIVER\tTAGS")
+	}
+	for _, t := range targets {
+		hostPort := field(t, "host_ip") + ":" + field(t, "port")
+		if format == "wide" {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				field(t, "name"), field(t, "type"), hostPort, orDash(field(t, "power_driver")),
+				orDash(field(t, "mac_address")), orDash(field(t, "broadcast_ip")), orDash(field(t, "ssh_user")),
+				field(t, "maintenance"), orDash(field(t, "tags")))
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				field(t, "name"), field(t, "type"), hostPort, orDash(field(t, "power_driver")), orDash(field(t, "tags")))
+		}
+	}
+	return tw.Flush()
+}
+
+// targetFlags は、target add/edit で指定できる項目です。
+// よく使う項目は専用のオプションで、それ以外は --set key=value で指定します。
+type targetFlags struct {
+	file    string
+	fields  map[string]*string
+	tags    stringList
+	setArgs stringList
+}
+
+// targetFieldFlags は、専用のオプションと API の項目名の対応です。
+var targetFieldFlags = []struct{ flag, field, help string }{
+	{"type", "type", "種別 (host, container, vm)"},
+	{"host-ip", "host_ip", "IP アドレスまたはホスト名"},
+	{"port", "port", "死活監視ポート (power_agent のポート)"},
+	{"mac", "mac_address", "MAC アドレス (WOL 用)"},
+	{"broadcast", "broadcast_ip", "ブロードキャストアドレス (WOL 用)"},
+	{"ssh-user", "ssh_user", "SSH ユーザー"},
+	{"ssh-pass", "ssh_pass", "SSH/sudo パスワード"},
+	{"ssh-port", "ssh_port", "SSH ポート"},
+	{"driver", "power_driver", "電源ドライバ"},
+}
+
+func (f *targetFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.file, "f", "", "ターゲット設定のファイル (JSON または YAML)。オプションで指定した項目はファイルより優先")
+	f.fields = map[string]*string{}
+	for _, tf := range targetFieldFlags {
+		f.fields[tf.field] = fs.String(tf.flag, "", tf.help)
+	}
+	fs.Var(&f.tags, "tag", "タグ (繰り返し指定可。edit では既存のタグを置き換える)")
+	fs.Var(&f.setArgs, "set", "任意の項目を key=value で指定 (繰り返し指定可。値が JSON の配列・オブジェクト・真偽値の場合はそのまま解釈)")
+}
+
+// body は、ファイルとオプションから API に送る項目を組み立てます。指定のない項目は含めません。
+func (f *targetFlags) body(fs *flag.FlagSet) (map[string]interface{}, error) {
+	body := map[string]interface{}{}
+	if f.file != "" {
+		raw, err := os.ReadFile(f.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", f.file, err)
+		}
+		if ext := strings.ToLower(filepath.Ext(f.file)); ext == ".json" {
+			err = json.Unmarshal(raw, &body)
+		} else {
+			err = yaml.Unmarshal(raw, &body)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", f.file, err)
+		}
+	}
+
+	// 明示的に指定されたオプションのみ反映する (空文字での上書きも可能にするため)
+	fs.Visit(func(fl *flag.Flag) {
+		for _, tf := range targetFieldFlags {
+			if fl.Name == tf.flag {
+				body[tf.field] = *f.fields[tf.field]
+			}
+		}
+	})
+	if len(f.tags) > 0 {
+		body["tags"] = []string(f.tags)
+	}
+	for _, kv := range f.setArgs {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return nil, usagef("--set requires key=value, got %q", kv)
+		}
+		body[key] = parseSetValue(value)
+	}
+	return body, nil
+}
+
+// parseSetValue は、--set の値を解釈します。
+// port のように数字でも文字列として扱う項目があるため、数値は JSON として解釈しません。
+func parseSetValue(value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "true" || trimmed == "false" || strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var v interface{}
+		if err := json.Unmarshal([]byte(trimmed), &v); err == nil {
+			return v
+		}
+	}
+	return value
+}
+
+// cmdTargetSave は "srvctl target add" と "srvctl target edit" を実行します。
+// add は /targets/register で登録 (既存の場合は置き換え)、edit は PATCH /targets/<name> で指定した項目のみ更新します。
+func cmdTargetSave(args []string, edit bool) error {
+	name := "target add"
+	if edit {
+		name = "target edit"
+	}
+	var g globalFlags
+	var tf targetFlags
+	fs := newFlagSet(name)
+	g.register(fs)
+	tf.register(fs)
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	body, err := tf.body(fs)
+	if err != nil {
+		return err
+	}
+
+	var targetName string
+	switch {
+	case len(positional) == 1:
+		targetName = positional[0]
+	case len(positional) == 0 && !edit && body["name"] != nil:
+		targetName = fmt.Sprint(body["name"])
+	default:
+		return usagef("usage: srvctl %s <name> [options]", name)
+	}
+	if edit && len(body) == 0 {
+		return usagef("target edit requires at least one field to change")
+	}
+	body["name"] = targetName
+
+	client, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Message string `json:"message"`
+	}
+	if edit {
+		err = client.do("PATCH", "/targets/"+url.PathEscape(targetName), body, &resp)
+	} else {
+		err = client.do("POST", "/targets/register", body, &resp)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(resp.Message)
+	return nil
+}
+
+// cmdTargetRemove は "srvctl target rm" を実行します。
+func cmdTargetRemove(args []string) error {
+	var g globalFlags
+	fs := newFlagSet("target rm")
+	g.register(fs)
+
+	names, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return usagef("usage: srvctl target rm <name>...")
+	}
+	client, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	failed := 0
+	for _, n := range names {
+		if err := client.do("DELETE", "/targets/"+url.PathEscape(n), nil, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: delete failed: %v\n", n, err)
+			lastErr = err
+			failed++
+			continue
+		}
+		fmt.Printf("%s: deleted\n", n)
+	}
+	switch {
+	case failed == 0:
+		return nil
+	case len(names) == 1:
+		return silentError{lastErr}
+	}
+	return errPartialFailure
+}
@@ -0,0 +1,651 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI エスケープシーケンス
+const (
+	ansiReset   = "\033[0m"
+	ansiBold    = "\033[1m"
+	ansiDim     = "\033[2m"
+	ansiReverse = "\033[7m"
+	ansiFgReset = "\033[39m"
+	ansiRed     = "\033[31m"
+	ansiGreen   = "\033[32m"
+	ansiYellow  = "\033[33m"
+	ansiBlue    = "\033[34m"
+	ansiMagenta = "\033[35m"
+	ansiCyan    = "\033[36m"
+	ansiGray    = "\033[90m"
+)
+
+// statusColors は、状態ごとの表示色です。
+var statusColors = map[string]string{
+	"Running":      ansiGreen,
+	"Degraded":     ansiYellow,
+	"AgentDown":    ansiYellow,
+	"Unreachable":  ansiRed,
+	"PoweringOn":   ansiCyan,
+	"ShuttingDown": ansiCyan,
+	"Maintenance":  ansiBlue,
+	"Unknown":      ansiGray,
+}
+
+// statusSeverity は、状態で並べ替えるときの順序です。対応が必要な状態を先頭にします。
+var statusSeverity = map[string]int{
+	"Unreachable":  0,
+	"AgentDown":    1,
+	"Degraded":     2,
+	"Unknown":      3,
+	"ShuttingDown": 4,
+	"PoweringOn":   5,
+	"Maintenance":  6,
+	"Running":      7,
+}
+
+// tuiSortKeys は、o キーで切り替える並べ替えの項目です。
+var tuiSortKeys = []string{"name", "status", "type", "since"}
+
+// tuiMode は、キー入力の解釈を切り替える TUI のモードです。
+type tuiMode int
+
+const (
+	tuiModeNormal  tuiMode = iota // 一覧の操作
+	tuiModeFilter                 // フィルタの入力中
+	tuiModeConfirm                // 電源操作の確認中
+)
+
+// TUI のイベントループに送るメッセージ
+type (
+	tuiKeysMsg     []string
+	tuiStatusesMsg struct {
+		statuses []targetStatus
+		err      error
+	}
+	tuiActionMsg struct {
+		action, target, detail string
+		err                    error
+	}
+	tuiStreamMsg struct{ err error }
+)
+
+// tuiModel は TUI の表示状態です。イベントループのゴルーチンのみが更新します。
+type tuiModel struct {
+	client   *apiClient
+	selector string
+
+	statuses  []targetStatus
+	updatedAt time.Time
+
+	selected string // 選択中のターゲット名 (並べ替えや更新の後も同じターゲットを選択し続けるため)
+	offset   int    // 表示を開始する行
+	sortKey  int
+	reverse  bool
+	filter   string
+
+	mode          tuiMode
+	pendingAction string
+	pendingTarget string
+
+	message      string
+	messageColor string
+}
+
+// cmdTUI は "srvctl tui" を実行します。
+// ターミナル全体を使ってステータスを表示し、/events のイベントを受け取るたびに更新します。
+func cmdTUI(args []string) error {
+	var g globalFlags
+	fs := newFlagSet("tui")
+	g.register(fs)
+	selector := fs.String("l", "", "タグのセレクタ (例: web,env=prod)")
+
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return usagef("tui takes no arguments")
+	}
+	stdin, stdout := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(stdin) || !term.IsTerminal(stdout) {
+		return errors.New("tui requires an interactive terminal (use 'srvctl status --watch' instead)")
+	}
+	client, err := g.client()
+	if err != nil {
+		return err
+	}
+
+	// 接続できない・認証エラーの場合は、画面を切り替える前に終了コード付きで終了する
+	m := &tuiModel{client: client, selector: *selector, sortKey: 1}
+	statuses, err := m.fetch(false)
+	if err != nil {
+		return err
+	}
+	m.setStatuses(statuses)
+
+	oldState, err := term.MakeRaw(stdin)
+	if err != nil {
+		return fmt.Errorf("failed to set terminal to raw mode: %v", err)
+	}
+	defer term.Restore(stdin, oldState)
+	// 代替スクリーンに切り替え、カーソルを隠す
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	msgs := make(chan interface{}, 16)
+	send := func(msg interface{}) {
+		select {
+		case msgs <- msg:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			send(tuiKeysMsg(parseKeys(buf[:n])))
+		}
+	}()
+	go func() {
+		err := client.streamEvents(ctx, func(eventType string, _ []byte) {
+			if eventType == "status" || eventType == "snapshot" {
+				statuses, err := m.fetch(false)
+				send(tuiStatusesMsg{statuses, err})
+			}
+		})
+		send(tuiStreamMsg{err})
+	}()
+
+	// 経過時間の表示と端末サイズの変更を反映するため、1秒ごとに再描画する
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		m.draw()
+		select {
+		case <-ticker.C:
+		case msg := <-msgs:
+			switch msg := msg.(type) {
+			case tuiKeysMsg:
+				for _, key := range msg {
+					if quit := m.handleKey(key, send); quit {
+						return nil
+					}
+				}
+			case tuiStatusesMsg:
+				if msg.err != nil {
+					if isAuthError(msg.err) {
+						return msg.err
+					}
+					m.setMessage(ansiRed, "error: %v", msg.err)
+					continue
+				}
+				m.setStatuses(msg.statuses)
+			case tuiActionMsg:
+				if msg.err != nil {
+					m.setMessage(ansiRed, "%s: %s failed: %v", msg.target, msg.action, msg.err)
+				} else {
+					m.setMessage(ansiGreen, "%s: %s accepted: %s", msg.target, msg.action, msg.detail)
+				}
+			case tuiStreamMsg:
+				// streamEvents は再接続を繰り返すため、戻るのは認証エラーなどの回復できない場合のみ
+				if msg.err != nil {
+					return msg.err
+				}
+			}
+		}
+	}
+}
+
+// isAuthError は、トークンの誤りなど再試行しても回復しないエラーかを返します。
+func isAuthError(err error) bool {
+	var ae *apiError
+	return errors.As(err, &ae) && (ae.StatusCode == 401 || ae.StatusCode == 403)
+}
+
+// fetch は /status を取得します。refresh が true の場合はその場で死活確認を実行させます。
+func (m *tuiModel) fetch(refresh bool) ([]targetStatus, error) {
+	q := url.Values{}
+	if m.selector != "" {
+		q.Set("selector", m.selector)
+	}
+	if refresh {
+		q.Set("refresh", "true")
+	}
+	path := "/status"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var statuses []targetStatus
+	if err := m.client.do("GET", path, nil, &statuses); err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+func (m *tuiModel) setStatuses(statuses []targetStatus) {
+	m.statuses = statuses
+	m.updatedAt = time.Now()
+}
+
+func (m *tuiModel) setMessage(color, format string, args ...interface{}) {
+	m.messageColor = color
+	m.message = fmt.Sprintf(format, args...)
+}
+
+// visible は、フィルタと並べ替えを適用したステータスを返します。
+func (m *tuiModel) visible() []targetStatus {
+	filter := strings.ToLower(m.filter)
+	list := make([]targetStatus, 0, len(m.statuses))
+	for _, s := range m.statuses {
+		if filter == "" || strings.Contains(strings.ToLower(strings.Join([]string{s.Name, s.Type, s.HostPort, s.Status, strings.Join(s.Tags, ",")}, " ")), filter) {
+			list = append(list, s)
+		}
+	}
+
+	key := tuiSortKeys[m.sortKey]
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if m.reverse {
+			a, b = b, a
+		}
+		switch key {
+		case "status":
+			if sa, sb := statusSeverity[a.Status], statusSeverity[b.Status]; sa != sb {
+				return sa < sb
+			}
+		case "type":
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+		case "since":
+			// 同じ状態が長く続いているものを先頭にする
+			if !a.Since.Equal(b.Since) {
+				return a.Since.Before(b.Since)
+			}
+		}
+		return a.Name < b.Name
+	})
+	return list
+}
+
+// cursor は、表示中の一覧での選択位置を返します。選択中のターゲットが見つからない場合は先頭を選択します。
+func (m *tuiModel) cursor(list []targetStatus) int {
+	for i, s := range list {
+		if s.Name == m.selected {
+			return i
+		}
+	}
+	if len(list) > 0 {
+		m.selected = list[0].Name
+	}
+	return 0
+}
+
+// move は、選択位置を delta 行移動します。
+func (m *tuiModel) move(delta int) {
+	list := m.visible()
+	if len(list) == 0 {
+		return
+	}
+	i := m.cursor(list) + delta
+	i = max(0, min(i, len(list)-1))
+	m.selected = list[i].Name
+}
+
+// handleKey は1つのキー入力を処理し、終了する場合は true を返します。
+func (m *tuiModel) handleKey(key string, send func(interface{})) bool {
+	if key == "ctrl-c" {
+		return true
+	}
+
+	switch m.mode {
+	case tuiModeFilter:
+		switch key {
+		case "enter":
+			m.mode = tuiModeNormal
+		case "esc":
+			m.filter = ""
+			m.mode = tuiModeNormal
+		case "backspace":
+			if _, size := utf8.DecodeLastRuneInString(m.filter); size > 0 {
+				m.filter = m.filter[:len(m.filter)-size]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				m.filter += key
+			}
+		}
+		return false
+
+	case tuiModeConfirm:
+		m.mode = tuiModeNormal
+		if key != "y" && key != "Y" {
+			m.setMessage("", "%s: %s をキャンセルしました", m.pendingTarget, m.pendingAction)
+			return false
+		}
+		action, target := m.pendingAction, m.pendingTarget
+		m.setMessage(ansiYellow, "%s: %s を実行中...", target, action)
+		go func() {
+			var resp powerResponse
+			err := m.client.do("POST", "/power/"+action, powerRequest{Target: target}, &resp)
+			detail := resp.ScriptOutput
+			if detail == "" {
+				detail = resp.Message
+			}
+			send(tuiActionMsg{action: action, target: target, detail: detail, err: err})
+		}()
+		return false
+	}
+
+	_, height := m.size()
+	page := max(1, height-6)
+	switch key {
+	case "q":
+		return true
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-page)
+	case "pgdn":
+		m.move(page)
+	case "home":
+		m.move(-len(m.statuses))
+	case "end":
+		m.move(len(m.statuses))
+	case "/":
+		m.mode = tuiModeFilter
+	case "esc":
+		m.filter = ""
+	case "o":
+		m.sortKey = (m.sortKey + 1) % len(tuiSortKeys)
+	case "O":
+		m.reverse = !m.reverse
+	case "g":
+		m.setMessage("", "死活確認を実行中...")
+		go func() {
+			statuses, err := m.fetch(true)
+			send(tuiStatusesMsg{statuses, err})
+		}()
+	case "u", "d", "r":
+		list := m.visible()
+		if len(list) == 0 {
+			return false
+		}
+		m.pendingAction = map[string]string{"u": "start", "d": "stop", "r": "reboot"}[key]
+		m.pendingTarget = list[m.cursor(list)].Name
+		m.mode = tuiModeConfirm
+	}
+	return false
+}
+
+// size は端末の幅と高さを返します。取得できない場合は 80x24 とします。
+func (m *tuiModel) size() (width, height int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// draw は画面全体を描画します。ちらつきを抑えるため、消去せずに各行を上書きします。
+func (m *tuiModel) draw() {
+	width, height := m.size()
+	list := m.visible()
+	cur := m.cursor(list)
+
+	var lines []string
+	header := fmt.Sprintf(" srvctl tui  %s  更新: %s", m.client.server, m.updatedAt.Format("15:04:05"))
+	if m.selector != "" {
+		header += "  selector: " + m.selector
+	}
+	lines = append(lines, ansiReverse+ansiBold+padRight(truncate(header, width), width)+ansiReset)
+
+	order := "昇順"
+	if m.reverse {
+		order = "降順"
+	}
+	info := fmt.Sprintf(" 表示 %d/%d  並べ替え: %s (%s)", len(list), len(m.statuses), tuiSortKeys[m.sortKey], order)
+	if m.filter != "" {
+		info += "  フィルタ: " + m.filter
+	}
+	lines = append(lines, truncate(info, width), "")
+
+	// 列の幅は表示中のすべての行に合わせる
+	titles := []string{"NAME", "TYPE", "HOST:PORT", "STATUS", "SINCE", "CHECKS", "TAGS"}
+	rows := make([][]string, len(list))
+	widths := make([]int, len(titles))
+	for i, t := range titles {
+		widths[i] = displayWidth(t)
+	}
+	for i, s := range list {
+		status := s.Status
+		if s.Flapping {
+			status += " (flapping)"
+		}
+		rows[i] = []string{s.Name, s.Type, s.HostPort, status, formatSince(s.Since), formatChecks(s.Checks), strings.Join(s.Tags, ",")}
+		for j, c := range rows[i] {
+			widths[j] = max(widths[j], displayWidth(c))
+		}
+	}
+	lines = append(lines, ansiBold+formatRow(titles, widths, width, nil)+ansiReset)
+
+	// 選択中の行が見えるように表示開始位置を調整する
+	bodyHeight := max(1, height-len(lines)-2)
+	if cur < m.offset {
+		m.offset = cur
+	}
+	if cur >= m.offset+bodyHeight {
+		m.offset = cur - bodyHeight + 1
+	}
+	m.offset = max(0, min(m.offset, len(list)-bodyHeight))
+
+	for i := m.offset; i < len(list) && i < m.offset+bodyHeight; i++ {
+		s := list[i]
+		color := statusColors[s.Status]
+		if color == "" {
+			color = ansiGray
+		}
+		colors := []string{"", "", "", color, "", "", ansiDim}
+		if s.Flapping {
+			colors[3] = ansiMagenta
+		}
+		row := formatRow(rows[i], widths, width, colors)
+		if i == cur {
+			// 行全体を反転表示する (色の終了は前景色のみ戻すため反転は維持される)
+			row = ansiReverse + row + strings.Repeat(" ", max(0, width-rowWidth(rows[i], widths, width))) + ansiReset
+		}
+		lines = append(lines, row)
+	}
+	if len(list) == 0 {
+		lines = append(lines, ansiDim+" 表示するターゲットがありません"+ansiReset)
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, m.messageColor+truncate(m.message, width)+ansiReset)
+	var prompt string
+	switch m.mode {
+	case tuiModeFilter:
+		prompt = ansiBold + truncate("フィルタ: "+m.filter+"_", width) + ansiReset
+	case tuiModeConfirm:
+		prompt = ansiBold + ansiYellow + truncate(fmt.Sprintf("%s を %s しますか? [y/N]", m.pendingTarget, m.pendingAction), width) + ansiReset
+	default:
+		prompt = ansiDim + truncate("↑↓/jk 選択  u 起動  d 停止  r 再起動  / フィルタ  o 並べ替え  O 逆順  g 再確認  q 終了", width) + ansiReset
+	}
+	lines = append(lines, prompt)
+	if len(lines) > height {
+		lines = lines[:height]
+	}
+
+	// raw モードでは改行でカーソルが行頭に戻らないため \r\n を使う
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString("\033[K")
+	}
+	b.WriteString("\033[J")
+	os.Stdout.WriteString(b.String())
+}
+
+// formatRow は、各列を幅に合わせて並べた1行を返します。幅を超える部分は切り詰めます。
+func formatRow(cells []string, widths []int, width int, colors []string) string {
+	var b strings.Builder
+	remain := width
+	for i, c := range cells {
+		if remain <= 0 {
+			break
+		}
+		text := c
+		if i < len(cells)-1 {
+			text = padRight(text, widths[i]+2)
+		}
+		text = truncate(text, remain)
+		remain -= displayWidth(text)
+		if colors != nil && colors[i] != "" {
+			b.WriteString(colors[i] + text + ansiFgReset + "\033[22m")
+		} else {
+			b.WriteString(text)
+		}
+	}
+	return b.String()
+}
+
+// rowWidth は、formatRow が出力する行の表示幅を返します。
+func rowWidth(cells []string, widths []int, width int) int {
+	total := 0
+	for i, c := range cells {
+		if i < len(cells)-1 {
+			total += max(displayWidth(c), widths[i]+2)
+		} else {
+			total += displayWidth(c)
+		}
+	}
+	return min(total, width)
+}
+
+// padRight は、表示幅が width になるまで空白を追加します。
+func padRight(s string, width int) string {
+	if w := displayWidth(s); w < width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	return s
+}
+
+// truncate は、表示幅が width を超えないように切り詰めます。
+func truncate(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	w := 0
+	for i, r := range s {
+		rw := runeWidth(r)
+		if w+rw > width {
+			return s[:i]
+		}
+		w += rw
+	}
+	return s
+}
+
+// displayWidth は、端末での表示幅を返します (全角文字は2として数える)。
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115F, // ハングル字母
+		r >= 0x2E80 && r <= 0xA4CF && r != 0x303F, // CJK、ひらがな、カタカナなど
+		r >= 0xAC00 && r <= 0xD7A3,                // ハングル
+		r >= 0xF900 && r <= 0xFAFF,                // CJK 互換漢字
+		r >= 0xFE30 && r <= 0xFE4F,                // CJK 互換形
+		r >= 0xFF00 && r <= 0xFF60,                // 全角英数・記号
+		r >= 0xFFE0 && r <= 0xFFE6:
+		return 2
+	}
+	return 1
+}
+
+// parseKeys は、端末から読み取ったバイト列をキーの名前 ("up", "enter", "a" など) に分解します。
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		switch {
+		case b[0] == 0x1b && len(b) >= 3 && (b[1] == '[' || b[1] == 'O'):
+			// CSI / SS3 シーケンス: ESC [ <引数> <終端文字>
+			i := 2
+			for i < len(b) && (b[i] < 0x40 || b[i] > 0x7e) {
+				i++
+			}
+			if i == len(b) {
+				return keys
+			}
+			switch string(b[2 : i+1]) {
+			case "A":
+				keys = append(keys, "up")
+			case "B":
+				keys = append(keys, "down")
+			case "5~":
+				keys = append(keys, "pgup")
+			case "6~":
+				keys = append(keys, "pgdn")
+			case "H", "1~", "7~":
+				keys = append(keys, "home")
+			case "F", "4~", "8~":
+				keys = append(keys, "end")
+			}
+			b = b[i+1:]
+		case b[0] == 0x1b:
+			keys = append(keys, "esc")
+			b = b[1:]
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, "enter")
+			b = b[1:]
+		case b[0] == 0x7f || b[0] == 0x08:
+			keys = append(keys, "backspace")
+			b = b[1:]
+		case b[0] == 0x03:
+			keys = append(keys, "ctrl-c")
+			b = b[1:]
+		case b[0] < 0x20:
+			// その他の制御文字は無視する
+			b = b[1:]
+		default:
+			r, size := utf8.DecodeRune(b)
+			if r != utf8.RuneError {
+				keys = append(keys, string(r))
+			}
+			b = b[size:]
+		}
+	}
+	return keys
+}
@@ -1,5 +1,14 @@
 module srv_mng
 
-go 1.25
+go 1.25.0
 
-require github.com/mattn/go-sqlite3 v1.14.22
+require (
+	github.com/godbus/dbus/v5 v5.1.0
+	github.com/mattn/go-sqlite3 v1.14.22
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.57.0
+	golang.org/x/term v0.45.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.47.0 // indirect
@@ -0,0 +1,34 @@
+// Package agentapi は、マネージャと power_agent の間で共有するプロトコルの定義です。
+package agentapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+)
+
+// マネージャは /capabilities の問い合わせに NonceHeader で乱数を付けて送り、
+// エージェントは共有トークンで計算した TokenProof(token, nonce) を ProofHeader で返します。
+// これにより、マネージャはパスワードを送る前に応答したエージェントが同じトークンを持つことを確認できます。
+const (
+	NonceHeader = "X-Agent-Nonce"
+	ProofHeader = "X-Agent-Proof"
+)
+
+// TokenProof は、共有トークンを鍵とした nonce の HMAC-SHA256 を16進文字列で返します。
+func TokenProof(token, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidProof は、proof が token と nonce から計算した値と一致するかを定数時間で比較します。
+func ValidProof(token, nonce, proof string) bool {
+	return nonce != "" && hmac.Equal([]byte(proof), []byte(TokenProof(token, nonce)))
+}
+
+// DomainNamePattern は、power_agent が virsh に渡す libvirt のドメイン名 (または UUID) として受け付ける形式です。
+// "-" で始まる名前は virsh のオプションとして解釈されるため受け付けません。
+// マネージャは vm_domain の検証に、エージェントは /vm/* のリクエストの検証に使用します。
+var DomainNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._+:-]{0,127}$`)
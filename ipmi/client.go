@@ -0,0 +1,266 @@
+package ipmi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultPort は IPMI over LAN (RMCP) の既定ポートです。
+const DefaultPort = "623"
+
+// retries は応答がない場合の再送回数です。
+const retries = 3
+
+// Client は 1 つの BMC との RMCP+ セッションです。
+type Client struct {
+	conn     net.Conn
+	timeout  time.Duration
+	username string
+	password string
+
+	consoleSID uint32
+	bmcSID     uint32
+	keys       *sessionKeys
+	seq        uint32
+	rqSeq      byte
+}
+
+// Dial は BMC に接続し、RMCP+ セッションを確立して管理者権限に昇格します。
+// addr はポートを省略した場合 623 を使用します。
+func Dial(addr string, username string, password string, timeout time.Duration) (*Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+	if len(username) > 16 {
+		return nil, fmt.Errorf("ipmi username must be 16 characters or less")
+	}
+	if len(password) > 20 {
+		return nil, fmt.Errorf("ipmi password must be 20 characters or less")
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial BMC: %v", err)
+	}
+
+	c := &Client{conn: conn, timeout: timeout, username: username, password: password}
+	if err := c.openSession(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := c.command(netFnApp, cmdSetSessionPrivilegeLevel, []byte{privilegeAdministrator}); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to set session privilege level: %v", err)
+	}
+	return c, nil
+}
+
+// Close はセッションを閉じて接続を解放します。
+func (c *Client) Close() error {
+	if c.keys != nil {
+		// 応答の有無にかかわらず接続は閉じる
+		c.command(netFnApp, cmdCloseSession, le32(c.bmcSID))
+		c.keys = nil
+	}
+	return c.conn.Close()
+}
+
+// ChassisStatus は、シャーシの電源が入っているかを返します。
+func (c *Client) ChassisStatus() (bool, error) {
+	data, err := c.command(netFnChassis, cmdGetChassisStatus, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(data) < 1 {
+		return false, fmt.Errorf("chassis status response too short")
+	}
+	// Current Power State の bit0 が電源オン
+	return data[0]&0x01 != 0, nil
+}
+
+// ChassisControl は、電源投入・断・サイクル・リセット・ソフトシャットダウンを実行します。
+func (c *Client) ChassisControl(control ChassisControl) error {
+	_, err := c.command(netFnChassis, cmdChassisControl, []byte{byte(control)})
+	return err
+}
+
+// openSession は、チャネル認証能力の確認、Open Session、RAKP 1〜4 を行いセッション鍵を確立します。
+func (c *Client) openSession() error {
+	// Get Channel Authentication Capabilities (セッションなし、IPMI v1.5 形式)
+	capsReq := encodeMessage(bmcSlaveAddress, netFnApp, remoteSoftwareID, 0, cmdGetChannelAuthCapabilities,
+		[]byte{0x8E, privilegeAdministrator}) // 0x80: IPMI v2.0 拡張データを要求, 0x0E: 現在のチャネル
+	resp, err := c.exchange(encodeV15(capsReq), payloadIPMI)
+	if err != nil {
+		return fmt.Errorf("get channel auth capabilities failed: %v", err)
+	}
+	msg, err := decodeMessage(resp.payload)
+	if err != nil {
+		return err
+	}
+	if len(msg.data) < 5 || msg.data[0] != completionOK {
+		return fmt.Errorf("get channel auth capabilities returned an error")
+	}
+	if msg.data[2]&0x80 == 0 || msg.data[4]&0x02 == 0 {
+		return fmt.Errorf("BMC does not support IPMI v2.0 (RMCP+)")
+	}
+
+	var buf [4]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return err
+	}
+	c.consoleSID = binary.LittleEndian.Uint32(buf[:]) | 1
+
+	// Open Session Request
+	open := []byte{0x00, privilegeAdministrator, 0, 0}
+	open = append(open, le32(c.consoleSID)...)
+	open = append(open, algorithmPayloads()...)
+	pkt, err := encodeV2(payloadOpenSessionRequest, 0, 0, open, nil)
+	if err != nil {
+		return err
+	}
+	resp, err = c.exchange(pkt, payloadOpenSessionResponse)
+	if err != nil {
+		return fmt.Errorf("open session failed: %v", err)
+	}
+	if len(resp.payload) < 12 || resp.payload[1] != 0 {
+		return fmt.Errorf("open session rejected by BMC (status 0x%02x)", statusOf(resp.payload))
+	}
+	if binary.LittleEndian.Uint32(resp.payload[4:8]) != c.consoleSID {
+		return fmt.Errorf("open session response for another session")
+	}
+	c.bmcSID = binary.LittleEndian.Uint32(resp.payload[8:12])
+
+	// RAKP Message 1
+	params := &rakpParams{
+		consoleSID:  c.consoleSID,
+		bmcSID:      c.bmcSID,
+		consoleRand: make([]byte, 16),
+		role:        privilegeAdministrator | rakpNameOnlyLookup,
+		username:    c.username,
+	}
+	if _, err := rand.Read(params.consoleRand); err != nil {
+		return err
+	}
+	rakp1 := []byte{0x00, 0, 0, 0}
+	rakp1 = append(rakp1, le32(c.bmcSID)...)
+	rakp1 = append(rakp1, params.consoleRand...)
+	rakp1 = append(rakp1, params.role, 0, 0, byte(len(c.username)))
+	rakp1 = append(rakp1, c.username...)
+	pkt, err = encodeV2(payloadRAKP1, 0, 0, rakp1, nil)
+	if err != nil {
+		return err
+	}
+	resp, err = c.exchange(pkt, payloadRAKP2)
+	if err != nil {
+		return fmt.Errorf("rakp1 failed: %v", err)
+	}
+
+	// RAKP Message 2: BMC の認証コードを検証
+	if len(resp.payload) < 40+20 || resp.payload[1] != 0 {
+		return fmt.Errorf("rakp2 rejected by BMC (status 0x%02x)", statusOf(resp.payload))
+	}
+	params.bmcRand = resp.payload[8:24]
+	params.bmcGUID = resp.payload[24:40]
+	kuid := userKey(c.password)
+	if !hmac.Equal(resp.payload[40:60], params.rakp2AuthCode(kuid)) {
+		return errors.New("rakp2 authentication failed: invalid username or password")
+	}
+
+	// RAKP Message 3
+	rakp3 := []byte{0x00, 0, 0, 0}
+	rakp3 = append(rakp3, le32(c.bmcSID)...)
+	rakp3 = append(rakp3, params.rakp3AuthCode(kuid)...)
+	pkt, err = encodeV2(payloadRAKP3, 0, 0, rakp3, nil)
+	if err != nil {
+		return err
+	}
+	resp, err = c.exchange(pkt, payloadRAKP4)
+	if err != nil {
+		return fmt.Errorf("rakp3 failed: %v", err)
+	}
+
+	// RAKP Message 4: セッション鍵の一致を確認
+	if len(resp.payload) < 8+integrityCodeSize || resp.payload[1] != 0 {
+		return fmt.Errorf("rakp4 rejected by BMC (status 0x%02x)", statusOf(resp.payload))
+	}
+	sik := params.sik(kuid)
+	if !hmac.Equal(resp.payload[8:8+integrityCodeSize], params.rakp4ICV(sik)) {
+		return errors.New("rakp4 integrity check failed")
+	}
+
+	c.keys = deriveKeys(sik)
+	return nil
+}
+
+// command は、確立済みのセッション上で IPMI コマンドを実行し、完了コードを除いた応答データを返します。
+func (c *Client) command(netFn byte, cmd byte, data []byte) ([]byte, error) {
+	c.rqSeq = (c.rqSeq + 1) & 0x3F
+	c.seq++
+	req := encodeMessage(bmcSlaveAddress, netFn, remoteSoftwareID, c.rqSeq, cmd, data)
+	pkt, err := encodeV2(payloadIPMI, c.bmcSID, c.seq, req, c.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.exchange(pkt, payloadIPMI)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.authenticated || !resp.encrypted || resp.sessionID != c.consoleSID {
+		return nil, fmt.Errorf("unexpected unauthenticated response")
+	}
+
+	msg, err := decodeMessage(resp.payload)
+	if err != nil {
+		return nil, err
+	}
+	if msg.cmd != cmd || msg.seq != c.rqSeq {
+		return nil, fmt.Errorf("response does not match request")
+	}
+	if len(msg.data) < 1 {
+		return nil, fmt.Errorf("response without completion code")
+	}
+	if msg.data[0] != completionOK {
+		return nil, fmt.Errorf("command 0x%02x failed with completion code 0x%02x", cmd, msg.data[0])
+	}
+	return msg.data[1:], nil
+}
+
+// exchange はパケットを送信し、指定したペイロード種別の応答を待ちます。タイムアウト時は再送します。
+func (c *Client) exchange(pkt []byte, want byte) (*packet, error) {
+	buf := make([]byte, 1024)
+	var lastErr error
+	for attempt := 0; attempt < retries; attempt++ {
+		if _, err := c.conn.Write(pkt); err != nil {
+			return nil, err
+		}
+		c.conn.SetReadDeadline(time.Now().Add(c.timeout))
+		for {
+			n, err := c.conn.Read(buf)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			resp, err := decodePacket(buf[:n], c.keys)
+			if err != nil || resp.payloadType != want {
+				// 破損・無関係なパケットは読み捨てて待ち続ける
+				continue
+			}
+			return resp, nil
+		}
+	}
+	return nil, fmt.Errorf("no response from BMC: %v", lastErr)
+}
+
+// statusOf は RMCP+ セッション確立メッセージのステータスコードを返します。
+func statusOf(payload []byte) byte {
+	if len(payload) < 2 {
+		return 0xFF
+	}
+	return payload[1]
+}
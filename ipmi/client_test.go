@@ -0,0 +1,78 @@
+package ipmi
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestSimulator は、テスト終了時に停止する BMC シミュレータを起動します。
+func newTestSimulator(t *testing.T) *Simulator {
+	t.Helper()
+	sim, err := NewSimulator("admin", "secret")
+	if err != nil {
+		t.Fatalf("NewSimulator: %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+	return sim
+}
+
+// TestDialAndChassisControl は、RAKP によるセッション確立と Chassis Control・Chassis Status を確認します。
+func TestDialAndChassisControl(t *testing.T) {
+	sim := newTestSimulator(t)
+	client, err := Dial(sim.Addr(), "admin", "secret", time.Second)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	steps := []struct {
+		control ChassisControl
+		powerOn bool
+	}{
+		{PowerUp, true},
+		{SoftShutdown, false},
+		{PowerCycle, true},
+		{PowerDown, false},
+		{HardReset, true},
+	}
+	for _, step := range steps {
+		if err := client.ChassisControl(step.control); err != nil {
+			t.Fatalf("ChassisControl(%#x): %v", step.control, err)
+		}
+		on, err := client.ChassisStatus()
+		if err != nil {
+			t.Fatalf("ChassisStatus: %v", err)
+		}
+		if on != step.powerOn {
+			t.Errorf("after %#x: power on = %t, want %t", step.control, on, step.powerOn)
+		}
+	}
+
+	controls := sim.Controls()
+	if len(controls) != len(steps) {
+		t.Fatalf("controls = %v, want %d entries", controls, len(steps))
+	}
+	for i, step := range steps {
+		if controls[i] != step.control {
+			t.Errorf("control[%d] = %#x, want %#x", i, controls[i], step.control)
+		}
+	}
+}
+
+// TestDialRejectsBadCredentials は、パスワードやユーザー名が誤っている場合にセッションを確立しないことを確認します。
+func TestDialRejectsBadCredentials(t *testing.T) {
+	sim := newTestSimulator(t)
+	for _, c := range []struct{ user, pass string }{
+		{"admin", "wrong"},
+		{"nobody", "secret"},
+	} {
+		client, err := Dial(sim.Addr(), c.user, c.pass, time.Second)
+		if err == nil {
+			client.Close()
+			t.Errorf("Dial(%s/%s) succeeded", c.user, c.pass)
+		}
+	}
+	if controls := sim.Controls(); len(controls) != 0 {
+		t.Errorf("controls = %v, want none", controls)
+	}
+}
@@ -0,0 +1,354 @@
+// Package ipmi は IPMI v2.0 (RMCP+) over LAN のクライアントと、動作確認用の BMC シミュレータを提供します。
+//
+// 対応している暗号スイートは RAKP-HMAC-SHA1 / HMAC-SHA1-96 / AES-CBC-128 (Cipher Suite 3) のみです。
+package ipmi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+)
+
+// RMCP / IPMI の定数
+const (
+	rmcpVersion   = 0x06
+	rmcpNoAck     = 0xFF
+	rmcpClassIPMI = 0x07
+
+	authTypeNone     = 0x00
+	authTypeRMCPPlus = 0x06
+
+	payloadIPMI                = 0x00
+	payloadOpenSessionRequest  = 0x10
+	payloadOpenSessionResponse = 0x11
+	payloadRAKP1               = 0x12
+	payloadRAKP2               = 0x13
+	payloadRAKP3               = 0x14
+	payloadRAKP4               = 0x15
+
+	payloadFlagEncrypted     = 0x80
+	payloadFlagAuthenticated = 0x40
+	payloadTypeMask          = 0x3F
+
+	netFnChassis = 0x00
+	netFnApp     = 0x06
+
+	cmdGetChassisStatus           = 0x01
+	cmdChassisControl             = 0x02
+	cmdGetChannelAuthCapabilities = 0x38
+	cmdSetSessionPrivilegeLevel   = 0x3B
+	cmdCloseSession               = 0x3C
+
+	privilegeUser          = 0x02
+	privilegeAdministrator = 0x04
+
+	// rakpNameOnlyLookup は RAKP1 の Role に付与する「ユーザー名のみで検索」フラグです。
+	rakpNameOnlyLookup = 0x10
+
+	algoRAKPHMACSHA1  = 0x01
+	algoHMACSHA196    = 0x01
+	algoAESCBC128     = 0x01
+	nextHeaderIPMI    = 0x07
+	integrityCodeSize = 12
+
+	bmcSlaveAddress  = 0x20
+	remoteSoftwareID = 0x81
+
+	completionOK                    = 0x00
+	completionInvalidCommand        = 0xC1
+	completionInsufficientPrivilege = 0xD4
+)
+
+// ChassisControl は Chassis Control コマンドの操作種別です。
+type ChassisControl byte
+
+const (
+	PowerDown    ChassisControl = 0x00 // 強制電源断
+	PowerUp      ChassisControl = 0x01 // 電源投入
+	PowerCycle   ChassisControl = 0x02 // 電源断後に再投入
+	HardReset    ChassisControl = 0x03 // ハードリセット
+	SoftShutdown ChassisControl = 0x05 // ACPI によるソフトシャットダウン
+)
+
+// message は IPMI LAN メッセージです。応答の場合 data[0] は完了コードです。
+type message struct {
+	netFn byte
+	seq   byte
+	cmd   byte
+	data  []byte
+}
+
+// checksum は IPMI の 2 の補数チェックサムを計算します。
+func checksum(b []byte) byte {
+	var sum byte
+	for _, v := range b {
+		sum += v
+	}
+	return -sum
+}
+
+// encodeMessage は IPMI LAN メッセージを組み立てます。要求と応答でアドレスの並びだけが異なります。
+func encodeMessage(dst byte, netFn byte, src byte, seq byte, cmd byte, data []byte) []byte {
+	b := []byte{dst, netFn << 2, 0, src, seq << 2, cmd}
+	b[2] = checksum(b[0:2])
+	b = append(b, data...)
+	return append(b, checksum(b[3:]))
+}
+
+// decodeMessage は IPMI LAN メッセージを解析し、チェックサムを検証します。
+func decodeMessage(b []byte) (*message, error) {
+	if len(b) < 7 {
+		return nil, fmt.Errorf("ipmi message too short: %d bytes", len(b))
+	}
+	if checksum(b[0:2]) != b[2] || checksum(b[3:len(b)-1]) != b[len(b)-1] {
+		return nil, fmt.Errorf("ipmi message checksum mismatch")
+	}
+	return &message{
+		netFn: b[1] >> 2,
+		seq:   b[4] >> 2,
+		cmd:   b[5],
+		data:  append([]byte(nil), b[6:len(b)-1]...),
+	}, nil
+}
+
+// sessionKeys は RAKP で確立したセッションの完全性鍵 (K1) と暗号鍵 (K2) です。
+type sessionKeys struct {
+	k1 []byte
+	k2 []byte
+}
+
+// deriveKeys は SIK から K1, K2 を導出します。
+func deriveKeys(sik []byte) *sessionKeys {
+	return &sessionKeys{
+		k1: hmacSHA1(sik, bytes.Repeat([]byte{0x01}, 20)),
+		k2: hmacSHA1(sik, bytes.Repeat([]byte{0x02}, 20)),
+	}
+}
+
+// packet は受信した RMCP パケットの内容です。
+type packet struct {
+	authType      byte
+	payloadType   byte
+	encrypted     bool
+	authenticated bool
+	sessionID     uint32
+	seq           uint32
+	payload       []byte
+}
+
+// encodeV15 は、セッション確立前に使用する IPMI v1.5 形式（認証なし）のパケットを組み立てます。
+func encodeV15(payload []byte) []byte {
+	b := []byte{rmcpVersion, 0, rmcpNoAck, rmcpClassIPMI, authTypeNone}
+	b = append(b, 0, 0, 0, 0) // セッションシーケンス番号
+	b = append(b, 0, 0, 0, 0) // セッションID
+	b = append(b, byte(len(payload)))
+	return append(b, payload...)
+}
+
+// encodeV2 は RMCP+ 形式のパケットを組み立てます。
+// keys が指定された場合、ペイロードを AES-CBC-128 で暗号化し、HMAC-SHA1-96 の完全性コードを付与します。
+func encodeV2(payloadType byte, sessionID uint32, seq uint32, payload []byte, keys *sessionKeys) ([]byte, error) {
+	if keys != nil {
+		encrypted, err := encryptPayload(keys.k2[:16], payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = encrypted
+		payloadType |= payloadFlagEncrypted | payloadFlagAuthenticated
+	}
+
+	session := []byte{authTypeRMCPPlus, payloadType}
+	session = binary.LittleEndian.AppendUint32(session, sessionID)
+	session = binary.LittleEndian.AppendUint32(session, seq)
+	session = binary.LittleEndian.AppendUint16(session, uint16(len(payload)))
+	session = append(session, payload...)
+
+	if keys != nil {
+		// 完全性パッド: セッションヘッダから Next Header までが 4 バイト境界になるように 0xFF で埋める
+		pad := (4 - (len(session)+2)%4) % 4
+		session = append(session, bytes.Repeat([]byte{0xFF}, pad)...)
+		session = append(session, byte(pad), nextHeaderIPMI)
+		session = append(session, hmacSHA1(keys.k1, session)[:integrityCodeSize]...)
+	}
+
+	return append([]byte{rmcpVersion, 0, rmcpNoAck, rmcpClassIPMI}, session...), nil
+}
+
+// decodePacket は受信したパケットを解析します。
+// 認証付きパケットは keys で完全性コードを検証し、暗号化されたペイロードを復号します。
+func decodePacket(b []byte, keys *sessionKeys) (*packet, error) {
+	if len(b) < 5 || b[0] != rmcpVersion || b[3] != rmcpClassIPMI {
+		return nil, fmt.Errorf("not an RMCP/IPMI packet")
+	}
+	rest := b[4:]
+	p := &packet{authType: rest[0]}
+
+	switch p.authType {
+	case authTypeNone:
+		if len(rest) < 10 {
+			return nil, fmt.Errorf("ipmi v1.5 packet too short")
+		}
+		p.seq = binary.LittleEndian.Uint32(rest[1:5])
+		p.sessionID = binary.LittleEndian.Uint32(rest[5:9])
+		length := int(rest[9])
+		if len(rest) < 10+length {
+			return nil, fmt.Errorf("ipmi v1.5 payload truncated")
+		}
+		p.payloadType = payloadIPMI
+		p.payload = rest[10 : 10+length]
+		return p, nil
+
+	case authTypeRMCPPlus:
+		if len(rest) < 12 {
+			return nil, fmt.Errorf("rmcp+ packet too short")
+		}
+		p.payloadType = rest[1] & payloadTypeMask
+		p.encrypted = rest[1]&payloadFlagEncrypted != 0
+		p.authenticated = rest[1]&payloadFlagAuthenticated != 0
+		p.sessionID = binary.LittleEndian.Uint32(rest[2:6])
+		p.seq = binary.LittleEndian.Uint32(rest[6:10])
+		length := int(binary.LittleEndian.Uint16(rest[10:12]))
+		if len(rest) < 12+length {
+			return nil, fmt.Errorf("rmcp+ payload truncated")
+		}
+		p.payload = rest[12 : 12+length]
+
+		if p.authenticated {
+			if keys == nil {
+				return nil, fmt.Errorf("authenticated packet without session keys")
+			}
+			if len(rest) < 12+length+2+integrityCodeSize {
+				return nil, fmt.Errorf("rmcp+ integrity trailer truncated")
+			}
+			signed := rest[:len(rest)-integrityCodeSize]
+			code := rest[len(rest)-integrityCodeSize:]
+			if !hmac.Equal(code, hmacSHA1(keys.k1, signed)[:integrityCodeSize]) {
+				return nil, fmt.Errorf("rmcp+ integrity check failed")
+			}
+		}
+		if p.encrypted {
+			if keys == nil {
+				return nil, fmt.Errorf("encrypted packet without session keys")
+			}
+			plain, err := decryptPayload(keys.k2[:16], p.payload)
+			if err != nil {
+				return nil, err
+			}
+			p.payload = plain
+		}
+		return p, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported auth type: 0x%02x", p.authType)
+	}
+}
+
+// encryptPayload は AES-CBC-128 で暗号化します。出力は IV (16バイト) に続く暗号文です。
+// 平文には 1, 2, 3... の確認用パッドとパッド長を付与します。
+func encryptPayload(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	padLen := (aes.BlockSize - (len(data)+1)%aes.BlockSize) % aes.BlockSize
+	plain := append([]byte(nil), data...)
+	for i := 1; i <= padLen; i++ {
+		plain = append(plain, byte(i))
+	}
+	plain = append(plain, byte(padLen))
+
+	out := make([]byte, aes.BlockSize+len(plain))
+	if _, err := rand.Read(out[:aes.BlockSize]); err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(block, out[:aes.BlockSize]).CryptBlocks(out[aes.BlockSize:], plain)
+	return out, nil
+}
+
+// decryptPayload は encryptPayload で暗号化されたペイロードを復号し、パッドを取り除きます。
+func decryptPayload(key []byte, data []byte) ([]byte, error) {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted payload length: %d", len(data))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plain, data[aes.BlockSize:])
+
+	padLen := int(plain[len(plain)-1])
+	if padLen >= aes.BlockSize || padLen+1 > len(plain) {
+		return nil, fmt.Errorf("invalid confidentiality pad length: %d", padLen)
+	}
+	return plain[:len(plain)-1-padLen], nil
+}
+
+// hmacSHA1 は parts を連結した値の HMAC-SHA1 を計算します。
+func hmacSHA1(key []byte, parts ...[]byte) []byte {
+	mac := hmac.New(sha1.New, key)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// userKey は、パスワードを 20 バイトにゼロ詰めした Kuid を返します。
+func userKey(password string) []byte {
+	key := make([]byte, 20)
+	copy(key, password)
+	return key
+}
+
+// rakpParams は RAKP の鍵交換に使用する値です。
+// m はリモートコンソール（クライアント）、c はマネージドシステム（BMC）を表します。
+type rakpParams struct {
+	consoleSID  uint32
+	bmcSID      uint32
+	consoleRand []byte
+	bmcRand     []byte
+	bmcGUID     []byte
+	role        byte
+	username    string
+}
+
+func le32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+// rakp2AuthCode は HMAC_Kuid(SIDm, SIDc, Rm, Rc, GUIDc, ROLEm, ULENGTHm, UNAMEm) です。
+func (p *rakpParams) rakp2AuthCode(kuid []byte) []byte {
+	return hmacSHA1(kuid, le32(p.consoleSID), le32(p.bmcSID), p.consoleRand, p.bmcRand, p.bmcGUID,
+		[]byte{p.role, byte(len(p.username))}, []byte(p.username))
+}
+
+// rakp3AuthCode は HMAC_Kuid(Rc, SIDm, ROLEm, ULENGTHm, UNAMEm) です。
+func (p *rakpParams) rakp3AuthCode(kuid []byte) []byte {
+	return hmacSHA1(kuid, p.bmcRand, le32(p.consoleSID), []byte{p.role, byte(len(p.username))}, []byte(p.username))
+}
+
+// sik は HMAC_Kg(Rm, Rc, ROLEm, ULENGTHm, UNAMEm) です。BMC 鍵 (Kg) 未設定のため Kuid を使用します。
+func (p *rakpParams) sik(kg []byte) []byte {
+	return hmacSHA1(kg, p.consoleRand, p.bmcRand, []byte{p.role, byte(len(p.username))}, []byte(p.username))
+}
+
+// rakp4ICV は HMAC_SIK(Rm, SIDc, GUIDc) の先頭 12 バイトです。
+func (p *rakpParams) rakp4ICV(sik []byte) []byte {
+	return hmacSHA1(sik, p.consoleRand, le32(p.bmcSID), p.bmcGUID)[:integrityCodeSize]
+}
+
+// algorithmPayloads は Open Session の認証・完全性・機密性アルゴリズムのペイロード (Cipher Suite 3) です。
+func algorithmPayloads() []byte {
+	return []byte{
+		0x00, 0, 0, 0x08, algoRAKPHMACSHA1, 0, 0, 0,
+		0x01, 0, 0, 0x08, algoHMACSHA196, 0, 0, 0,
+		0x02, 0, 0, 0x08, algoAESCBC128, 0, 0, 0,
+	}
+}
@@ -0,0 +1,304 @@
+package ipmi
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"log"
+	"net"
+	"sync"
+)
+
+// Simulator は、動作確認用にローカルで動作する最小限の IPMI v2.0 BMC です。
+// Cipher Suite 3 のセッション確立と、Chassis Status / Chassis Control に応答します。
+type Simulator struct {
+	username string
+	password string
+	guid     []byte
+	conn     net.PacketConn
+
+	mu       sync.Mutex
+	powerOn  bool
+	controls []ChassisControl
+	sessions map[uint32]*simSession
+}
+
+// simSession は、シミュレータ側のセッション状態です。
+type simSession struct {
+	params    *rakpParams
+	keys      *sessionKeys
+	privilege byte
+	seq       uint32
+}
+
+// NewSimulator は、127.0.0.1 の空きポートで BMC シミュレータを起動します。
+func NewSimulator(username string, password string) (*Simulator, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	guid := make([]byte, 16)
+	if _, err := rand.Read(guid); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s := &Simulator{
+		username: username,
+		password: password,
+		guid:     guid,
+		conn:     conn,
+		sessions: map[uint32]*simSession{},
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Addr は、シミュレータの待ち受けアドレス (host:port) を返します。
+func (s *Simulator) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// Close はシミュレータを停止します。
+func (s *Simulator) Close() error {
+	return s.conn.Close()
+}
+
+// PowerOn は、シミュレートしているシャーシの電源状態を返します。
+func (s *Simulator) PowerOn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.powerOn
+}
+
+// SetPowerOn は、シミュレートしているシャーシの電源状態を設定します。
+func (s *Simulator) SetPowerOn(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.powerOn = on
+}
+
+// Controls は、これまでに受け付けた Chassis Control の履歴を返します。
+func (s *Simulator) Controls() []ChassisControl {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ChassisControl(nil), s.controls...)
+}
+
+// serve は受信ループです。Close されるまで動作します。
+func (s *Simulator) serve() {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.handle(buf[:n]); resp != nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// handle は 1 つのパケットを処理し、応答パケットを返します。
+func (s *Simulator) handle(b []byte) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 認証付きパケットの検証にはセッション鍵が必要なため、ヘッダからセッションを特定する
+	var keys *sessionKeys
+	if len(b) >= 10 && b[4] == authTypeRMCPPlus {
+		if sess, ok := s.sessions[binary.LittleEndian.Uint32(b[6:10])]; ok {
+			keys = sess.keys
+		}
+	}
+	p, err := decodePacket(b, keys)
+	if err != nil {
+		log.Printf("[IPMI-SIM] dropping packet: %v", err)
+		return nil
+	}
+
+	switch {
+	case p.authType == authTypeNone && p.payloadType == payloadIPMI:
+		return s.handleSessionless(p)
+	case p.payloadType == payloadOpenSessionRequest:
+		return s.handleOpenSession(p)
+	case p.payloadType == payloadRAKP1:
+		return s.handleRAKP1(p)
+	case p.payloadType == payloadRAKP3:
+		return s.handleRAKP3(p)
+	case p.payloadType == payloadIPMI && p.authenticated && p.encrypted:
+		return s.handleCommand(p)
+	}
+	return nil
+}
+
+// handleSessionless は Get Channel Authentication Capabilities に応答します。
+func (s *Simulator) handleSessionless(p *packet) []byte {
+	msg, err := decodeMessage(p.payload)
+	if err != nil || msg.netFn != netFnApp || msg.cmd != cmdGetChannelAuthCapabilities {
+		return nil
+	}
+	// 完了コード, チャネル1, 拡張能力あり, ユーザー名+パスワード必須, IPMI v2.0 対応, OEM ID/補助データ
+	data := []byte{completionOK, 0x01, 0x80, 0x00, 0x02, 0, 0, 0, 0}
+	return encodeV15(encodeMessage(remoteSoftwareID, msg.netFn+1, bmcSlaveAddress, msg.seq, msg.cmd, data))
+}
+
+// handleOpenSession は Open Session Request に応答し、セッションを作成します。
+func (s *Simulator) handleOpenSession(p *packet) []byte {
+	if len(p.payload) < 32 {
+		return nil
+	}
+	consoleSID := binary.LittleEndian.Uint32(p.payload[4:8])
+
+	resp := []byte{p.payload[0], 0x00, privilegeAdministrator, 0}
+	resp = append(resp, le32(consoleSID)...)
+
+	// Cipher Suite 3 以外は拒否（0x11: 認証アルゴリズム不正）
+	if string(p.payload[8:32]) != string(algorithmPayloads()) {
+		resp[1] = 0x11
+		resp = append(resp, 0, 0, 0, 0)
+		return s.encode(payloadOpenSessionResponse, 0, 0, resp, nil)
+	}
+
+	var buf [4]byte
+	rand.Read(buf[:])
+	bmcSID := binary.LittleEndian.Uint32(buf[:]) | 1
+	s.sessions[bmcSID] = &simSession{
+		params:    &rakpParams{consoleSID: consoleSID, bmcSID: bmcSID, bmcGUID: s.guid},
+		privilege: privilegeUser,
+	}
+
+	resp = append(resp, le32(bmcSID)...)
+	resp = append(resp, algorithmPayloads()...)
+	return s.encode(payloadOpenSessionResponse, 0, 0, resp, nil)
+}
+
+// handleRAKP1 は RAKP Message 1 を受け取り、RAKP Message 2 を返します。
+func (s *Simulator) handleRAKP1(p *packet) []byte {
+	if len(p.payload) < 28 {
+		return nil
+	}
+	sess, ok := s.sessions[binary.LittleEndian.Uint32(p.payload[4:8])]
+	if !ok {
+		return nil
+	}
+	nameLen := int(p.payload[27])
+	if len(p.payload) < 28+nameLen {
+		return nil
+	}
+
+	params := sess.params
+	params.consoleRand = append([]byte(nil), p.payload[8:24]...)
+	params.role = p.payload[24]
+	params.username = string(p.payload[28 : 28+nameLen])
+	params.bmcRand = make([]byte, 16)
+	rand.Read(params.bmcRand)
+
+	resp := []byte{p.payload[0], 0x00, 0, 0}
+	resp = append(resp, le32(params.consoleSID)...)
+	if params.username != s.username {
+		// 0x0D: 未登録のユーザー名
+		resp[1] = 0x0D
+		return s.encode(payloadRAKP2, 0, 0, resp, nil)
+	}
+	resp = append(resp, params.bmcRand...)
+	resp = append(resp, params.bmcGUID...)
+	resp = append(resp, params.rakp2AuthCode(userKey(s.password))...)
+	return s.encode(payloadRAKP2, 0, 0, resp, nil)
+}
+
+// handleRAKP3 は RAKP Message 3 の認証コードを検証し、RAKP Message 4 を返してセッションを有効にします。
+func (s *Simulator) handleRAKP3(p *packet) []byte {
+	if len(p.payload) < 8+20 {
+		return nil
+	}
+	sess, ok := s.sessions[binary.LittleEndian.Uint32(p.payload[4:8])]
+	if !ok || sess.params.bmcRand == nil {
+		return nil
+	}
+
+	params := sess.params
+	kuid := userKey(s.password)
+	resp := []byte{p.payload[0], 0x00, 0, 0}
+	resp = append(resp, le32(params.consoleSID)...)
+	if !hmac.Equal(p.payload[8:28], params.rakp3AuthCode(kuid)) {
+		// 0x0F: 完全性チェック値不正
+		resp[1] = 0x0F
+		delete(s.sessions, params.bmcSID)
+		return s.encode(payloadRAKP4, 0, 0, resp, nil)
+	}
+
+	sik := params.sik(kuid)
+	resp = append(resp, params.rakp4ICV(sik)...)
+	out := s.encode(payloadRAKP4, 0, 0, resp, nil)
+	sess.keys = deriveKeys(sik)
+	return out
+}
+
+// handleCommand は、確立済みセッション上の IPMI コマンドを処理します。
+func (s *Simulator) handleCommand(p *packet) []byte {
+	sess, ok := s.sessions[p.sessionID]
+	if !ok || sess.keys == nil {
+		return nil
+	}
+	msg, err := decodeMessage(p.payload)
+	if err != nil {
+		return nil
+	}
+
+	var data []byte
+	switch {
+	case msg.netFn == netFnApp && msg.cmd == cmdSetSessionPrivilegeLevel && len(msg.data) >= 1:
+		requested := msg.data[0]
+		if requested > sess.params.role&0x0F {
+			data = []byte{0x81} // 要求された権限がセッションの上限を超えている
+		} else {
+			sess.privilege = requested
+			data = []byte{completionOK, requested}
+		}
+
+	case msg.netFn == netFnApp && msg.cmd == cmdCloseSession:
+		data = []byte{completionOK}
+		defer delete(s.sessions, p.sessionID)
+
+	case msg.netFn == netFnChassis && msg.cmd == cmdGetChassisStatus:
+		var state byte
+		if s.powerOn {
+			state = 0x01
+		}
+		data = []byte{completionOK, state, 0x00, 0x00}
+
+	case msg.netFn == netFnChassis && msg.cmd == cmdChassisControl && len(msg.data) >= 1:
+		if sess.privilege < privilegeAdministrator {
+			data = []byte{completionInsufficientPrivilege}
+			break
+		}
+		control := ChassisControl(msg.data[0])
+		s.controls = append(s.controls, control)
+		switch control {
+		case PowerDown, SoftShutdown:
+			s.powerOn = false
+		case PowerUp, PowerCycle, HardReset:
+			s.powerOn = true
+		}
+		data = []byte{completionOK}
+
+	default:
+		data = []byte{completionInvalidCommand}
+	}
+
+	sess.seq++
+	resp := encodeMessage(remoteSoftwareID, msg.netFn+1, bmcSlaveAddress, msg.seq, msg.cmd, data)
+	return s.encode(payloadIPMI, sess.params.consoleSID, sess.seq, resp, sess.keys)
+}
+
+// encode は RMCP+ 形式の応答パケットを組み立てます。
+func (s *Simulator) encode(payloadType byte, sessionID uint32, seq uint32, payload []byte, keys *sessionKeys) []byte {
+	out, err := encodeV2(payloadType, sessionID, seq, payload, keys)
+	if err != nil {
+		log.Printf("[IPMI-SIM] failed to encode response: %v", err)
+		return nil
+	}
+	return out
+}
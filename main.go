@@ -7,6 +7,7 @@ import (
 	"os"
 	"time"
 
+	"srv_mng/api"
 	"srv_mng/routers"
 	"srv_mng/service"
 )
@@ -41,11 +42,18 @@ func main() {
 	// ログフォーマットを設定
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
+	// インベントリファイル (INVENTORY_FILE) を反映し、SIGHUP とファイルの変更を監視する
+	// 最初の監視でファイルのターゲットを確認できるよう、監視の開始より先に反映する
+	service.StartInventory()
+
+	// バックグラウンド監視を開始 (/status と /events は監視結果を返す)
+	service.StartMonitor()
+
 	// routersパッケージからルーターを取得し、すべてのハンドラを設定
 	r := routers.NewRouter()
 
-	// 正常性チェック用ルート
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	// 正常性チェック用ルート ("/" のみに一致させ、未定義のパスは 404 にする)
+	r.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Go Power API is running."))
 	})
@@ -55,8 +63,9 @@ func main() {
 		port = "5001"
 	}
 
+	// リクエスト ID の付与を最も外側にし、認証エラー (401) やルートがない場合 (404/405) の応答にも ID を付ける
 	srv := &http.Server{
-		Handler:      r,
+		Handler:      api.RequestID(api.RequireToken(api.JSONErrors(r))),
 		Addr:         ":" + port,
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
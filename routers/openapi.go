@@ -0,0 +1,219 @@
+package routers
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"srv_mng/service"
+	"srv_mng/utils"
+)
+
+// pathParamPattern は、パス中の {name} 形式のパラメータです。
+var pathParamPattern = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// fieldEnums は、取り得る値が決まっている応答の項目です (構造体の型 → JSON の項目名 → 値)。
+var fieldEnums = map[reflect.Type]map[string][]string{
+	reflect.TypeOf(service.TargetStatus{}):     {"status": service.Statuses},
+	reflect.TypeOf(service.StatusTransition{}): {"from": service.Statuses, "to": service.Statuses},
+}
+
+// OpenAPIDocument は、APIRoutes から OpenAPI 3 ドキュメント (JSON) を生成します。
+// リクエスト・応答のスキーマは Go の型の json タグから生成します。
+func OpenAPIDocument() ([]byte, error) {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+
+	for _, rt := range APIRoutes() {
+		op := map[string]interface{}{
+			"summary":     rt.Summary,
+			"operationId": operationID(rt),
+		}
+		if rt.Tag != "" {
+			op["tags"] = []string{rt.Tag}
+		}
+		if params := openAPIParams(rt); len(params) > 0 {
+			op["parameters"] = params
+		}
+		if rt.Request != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(rt.Request), schemas)},
+				},
+			}
+		}
+
+		// 応答の型がなく JSON 以外の形式のみを返すルート (/events) は、JSON のスキーマを出力しない
+		content := map[string]interface{}{}
+		if rt.Response != nil || len(rt.Produces) == 0 {
+			response := rt.Response
+			if response == nil {
+				response = utils.JSONResponse{}
+			}
+			content["application/json"] = map[string]interface{}{"schema": schemaFor(reflect.TypeOf(response), schemas)}
+		}
+		for _, ct := range rt.Produces {
+			content[ct] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		op["responses"] = map[string]interface{}{
+			"200": map[string]interface{}{"description": "成功", "content": content},
+			"default": map[string]interface{}{
+				"description": "エラー",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(utils.JSONResponse{}), schemas)},
+				},
+			},
+		}
+
+		path := pathParamPattern.ReplaceAllString(rt.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "srv_mng API",
+			"version":     "1.0.0",
+			"description": "サーバ・コンテナの死活監視と電源操作の API です。接頭辞のない旧パス (/status など) は非推奨の別名として引き続き利用できます。",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": APIPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		// トークン認証は SRVMNG_API_TOKEN を設定した場合のみ有効
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []string{}}, map[string]interface{}{}},
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// operationID は、"GET /targets/{name}" から "getTargetsName" のような operationId を作成します。
+func operationID(rt Route) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(rt.Method))
+	for _, part := range strings.FieldsFunc(rt.Path, func(r rune) bool { return strings.ContainsRune("/{}._-", r) }) {
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
+
+// openAPIParams は、ルートのパラメータ定義を返します。Params にないパスパラメータは Path から補完します。
+func openAPIParams(rt Route) []interface{} {
+	params := append([]Param(nil), rt.Params...)
+	for _, m := range pathParamPattern.FindAllStringSubmatch(rt.Path, -1) {
+		found := false
+		for _, p := range params {
+			if p.In == "path" && p.Name == m[1] {
+				found = true
+			}
+		}
+		if !found {
+			params = append(params, Param{Name: m[1], In: "path"})
+		}
+	}
+
+	var result []interface{}
+	for _, p := range params {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		schema := map[string]interface{}{"type": typ}
+		if len(p.Enum) > 0 {
+			schema["enum"] = p.Enum
+		}
+		param := map[string]interface{}{"name": p.Name, "in": p.In, "schema": schema}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		if p.In == "path" {
+			param["required"] = true
+		}
+		result = append(result, param)
+	}
+	return result
+}
+
+// schemaFor は、Go の型から JSON スキーマを生成します。名前付きの構造体は components/schemas に登録して参照します。
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[name]; !ok {
+			// 自身を参照する型でも無限に再帰しないよう、先に登録してから中身を生成する
+			schemas[name] = map[string]interface{}{}
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	// interface{} など、型を特定できないもの
+	return map[string]interface{}{}
+}
+
+// structSchema は、構造体の公開フィールドを json タグの名前でプロパティにします。
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	props := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			// 埋め込みの構造体はフィールドを展開する
+			if embedded, ok := structSchema(f.Type, schemas)["properties"].(map[string]interface{}); ok {
+				for k, v := range embedded {
+					props[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = schemaFor(f.Type, schemas)
+		if enum, ok := fieldEnums[t][name]; ok {
+			props[name].(map[string]interface{})["enum"] = enum
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": props}
+}
@@ -1,27 +1,224 @@
 package routers
 
 import (
+	"log"
 	"net/http"
 
 	// APIハンドラ層をインポート
 	"srv_mng/api"
+	"srv_mng/service"
+	"srv_mng/utils"
+	"srv_mng/web"
 )
 
+// APIPrefix は、バージョン付き API のパスの接頭辞です。
+const APIPrefix = "/api/v1"
+
+// Route は1つの API エンドポイントの定義です。
+// ルーターへの登録と OpenAPI ドキュメントの生成はどちらもこの定義から行うため、両者は常に一致します。
+type Route struct {
+	Method  string // HTTP メソッド
+	Path    string // APIPrefix からの相対パス。{name} はパスパラメータ
+	Handler http.HandlerFunc
+	Legacy  bool // 接頭辞のない旧パスを非推奨の別名として登録する
+
+	// 以下は OpenAPI ドキュメントの内容
+	Tag      string
+	Summary  string
+	Params   []Param     // パスパラメータとクエリパラメータ (パスパラメータは省略時も Path から補完)
+	Request  interface{} // リクエストボディの型 (JSON)。nil はボディなし
+	Response interface{} // 成功時の応答の型 (JSON)。nil は utils.JSONResponse
+	Produces []string    // JSON 以外に返す Content-Type
+}
+
+// Param は、パスパラメータまたはクエリパラメータの定義です。
+type Param struct {
+	Name        string
+	In          string // "path" または "query"
+	Description string
+	Type        string // "string", "integer", "boolean"。省略時は "string"
+	Enum        []string
+}
+
+// APIRoutes は、すべての API エンドポイントの定義を返します。
+func APIRoutes() []Route {
+	return []Route{
+		// [電源制御エンドポイント] POSTリクエストでターゲットの電源操作を実行
+		{Method: "POST", Path: "/power/{action}", Handler: api.PowerHandler, Legacy: true,
+			Tag: "power", Summary: "ターゲットの電源操作を実行",
+			Params:  []Param{{Name: "action", In: "path", Description: "電源操作", Enum: api.PowerActions}},
+			Request: api.PowerActionRequest{}},
+
+		// [電源操作能力エンドポイント] GETリクエストでターゲットが対応する電源操作の一覧を取得
+		{Method: "GET", Path: "/power/capabilities", Handler: api.CapabilitiesHandler, Legacy: true,
+			Tag: "power", Summary: "ターゲットが対応する電源操作の一覧を取得",
+			Params:   []Param{{Name: "target", In: "query", Description: "ターゲット名"}},
+			Response: service.PowerCapabilities{}},
+
+		// [ステータス確認エンドポイント] GETリクエストで全ターゲットの死活確認結果を取得
+		{Method: "GET", Path: "/status", Handler: api.StatusHandler, Legacy: true,
+			Tag: "status", Summary: "全ターゲットの死活確認結果を取得",
+			Params: []Param{
+				{Name: "format", In: "query", Description: "出力形式 (Accept ヘッダーより優先)", Enum: []string{"json", "yaml", "csv", "markdown", "table", "text"}},
+				{Name: "fields", In: "query", Description: "出力する項目 (カンマ区切り)"},
+				{Name: "sort", In: "query", Description: "並べ替えの項目 (カンマ区切り、- を付けると降順)"},
+				{Name: "filter", In: "query", Description: "status, type, tag による絞り込み (例: status=AgentDown|Unreachable,tag=web)"},
+				{Name: "selector", In: "query", Description: "タグのセレクタ (例: web,env=prod)"},
+				{Name: "refresh", In: "query", Description: "true の場合はその場で死活確認を実行", Type: "boolean"},
+			},
+			Response: []service.TargetStatus{},
+			Produces: []string{"application/yaml", "text/csv", "text/markdown", "text/plain"}},
+
+		// [ステータス履歴エンドポイント] GETリクエストで確定した状態変化の履歴を取得
+		{Method: "GET", Path: "/status/history", Handler: api.StatusHistoryHandler, Legacy: true,
+			Tag: "status", Summary: "確定した状態変化の履歴を新しい順に取得",
+			Params: []Param{
+				{Name: "target", In: "query", Description: "ターゲット名"},
+				{Name: "limit", In: "query", Description: "件数 (デフォルト100)", Type: "integer"},
+			},
+			Response: []service.StatusTransition{}},
+
+		// [メトリクスエンドポイント] GETリクエストでバックグラウンド監視が記録した直近のメトリクスを取得
+		{Method: "GET", Path: "/status/metrics", Handler: api.MetricsHandler, Legacy: true,
+			Tag: "status", Summary: "直近のメトリクスをターゲットごとに取得",
+			Params:   []Param{{Name: "target", In: "query", Description: "ターゲット名"}},
+			Response: map[string][]service.MetricSample{}},
+
+		// [イベント配信エンドポイント] GETリクエストで状態変化・電源操作・アラートを Server-Sent Events で配信
+		{Method: "GET", Path: "/events", Handler: api.EventsHandler, Legacy: true,
+			Tag: "status", Summary: "状態変化・電源操作・アラートを Server-Sent Events で配信",
+			Params: []Param{
+				{Name: "last_event_id", In: "query", Description: "再開するイベント ID (Last-Event-ID ヘッダーと同じ)", Type: "integer"},
+			},
+			Produces: []string{"text/event-stream"}},
+
+		// [ターゲット登録/更新エンドポイント] POSTリクエストで新しいターゲットをDBに登録または更新
+		{Method: "POST", Path: "/targets/register", Handler: api.RegisterTargetHandler, Legacy: true,
+			Tag: "targets", Summary: "ターゲットを登録 (既存の場合は置き換え)",
+			Request: service.MonitorTarget{}},
+
+		// [ターゲット一覧エンドポイント] GETリクエストで登録済みのターゲット設定を取得 (秘密情報は除く)
+		{Method: "GET", Path: "/targets", Handler: api.TargetsHandler, Legacy: true,
+			Tag: "targets", Summary: "登録済みのターゲット設定を取得 (秘密情報は空)",
+			Params:   []Param{{Name: "selector", In: "query", Description: "タグのセレクタ (例: web,env=prod)"}},
+			Response: []service.MonitorTarget{}},
+
+		// [ターゲット個別エンドポイント] GET で取得、PATCH で一部の項目を更新、DELETE で削除
+		{Method: "GET", Path: "/targets/{name}", Handler: api.GetTargetHandler, Legacy: true,
+			Tag: "targets", Summary: "ターゲット設定を取得 (秘密情報は空)",
+			Response: service.MonitorTarget{}},
+		{Method: "PATCH", Path: "/targets/{name}", Handler: api.UpdateTargetHandler, Legacy: true,
+			Tag: "targets", Summary: "指定した項目のみ更新",
+			Request: service.MonitorTarget{}},
+		{Method: "DELETE", Path: "/targets/{name}", Handler: api.DeleteTargetHandler, Legacy: true,
+			Tag: "targets", Summary: "ターゲットを削除"},
+
+		// [インポート/エクスポートエンドポイント] YAML・JSON・CSV のインベントリでターゲットを一括登録・出力
+		{Method: "POST", Path: "/targets/import", Handler: api.ImportTargetsHandler,
+			Tag: "targets", Summary: "インベントリ (YAML・JSON・CSV) からターゲットを一括登録",
+			Params: []Param{
+				{Name: "mode", In: "query", Description: "upsert は追加・更新のみ、replace はファイルにないターゲットを削除", Enum: []string{"upsert", "replace"}},
+				{Name: "dry_run", In: "query", Description: "true の場合は反映せず差分のみを返す", Type: "boolean"},
+				{Name: "format", In: "query", Description: "インベントリの形式 (省略時は Content-Type・拡張子・内容から判定)", Enum: []string{"yaml", "json", "csv"}},
+			},
+			Request: []service.MonitorTarget{}, Response: service.ImportResult{}},
+		{Method: "GET", Path: "/targets/export", Handler: api.ExportTargetsHandler,
+			Tag: "targets", Summary: "ターゲット設定をインベントリ (YAML・JSON・CSV) として出力",
+			Params: []Param{
+				{Name: "format", In: "query", Description: "出力形式 (Accept ヘッダーより優先)", Enum: []string{"yaml", "json", "csv"}},
+				{Name: "selector", In: "query", Description: "タグのセレクタ (例: web,env=prod)"},
+				{Name: "include_secrets", In: "query", Description: "true の場合はパスワードなどを含める (管理者のトークンが必要)", Type: "boolean"},
+			},
+			Response: []service.MonitorTarget{},
+			Produces: []string{"application/yaml", "text/csv"}},
+
+		// [Ansible インベントリエンドポイント] Ansible の動的インベントリ形式でターゲットの一覧を取得
+		{Method: "GET", Path: "/targets/ansible-inventory", Handler: api.AnsibleInventoryHandler,
+			Tag: "targets", Summary: "Ansible の動的インベントリ (JSON) を取得",
+			Params: []Param{
+				{Name: "status", In: "query", Description: "監視結果の状態による絞り込み (例: Running、Running|Degraded)"},
+				{Name: "selector", In: "query", Description: "タグのセレクタ (例: web,env=prod)"},
+			},
+			Response: map[string]interface{}{}},
+
+		// [インベントリファイルのドリフトエンドポイント] INVENTORY_FILE の内容と DB の差分を取得
+		{Method: "GET", Path: "/inventory/drift", Handler: api.InventoryDriftHandler,
+			Tag: "targets", Summary: "インベントリファイルと DB の差分 (ドリフト) を取得",
+			Response: service.InventoryReport{}},
+
+		// [ディスカバリエンドポイント] サブネットから power_agent が動作するホストを探索し、候補をターゲットとして登録
+		{Method: "POST", Path: "/discovery/scans", Handler: api.StartDiscoveryHandler,
+			Tag: "discovery", Summary: "サブネットの探索をバックグラウンドで開始",
+			Request: api.DiscoveryRequest{}, Response: service.DiscoveryScan{}},
+		{Method: "GET", Path: "/discovery/scans", Handler: api.DiscoveryScansHandler,
+			Tag: "discovery", Summary: "探索の結果を新しい順に取得",
+			Response: []service.DiscoveryScan{}},
+		{Method: "GET", Path: "/discovery/scans/{id}", Handler: api.DiscoveryScanHandler,
+			Tag: "discovery", Summary: "探索の進捗と結果を取得",
+			Params:   []Param{{Name: "id", In: "path", Description: "探索の ID"}},
+			Response: service.DiscoveryScan{}},
+		{Method: "GET", Path: "/discovery/pending", Handler: api.PendingTargetsHandler,
+			Tag: "discovery", Summary: "登録待ちの候補を取得",
+			Response: []service.PendingTarget{}},
+		{Method: "POST", Path: "/discovery/pending/{host_ip}/accept", Handler: api.AcceptPendingTargetHandler,
+			Tag: "discovery", Summary: "候補をターゲットとして登録 (ボディで項目を上書き可能)",
+			Params:  []Param{{Name: "host_ip", In: "path", Description: "候補の IP アドレス"}},
+			Request: service.MonitorTarget{}, Response: service.MonitorTarget{}},
+		{Method: "DELETE", Path: "/discovery/pending/{host_ip}", Handler: api.DismissPendingTargetHandler,
+			Tag: "discovery", Summary: "登録しない候補を削除",
+			Params: []Param{{Name: "host_ip", In: "path", Description: "候補の IP アドレス"}}},
+
+		// [メンテナンスモードエンドポイント] POSTリクエストでターゲットのメンテナンスモードを切り替え
+		{Method: "POST", Path: "/targets/maintenance", Handler: api.MaintenanceHandler, Legacy: true,
+			Tag: "targets", Summary: "メンテナンスモードを切り替え",
+			Request: api.MaintenanceRequest{}},
+
+		// [OpenAPI ドキュメント] この API の OpenAPI 3 ドキュメントを取得
+		{Method: "GET", Path: "/openapi.json", Handler: OpenAPIHandler,
+			Tag: "meta", Summary: "この API の OpenAPI 3 ドキュメントを取得",
+			Response: map[string]interface{}{}},
+	}
+}
+
 // NewRouter はルーティングを設定した ServeMux を返します。
-// すべてのAPIエンドポイントをここで定義し、apiパッケージのハンドラを関連付けます。
+// APIRoutes の各エンドポイントを APIPrefix の下に "METHOD /path" の形式で登録し、
+// Legacy の指定があるものは旧パスにも非推奨の別名として登録します。
 func NewRouter() *http.ServeMux {
 	// ルーターの作成
 	mux := http.NewServeMux()
 
-	// [電源制御エンドポイント] POSTリクエストでターゲットの電源操作を実行
-	mux.HandleFunc("/power/start", api.PowerHandler)
-	mux.HandleFunc("/power/stop", api.PowerHandler)
-
-	// [ステータス確認エンドポイント] GETリクエストで全ターゲットの死活確認結果を取得
-	mux.HandleFunc("/status", api.StatusHandler)
+	for _, rt := range APIRoutes() {
+		mux.HandleFunc(rt.Method+" "+APIPrefix+rt.Path, rt.Handler)
+		if rt.Legacy {
+			mux.HandleFunc(rt.Method+" "+rt.Path, deprecated(rt.Handler))
+		}
+	}
 
-	// [ターゲット登録/更新エンドポイント] POSTリクエストで新しいターゲットをDBに登録または更新
-	mux.HandleFunc("/targets/register", api.RegisterTargetHandler)
+	// [ダッシュボード] 組み込みの Web ダッシュボードを配信
+	mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", web.Handler()))
 
 	return mux
 }
+
+// deprecated は、旧パスへのリクエストに非推奨であることを示すヘッダーを付けます。
+// 後継のパスは Link ヘッダーで通知します。
+func deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+APIPrefix+r.URL.Path+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// OpenAPIHandler は /openapi.json を処理するハンドラです。APIRoutes から生成した OpenAPI 3 ドキュメントを返します。
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := OpenAPIDocument()
+	if err != nil {
+		log.Printf("[ERROR] Failed to generate OpenAPI document: %v", err)
+		utils.WriteError(w, r, http.StatusInternalServerError, utils.CodeInternal, utils.JSONResponse{Message: "Failed to generate OpenAPI document"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc)
+}
@@ -0,0 +1,132 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"srv_mng/service"
+)
+
+// openAPIOperations は、OpenAPI ドキュメントのパスとメソッドの組を "METHOD /path" の形式で返します。
+func openAPIOperations(t *testing.T) map[string]bool {
+	t.Helper()
+	raw, err := OpenAPIDocument()
+	if err != nil {
+		t.Fatalf("OpenAPIDocument: %v", err)
+	}
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("unmarshal OpenAPI document: %v", err)
+	}
+
+	ops := map[string]bool{}
+	for path, methods := range doc.Paths {
+		for method := range methods {
+			ops[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	return ops
+}
+
+// samplePath は、パスパラメータを具体的な値に置き換えたパスを返します。
+func samplePath(path string) string {
+	return pathParamPattern.ReplaceAllString(path, "sample")
+}
+
+// resolvedPattern は、ルーターがリクエストを割り当てるパターンを返します (見つからない場合は空)。
+func resolvedPattern(mux *http.ServeMux, method, path string) string {
+	_, pattern := mux.Handler(httptest.NewRequest(method, path, nil))
+	return pattern
+}
+
+// TestOpenAPIPathsResolve は、OpenAPI ドキュメントのすべてのパスとメソッドがルーターで同じルートに割り当てられることを確認します。
+func TestOpenAPIPathsResolve(t *testing.T) {
+	mux := NewRouter()
+	for op := range openAPIOperations(t) {
+		method, path, _ := strings.Cut(op, " ")
+		pattern := resolvedPattern(mux, method, APIPrefix+samplePath(path))
+		if pattern == "" {
+			t.Errorf("%s is documented but not routed", op)
+			continue
+		}
+		got, _ := strings.CutPrefix(pattern, method+" "+APIPrefix)
+		if pathParamPattern.ReplaceAllString(got, "{$1}") != path {
+			t.Errorf("%s is routed to %q", op, pattern)
+		}
+	}
+}
+
+// TestRoutesDocumented は、ルーターに登録するすべてのエンドポイントが OpenAPI ドキュメントに記載されていることを確認します。
+func TestRoutesDocumented(t *testing.T) {
+	ops := openAPIOperations(t)
+	routes := APIRoutes()
+	for _, rt := range routes {
+		op := rt.Method + " " + pathParamPattern.ReplaceAllString(rt.Path, "{$1}")
+		if !ops[op] {
+			t.Errorf("%s is routed but not documented", op)
+		}
+	}
+	if len(ops) != len(routes) {
+		t.Errorf("OpenAPI document has %d operations, want %d (duplicate routes?)", len(ops), len(routes))
+	}
+}
+
+// TestLegacyAliases は、旧パスが Legacy のルートのみに登録され、非推奨のヘッダーを返すことを確認します。
+func TestLegacyAliases(t *testing.T) {
+	mux := NewRouter()
+	for _, rt := range APIRoutes() {
+		pattern := resolvedPattern(mux, rt.Method, samplePath(rt.Path))
+		if rt.Legacy && pattern != rt.Method+" "+rt.Path {
+			t.Errorf("legacy alias %s %s is routed to %q", rt.Method, rt.Path, pattern)
+		}
+		if !rt.Legacy && pattern == rt.Method+" "+rt.Path {
+			t.Errorf("%s %s has an unexpected legacy alias %q", rt.Method, rt.Path, pattern)
+		}
+	}
+
+	// DB を初期化していないためハンドラは 503 を返すが、ヘッダーはハンドラの前に付く
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/targets", nil))
+	if got := rec.Header().Get("Deprecation"); got != "true" {
+		t.Errorf("Deprecation = %q, want %q", got, "true")
+	}
+	if got, want := rec.Header().Get("Link"), `</api/v1/targets>; rel="successor-version"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", APIPrefix+"/targets", nil))
+	if got := rec.Header().Get("Deprecation"); got != "" {
+		t.Errorf("Deprecation on %s/targets = %q, want none", APIPrefix, got)
+	}
+}
+
+// TestStatusEnum は、OpenAPI ドキュメントの TargetStatus.status にすべての状態が列挙されていることを確認します。
+func TestStatusEnum(t *testing.T) {
+	raw, err := OpenAPIDocument()
+	if err != nil {
+		t.Fatalf("OpenAPIDocument: %v", err)
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("unmarshal OpenAPI document: %v", err)
+	}
+	enum := doc.Components.Schemas["TargetStatus"].Properties["status"].Enum
+	if !slices.Equal(enum, service.Statuses) {
+		t.Errorf("TargetStatus.status enum = %v, want %v", enum, service.Statuses)
+	}
+}
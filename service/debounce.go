@@ -0,0 +1,253 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 状態のデバウンス・フラップ検知 START===========================================================START
+
+// デバウンス・フラップ検知の既定値。環境変数で上書きできます。
+const (
+	defaultFailThreshold    = 3                // STATUS_FAIL_THRESHOLD: 停止側の状態へ変わるまでに必要な連続観測回数
+	defaultSuccessThreshold = 1                // STATUS_SUCCESS_THRESHOLD: 稼働側の状態へ変わるまでに必要な連続観測回数
+	defaultFlapThreshold    = 5                // FLAP_THRESHOLD: フラップと判定する期間内の状態変化回数
+	defaultFlapWindow       = 10 * time.Minute // FLAP_WINDOW: フラップ判定の期間 (例: "10m")
+)
+
+// envInt は、環境変数を正の整数として読み取ります。未設定・不正な場合は def を返します。
+func envInt(name string, def int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+		log.Printf("[ERROR] invalid %s=%q, using default %d", name, v, def)
+	}
+	return def
+}
+
+// envDuration は、環境変数を time.Duration として読み取ります。未設定・不正な場合は def を返します。
+func envDuration(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("[ERROR] invalid %s=%q, using default %s", name, v, def)
+	}
+	return def
+}
+
+// debounceConfig は、デバウンスとフラップ検知の設定です。
+type debounceConfig struct {
+	failThreshold    int
+	successThreshold int
+	flapThreshold    int
+	flapWindow       time.Duration
+}
+
+// loadDebounceConfig は、環境変数から設定を読み込みます。
+func loadDebounceConfig() debounceConfig {
+	return debounceConfig{
+		failThreshold:    envInt("STATUS_FAIL_THRESHOLD", defaultFailThreshold),
+		successThreshold: envInt("STATUS_SUCCESS_THRESHOLD", defaultSuccessThreshold),
+		flapThreshold:    envInt("FLAP_THRESHOLD", defaultFlapThreshold),
+		flapWindow:       envDuration("FLAP_WINDOW", defaultFlapWindow),
+	}
+}
+
+// isUpStatus は、稼働側の状態かを返します。
+func isUpStatus(status string) bool {
+	return status == StatusRunning || status == StatusDegraded
+}
+
+// isImmediateStatus は、デバウンスせずに即時反映する状態かを返します。
+// 電源操作やメンテナンスの切替は利用者の操作によるもので、観測の揺らぎではないためです。
+func isImmediateStatus(status string) bool {
+	switch status {
+	case StatusPoweringOn, StatusShuttingDown, StatusMaintenance:
+		return true
+	}
+	return false
+}
+
+// targetState は、ターゲットごとのデバウンス状態です。
+type targetState struct {
+	stable    string      // 確定した状態
+	since     time.Time   // stable になった時刻
+	candidate string      // 確定待ちの状態
+	count     int         // candidate を連続で観測した回数
+	changes   []time.Time // flapWindow 内の状態変化の時刻
+	flapping  bool
+}
+
+// StatusTransition は、確定した状態の変化です。
+type StatusTransition struct {
+	Target   string    `json:"target"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Flapping bool      `json:"flapping"`
+	At       time.Time `json:"at"`
+
+	flapStarted bool // この変化でフラップ中になった
+}
+
+// statusDebouncer は、観測した状態を連続回数で確定させ、状態変化の頻度からフラップを検知します。
+type statusDebouncer struct {
+	mu     sync.Mutex
+	config debounceConfig
+	states map[string]*targetState
+}
+
+var debouncer = &statusDebouncer{config: loadDebounceConfig(), states: make(map[string]*targetState)}
+
+// observe は、観測した状態を反映し、確定した状態とその開始時刻、フラップ中かを返します。
+// 状態が確定して変化した場合は transition を返します。
+func (d *statusDebouncer) observe(name, observed string, now time.Time) (st targetState, transition *StatusTransition) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.states[name]
+	if !ok {
+		// 初回の観測はそのまま確定させる
+		s = &targetState{stable: observed, since: now}
+		d.states[name] = s
+		return *s, nil
+	}
+
+	if observed == s.stable {
+		s.candidate, s.count = "", 0
+	} else {
+		if observed == s.candidate {
+			s.count++
+		} else {
+			s.candidate, s.count = observed, 1
+		}
+
+		threshold := d.config.failThreshold
+		if isUpStatus(observed) {
+			threshold = d.config.successThreshold
+		}
+		immediate := isImmediateStatus(observed) || isImmediateStatus(s.stable)
+		if immediate || s.count >= threshold {
+			transition = &StatusTransition{Target: name, From: s.stable, To: observed, At: now}
+			s.stable, s.since = observed, now
+			s.candidate, s.count = "", 0
+			// 利用者の操作による変化はフラップの回数に含めない
+			if !immediate {
+				s.changes = append(s.changes, now)
+			}
+		}
+	}
+
+	// 期間外の状態変化を捨て、残りの回数でフラップを判定する
+	cutoff := now.Add(-d.config.flapWindow)
+	kept := s.changes[:0]
+	for _, t := range s.changes {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	s.changes = kept
+	wasFlapping := s.flapping
+	s.flapping = len(s.changes) >= d.config.flapThreshold
+	if transition != nil {
+		transition.Flapping = s.flapping
+		transition.flapStarted = s.flapping && !wasFlapping
+	}
+	return *s, transition
+}
+
+// current は、ターゲットの確定した状態を返します。観測結果は反映しません。
+func (d *statusDebouncer) current(name string) (targetState, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, ok := d.states[name]
+	if !ok {
+		return targetState{}, false
+	}
+	return *s, true
+}
+
+// forget は、削除されたターゲットの状態を破棄します。
+func (d *statusDebouncer) forget(name string) {
+	d.mu.Lock()
+	delete(d.states, name)
+	d.mu.Unlock()
+}
+
+// 状態変化の履歴 ----------------------------------------------------
+
+// createStatusEventsTable は、確定した状態変化を記録する status_events テーブルを作成します。
+func createStatusEventsTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS status_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		from_status TEXT NOT NULL,
+		to_status TEXT NOT NULL,
+		flapping INTEGER NOT NULL DEFAULT 0,
+		changed_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_status_events_name ON status_events (name, changed_at);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create status_events table: %w", err)
+	}
+	return nil
+}
+
+// recordTransition は、確定した状態変化を status_events に保存し、/events へ配信します。
+func recordTransition(t *StatusTransition) {
+	log.Printf("[INFO] Status of '%s' changed: %s -> %s (flapping: %t)", t.Target, t.From, t.To, t.Flapping)
+	PublishEvent(EventStatus, t)
+	if alert := alertForTransition(t); alert != nil {
+		PublishEvent(EventAlert, alert)
+	}
+	if db == nil {
+		return
+	}
+	_, err := db.Exec("INSERT INTO status_events (name, from_status, to_status, flapping, changed_at) VALUES (?, ?, ?, ?, ?)",
+		t.Target, t.From, t.To, t.Flapping, t.At.UTC())
+	if err != nil {
+		log.Printf("[ERROR] failed to record status event for '%s': %v", t.Target, err)
+	}
+}
+
+// GetStatusHistory は、状態変化の履歴を新しい順に返します。targetName が空の場合は全ターゲットを対象とします。
+func GetStatusHistory(targetName string, limit int) ([]StatusTransition, error) {
+	if db == nil {
+		return nil, errNoDB()
+	}
+
+	query := "SELECT name, from_status, to_status, flapping, changed_at FROM status_events"
+	args := []interface{}{}
+	if targetName != "" {
+		query += " WHERE name = ?"
+		args = append(args, targetName)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("[ERROR] database query error: %v", err)
+		return nil, withKind(ErrUnavailable, fmt.Errorf("database query error: %w", err))
+	}
+	defer rows.Close()
+
+	history := []StatusTransition{}
+	for rows.Next() {
+		var t StatusTransition
+		if err := rows.Scan(&t.Target, &t.From, &t.To, &t.Flapping, &t.At); err != nil {
+			return nil, withKind(ErrUnavailable, fmt.Errorf("failed to scan status event: %w", err))
+		}
+		history = append(history, t)
+	}
+	return history, rows.Err()
+}
+
+// 状態のデバウンス・フラップ検知 END===========================================================END
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// debounceStep は、1回の観測と、その後に期待する確定状態です。
+type debounceStep struct {
+	observed   string
+	minute     int // 観測した時刻 (開始からの分)
+	stable     string
+	transition bool // この観測で状態が確定して変化する
+	flapping   bool
+}
+
+func TestDebouncerObserve(t *testing.T) {
+	const R, D, U, A = StatusRunning, StatusDegraded, StatusUnreachable, StatusAgentDown
+	cases := []struct {
+		name   string
+		config debounceConfig
+		steps  []debounceStep
+	}{
+		{
+			name:   "failures must be consecutive",
+			config: debounceConfig{failThreshold: 3, successThreshold: 1, flapThreshold: 5, flapWindow: 10 * time.Minute},
+			steps: []debounceStep{
+				{R, 0, R, false, false}, // 初回はそのまま確定
+				{U, 1, R, false, false},
+				{U, 2, R, false, false},
+				{R, 3, R, false, false}, // 連続回数がリセットされる
+				{U, 4, R, false, false},
+				{U, 5, R, false, false},
+				{U, 6, U, true, false},
+			},
+		},
+		{
+			name:   "a different failure restarts the count",
+			config: debounceConfig{failThreshold: 2, successThreshold: 1, flapThreshold: 5, flapWindow: 10 * time.Minute},
+			steps: []debounceStep{
+				{R, 0, R, false, false},
+				{U, 1, R, false, false},
+				{A, 2, R, false, false},
+				{A, 3, A, true, false},
+			},
+		},
+		{
+			name:   "recovery uses the success threshold",
+			config: debounceConfig{failThreshold: 3, successThreshold: 2, flapThreshold: 5, flapWindow: 10 * time.Minute},
+			steps: []debounceStep{
+				{U, 0, U, false, false},
+				{R, 1, U, false, false},
+				{D, 2, U, false, false}, // Degraded は Running とは別の状態として数える
+				{D, 3, D, true, false},
+			},
+		},
+		{
+			name:   "power actions and maintenance bypass the thresholds",
+			config: debounceConfig{failThreshold: 3, successThreshold: 3, flapThreshold: 2, flapWindow: 10 * time.Minute},
+			steps: []debounceStep{
+				{R, 0, R, false, false},
+				{StatusShuttingDown, 1, StatusShuttingDown, true, false},
+				{U, 2, U, true, false}, // 即時反映の状態からの変化も即時
+				{StatusPoweringOn, 3, StatusPoweringOn, true, false},
+				{R, 4, R, true, false},
+				{StatusMaintenance, 5, StatusMaintenance, true, false}, // いずれもフラップに数えない
+			},
+		},
+		{
+			name:   "flapping is set within the window and cleared after it",
+			config: debounceConfig{failThreshold: 1, successThreshold: 1, flapThreshold: 3, flapWindow: 10 * time.Minute},
+			steps: []debounceStep{
+				{R, 0, R, false, false},
+				{U, 1, U, true, false},
+				{R, 2, R, true, false},
+				{U, 3, U, true, true},
+				{U, 8, U, false, true},
+				{U, 12, U, false, false}, // minute 1 と 2 の変化が期間外になる
+				{R, 30, R, true, false},
+			},
+		},
+	}
+
+	start := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			d := &statusDebouncer{config: c.config, states: map[string]*targetState{}}
+			for i, step := range c.steps {
+				at := start.Add(time.Duration(step.minute) * time.Minute)
+				state, transition := d.observe("web01", step.observed, at)
+				if state.stable != step.stable || state.flapping != step.flapping {
+					t.Errorf("step %d (%s): stable = %s, flapping = %t, want %s, %t", i, step.observed, state.stable, state.flapping, step.stable, step.flapping)
+				}
+				if (transition != nil) != step.transition {
+					t.Errorf("step %d (%s): transition = %+v, want %t", i, step.observed, transition, step.transition)
+					continue
+				}
+				if transition != nil && (transition.To != step.stable || !transition.At.Equal(at) || transition.Flapping != step.flapping) {
+					t.Errorf("step %d (%s): transition = %+v", i, step.observed, transition)
+				}
+				if transition != nil && !state.since.Equal(at) {
+					t.Errorf("step %d (%s): since = %s, want %s", i, step.observed, state.since, at)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	newTestDB(t)
+	at := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	recordTransition(&StatusTransition{Target: "web01", From: StatusRunning, To: StatusUnreachable, At: at})
+	recordTransition(&StatusTransition{Target: "db01", From: StatusRunning, To: StatusAgentDown, At: at.Add(time.Minute)})
+	recordTransition(&StatusTransition{Target: "web01", From: StatusUnreachable, To: StatusRunning, Flapping: true, At: at.Add(2 * time.Minute)})
+
+	history, err := GetStatusHistory("web01", 10)
+	if err != nil {
+		t.Fatalf("GetStatusHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history = %+v, want 2 entries", history)
+	}
+	newest := history[0]
+	if newest.To != StatusRunning || !newest.Flapping || !newest.At.Equal(at.Add(2*time.Minute)) {
+		t.Errorf("newest = %+v", newest)
+	}
+	if history[1].To != StatusUnreachable {
+		t.Errorf("oldest = %+v", history[1])
+	}
+
+	if all, _ := GetStatusHistory("", 2); len(all) != 2 || all[0].Target != "web01" || all[1].Target != "db01" {
+		t.Errorf("limited history = %+v", all)
+	}
+}
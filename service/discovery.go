@@ -0,0 +1,445 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ディスカバリ START===========================================================START
+
+// DefaultDiscoveryPorts は、探索で確認する power_agent のポートの既定値です (power_agent の既定のポート)。
+var DefaultDiscoveryPorts = []string{"8080"}
+
+const (
+	maxDiscoveryHosts      = 4096                   // 1回の探索で確認するアドレス数の上限 (/20 相当)
+	maxDiscoveryScans      = 20                     // 保持する探索結果の数 (古いものから破棄する)
+	discoveryConcurrency   = 64                     // 同時に確認するアドレスの数
+	discoveryDialTimeout   = 500 * time.Millisecond // ポートが開いているかを確認するときのタイムアウト
+	discoveryInfoTimeout   = 3 * time.Second        // エージェントの /info を取得するときのタイムアウト
+	discoveryAgentIdentity = "power_agent"          // /info の agent の値
+)
+
+// 探索の状態 (DiscoveryScan.Status)
+const (
+	ScanRunning   = "running"
+	ScanCompleted = "completed"
+)
+
+// DiscoveryScan は、サブネットの探索の進捗と結果です。
+type DiscoveryScan struct {
+	ID         string     `json:"id"`
+	CIDR       string     `json:"cidr"`
+	Ports      []string   `json:"ports"`
+	Status     string     `json:"status"`     // "running" または "completed"
+	Total      int        `json:"total"`      // 探索するアドレスの数
+	Scanned    int        `json:"scanned"`    // 確認を終えたアドレスの数
+	Found      []string   `json:"found"`      // 候補 (pending) に追加したアドレス
+	Registered []string   `json:"registered"` // 見つかったが登録済みだったターゲット名
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// AgentInterface は、エージェントの /info が返すネットワークインターフェースの情報です。
+type AgentInterface struct {
+	Name       string   `json:"name"`
+	MAC        string   `json:"mac"`
+	IPs        []string `json:"ips"`        // CIDR 表記 (例: 192.168.1.10/24)
+	Broadcasts []string `json:"broadcasts"` // IPv4 アドレスごとのブロードキャストアドレス
+}
+
+// agentInfo は、エージェントの /info のレスポンスです。
+type agentInfo struct {
+	Agent         string           `json:"agent"`
+	Hostname      string           `json:"hostname"`
+	PrivilegeMode string           `json:"privilege_mode"`
+	Interfaces    []AgentInterface `json:"interfaces"`
+}
+
+// PendingTarget は、探索で見つかり、登録を待っているターゲットの候補です。
+// 承認すると、Name・MacAddress・BroadcastIP などを初期値としたターゲットとして登録します。
+type PendingTarget struct {
+	HostIP        string           `json:"host_ip"`
+	Port          string           `json:"port"`
+	Name          string           `json:"name"` // ホスト名から作成したターゲット名の候補
+	Hostname      string           `json:"hostname"`
+	MacAddress    string           `json:"mac_address"`  // host_ip を持つインターフェースの MAC アドレス
+	BroadcastIP   string           `json:"broadcast_ip"` // host_ip のサブネットのブロードキャストアドレス
+	PrivilegeMode string           `json:"privilege_mode"`
+	Interfaces    []AgentInterface `json:"interfaces"`
+	ScanID        string           `json:"scan_id"`
+	DiscoveredAt  time.Time        `json:"discovered_at"`
+}
+
+// discovery は、探索の結果と登録待ちの候補です。サーバーを再起動すると破棄されます。
+var discovery = struct {
+	sync.Mutex
+	scans   []*DiscoveryScan          // 古い順
+	pending map[string]*PendingTarget // host_ip → 候補
+	nextID  int
+}{pending: map[string]*PendingTarget{}}
+
+// copyScan は、探索中に書き換えられないよう、探索結果のコピーを返します。discovery をロックした状態で呼び出します。
+func copyScan(s *DiscoveryScan) DiscoveryScan {
+	c := *s
+	c.Ports = slices.Clone(s.Ports)
+	c.Found = slices.Clone(s.Found)
+	c.Registered = slices.Clone(s.Registered)
+	return c
+}
+
+// StartDiscovery は、cidr の範囲のアドレスで ports のいずれかに power_agent が応答するかを確認する探索を開始します。
+// 探索はバックグラウンドで行い、開始した探索の情報をすぐに返します。ports が空の場合は DefaultDiscoveryPorts を使用します。
+// 見つかったホストのうち、登録済みでないものは登録待ちの候補 (ListPendingTargets) に追加します。
+func StartDiscovery(cidr string, ports []string) (*DiscoveryScan, error) {
+	if len(ports) == 0 {
+		ports = DefaultDiscoveryPorts
+	}
+	hosts, err := validateDiscovery(cidr, ports)
+	if err != nil {
+		return nil, err
+	}
+	if db == nil {
+		return nil, errNoDB()
+	}
+
+	discovery.Lock()
+	defer discovery.Unlock()
+	for _, s := range discovery.scans {
+		if s.Status == ScanRunning {
+			return nil, withKind(ErrConflict, fmt.Errorf("discovery scan %s (%s) is already running", s.ID, s.CIDR))
+		}
+	}
+
+	discovery.nextID++
+	scan := &DiscoveryScan{
+		ID:         strconv.Itoa(discovery.nextID),
+		CIDR:       cidr,
+		Ports:      slices.Clone(ports),
+		Status:     ScanRunning,
+		Total:      len(hosts),
+		Found:      []string{},
+		Registered: []string{},
+		StartedAt:  time.Now(),
+	}
+	discovery.scans = append(discovery.scans, scan)
+	if len(discovery.scans) > maxDiscoveryScans {
+		discovery.scans = discovery.scans[len(discovery.scans)-maxDiscoveryScans:]
+	}
+
+	log.Printf("[INFO] Discovery scan %s started: %s (%d addresses, ports %s)", scan.ID, cidr, len(hosts), strings.Join(ports, ","))
+	go runDiscovery(scan, hosts)
+
+	c := copyScan(scan)
+	return &c, nil
+}
+
+// validateDiscovery は、探索の範囲とポートを検証し、探索するアドレスの一覧を返します。
+// ネットワークアドレスとブロードキャストアドレスは含めません (/31 と /32 を除く)。
+func validateDiscovery(cidr string, ports []string) ([]net.IP, error) {
+	ve := &ValidationError{subject: "discovery request"}
+	for i, port := range ports {
+		if err := validatePort(port); err != nil {
+			ve.add(fmt.Sprintf("ports[%d]", i), "%v", err)
+		}
+	}
+
+	var hosts []net.IP
+	_, ipnet, err := net.ParseCIDR(cidr)
+	switch {
+	case cidr == "":
+		ve.add("cidr", "is required")
+	case err != nil:
+		ve.add("cidr", "must be an IPv4 network in CIDR notation (e.g. 192.168.1.0/24)")
+	case ipnet.IP.To4() == nil:
+		ve.add("cidr", "only IPv4 networks are supported")
+	default:
+		ones, bits := ipnet.Mask.Size()
+		size := 1 << (bits - ones)
+		count := size
+		if size > 2 {
+			count -= 2
+		}
+		if count > maxDiscoveryHosts {
+			ve.add("cidr", "network is too large (at most %d addresses per scan)", maxDiscoveryHosts)
+			break
+		}
+		start := ipnet.IP.To4()
+		first := 0
+		if size > 2 {
+			first = 1
+		}
+		for i := first; i < first+count; i++ {
+			ip := make(net.IP, net.IPv4len)
+			n := uint32(start[0])<<24 | uint32(start[1])<<16 | uint32(start[2])<<8 | uint32(start[3]) + uint32(i)
+			ip[0], ip[1], ip[2], ip[3] = byte(n>>24), byte(n>>16), byte(n>>8), byte(n)
+			hosts = append(hosts, ip)
+		}
+	}
+
+	if len(ve.Errors) > 0 {
+		return nil, ve
+	}
+	return hosts, nil
+}
+
+// runDiscovery は、アドレスを並行して確認し、結果を scan と登録待ちの候補に記録します。
+func runDiscovery(scan *DiscoveryScan, hosts []net.IP) {
+	// 登録済みのホスト (種別が host のターゲット) は、候補に追加しない
+	registered := map[string]string{}
+	if targets, err := ListMonitorTargets(); err != nil {
+		log.Printf("[ERROR] Discovery scan %s: failed to list targets: %v", scan.ID, err)
+	} else {
+		for _, t := range targets {
+			if t.Type == "host" {
+				registered[t.HostIP] = t.Name
+			}
+		}
+	}
+
+	ips := make(chan net.IP)
+	var wg sync.WaitGroup
+	for i := 0; i < discoveryConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range ips {
+				pending := probeAgent(ip.String(), scan.Ports)
+
+				discovery.Lock()
+				scan.Scanned++
+				if pending != nil {
+					if name, ok := registered[pending.HostIP]; ok {
+						scan.Registered = append(scan.Registered, name)
+					} else {
+						pending.ScanID = scan.ID
+						discovery.pending[pending.HostIP] = pending
+						scan.Found = append(scan.Found, pending.HostIP)
+					}
+				}
+				discovery.Unlock()
+			}
+		}()
+	}
+	for _, ip := range hosts {
+		ips <- ip
+	}
+	close(ips)
+	wg.Wait()
+
+	discovery.Lock()
+	now := time.Now()
+	scan.Status = ScanCompleted
+	scan.FinishedAt = &now
+	sort.Slice(scan.Found, func(i, j int) bool { return compareIP(scan.Found[i], scan.Found[j]) < 0 })
+	sort.Strings(scan.Registered)
+	log.Printf("[SUCCESS] Discovery scan %s finished: %d found, %d already registered", scan.ID, len(scan.Found), len(scan.Registered))
+	discovery.Unlock()
+}
+
+// probeAgent は、ip の ports を順に確認し、最初に応答した power_agent の情報から登録待ちの候補を作成します。
+// いずれのポートでも power_agent が応答しない場合は nil を返します。
+func probeAgent(ip string, ports []string) *PendingTarget {
+	for _, port := range ports {
+		address := net.JoinHostPort(ip, port)
+		conn, err := net.DialTimeout("tcp", address, discoveryDialTimeout)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		info, err := fetchAgentInfo(address)
+		if err != nil {
+			// power_agent 以外のサービス、または /info のない古い power_agent
+			log.Printf("[INFO] Discovery: %s is listening but is not a power_agent with /info: %v", address, err)
+			continue
+		}
+		return newPendingTarget(ip, port, info)
+	}
+	return nil
+}
+
+// fetchAgentInfo は、エージェントの /info からホスト名とネットワークインターフェースの情報を取得します。
+func fetchAgentInfo(address string) (*agentInfo, error) {
+	resp, err := getFromAgent("http://"+address+"/info", discoveryInfoTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent /info returned status code: %d", resp.StatusCode)
+	}
+	info := &agentInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, fmt.Errorf("failed to decode /info: %v", err)
+	}
+	if info.Agent != discoveryAgentIdentity {
+		return nil, fmt.Errorf("unexpected agent %q in /info", info.Agent)
+	}
+	return info, nil
+}
+
+// newPendingTarget は、/info の情報から登録待ちの候補を作成します。
+// MAC アドレスとブロードキャストアドレスは、探索したアドレスを持つインターフェースから求めます。
+// NAT の内側などで該当するインターフェースがない場合は、最初のインターフェースの MAC アドレスのみを設定します。
+func newPendingTarget(ip, port string, info *agentInfo) *PendingTarget {
+	p := &PendingTarget{
+		HostIP:        ip,
+		Port:          port,
+		Name:          suggestTargetName(info.Hostname, ip),
+		Hostname:      info.Hostname,
+		PrivilegeMode: info.PrivilegeMode,
+		Interfaces:    info.Interfaces,
+		DiscoveredAt:  time.Now(),
+	}
+	if p.Interfaces == nil {
+		p.Interfaces = []AgentInterface{}
+	}
+
+	target := net.ParseIP(ip)
+	for _, iface := range info.Interfaces {
+		for _, cidr := range iface.IPs {
+			addr, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil || !addr.Equal(target) {
+				continue
+			}
+			p.MacAddress = iface.MAC
+			if ip4 := addr.To4(); ip4 != nil && len(ipnet.Mask) == net.IPv4len {
+				bcast := make(net.IP, net.IPv4len)
+				for i := range bcast {
+					bcast[i] = ip4[i] | ^ipnet.Mask[i]
+				}
+				p.BroadcastIP = bcast.String()
+			}
+			return p
+		}
+	}
+	if len(info.Interfaces) > 0 {
+		p.MacAddress = info.Interfaces[0].MAC
+	}
+	return p
+}
+
+// suggestTargetName は、ホスト名のドメインを除いた部分をターゲット名の候補として返します。
+// ホスト名が取得できない場合は、アドレスから "host-192-168-1-10" のような名前を作成します。
+func suggestTargetName(hostname, ip string) string {
+	name, _, _ := strings.Cut(hostname, ".")
+	if name == "" {
+		name = "host-" + strings.ReplaceAll(ip, ".", "-")
+	}
+	return name
+}
+
+// compareIP は、2つの IP アドレスの文字列をアドレスの順に比較します。
+func compareIP(a, b string) int {
+	return bytes.Compare(net.ParseIP(a).To16(), net.ParseIP(b).To16())
+}
+
+// ListDiscoveryScans は、保持している探索の結果を新しい順に返します。
+func ListDiscoveryScans() []DiscoveryScan {
+	discovery.Lock()
+	defer discovery.Unlock()
+	result := make([]DiscoveryScan, 0, len(discovery.scans))
+	for i := len(discovery.scans) - 1; i >= 0; i-- {
+		result = append(result, copyScan(discovery.scans[i]))
+	}
+	return result
+}
+
+// GetDiscoveryScan は、指定された探索の進捗と結果を返します。
+func GetDiscoveryScan(id string) (*DiscoveryScan, error) {
+	discovery.Lock()
+	defer discovery.Unlock()
+	for _, s := range discovery.scans {
+		if s.ID == id {
+			c := copyScan(s)
+			return &c, nil
+		}
+	}
+	return nil, withKind(ErrNotFound, fmt.Errorf("discovery scan '%s' not found", id))
+}
+
+// ListPendingTargets は、登録待ちの候補をアドレス順に返します。
+func ListPendingTargets() []PendingTarget {
+	discovery.Lock()
+	defer discovery.Unlock()
+	result := make([]PendingTarget, 0, len(discovery.pending))
+	for _, p := range discovery.pending {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool { return compareIP(result[i].HostIP, result[j].HostIP) < 0 })
+	return result
+}
+
+// AcceptPendingTarget は、登録待ちの候補をターゲットとして登録し、候補から削除します。
+// 候補の情報 (種別は host) に patch の JSON で指定した項目 (name、tags、ssh_user など) を上書きしてから登録します。
+// 同じ名前のターゲットが既に存在する場合は、上書きせずに ErrConflict を返します。
+func AcceptPendingTarget(hostIP string, patch []byte) (*MonitorTarget, error) {
+	// DB への保存中に探索や一覧の取得を止めないよう、候補をコピーしてからロックを解放する
+	discovery.Lock()
+	entry, ok := discovery.pending[hostIP]
+	var p PendingTarget
+	if ok {
+		p = *entry
+	}
+	discovery.Unlock()
+	if !ok {
+		return nil, withKind(ErrNotFound, fmt.Errorf("pending target '%s' not found", hostIP))
+	}
+
+	config := &MonitorTarget{
+		Name:        p.Name,
+		Type:        "host",
+		HostIP:      p.HostIP,
+		Port:        p.Port,
+		MacAddress:  p.MacAddress,
+		BroadcastIP: p.BroadcastIP,
+	}
+	if len(bytes.TrimSpace(patch)) > 0 {
+		if err := json.Unmarshal(patch, config); err != nil {
+			return nil, withKind(ErrInvalid, fmt.Errorf("invalid JSON format: %v", err))
+		}
+	}
+
+	if _, err := GetTargetConfig(config.Name); err == nil {
+		return nil, withKind(ErrConflict, fmt.Errorf("target '%s' already exists (specify another name)", config.Name))
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err := SaveMonitorTarget(config); err != nil {
+		return nil, err
+	}
+
+	// 保存中に再度の探索で候補が置き換えられた場合は、新しい候補を残す
+	discovery.Lock()
+	if discovery.pending[hostIP] == entry {
+		delete(discovery.pending, hostIP)
+	}
+	discovery.Unlock()
+	log.Printf("[INFO] Pending target %s accepted as '%s'", hostIP, config.Name)
+	return config, nil
+}
+
+// DismissPendingTarget は、登録しない候補を削除します。再度探索すると、候補に追加し直されます。
+func DismissPendingTarget(hostIP string) error {
+	discovery.Lock()
+	defer discovery.Unlock()
+	if _, ok := discovery.pending[hostIP]; !ok {
+		return withKind(ErrNotFound, fmt.Errorf("pending target '%s' not found", hostIP))
+	}
+	delete(discovery.pending, hostIP)
+	return nil
+}
+
+// ディスカバリ END===========================================================END
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateDiscovery(t *testing.T) {
+	for _, c := range []struct {
+		cidr        string
+		ports       []string
+		count       int
+		first, last string
+		fields      []string // 誤りのある項目
+	}{
+		{"192.168.1.0/24", []string{"8080"}, 254, "192.168.1.1", "192.168.1.254", nil},
+		{"192.168.1.77/24", []string{"8080"}, 254, "192.168.1.1", "192.168.1.254", nil}, // ホスト部は無視する
+		{"10.0.0.0/30", []string{"8080"}, 2, "10.0.0.1", "10.0.0.2", nil},
+		{"10.0.0.4/31", []string{"8080"}, 2, "10.0.0.4", "10.0.0.5", nil},
+		{"10.0.0.9/32", []string{"8080"}, 1, "10.0.0.9", "10.0.0.9", nil},
+		{"10.0.0.0/20", []string{"8080"}, 4094, "10.0.0.1", "10.0.15.254", nil},
+		{"10.0.0.0/19", []string{"8080"}, 0, "", "", []string{"cidr"}},
+		{"", []string{"8080"}, 0, "", "", []string{"cidr"}},
+		{"192.168.1.0", []string{"8080"}, 0, "", "", []string{"cidr"}},
+		{"fd00::/120", []string{"8080"}, 0, "", "", []string{"cidr"}},
+		{"192.168.1.0/24", []string{"8080", "0", "http"}, 0, "", "", []string{"ports[1]", "ports[2]"}},
+		{"bogus", []string{"70000"}, 0, "", "", []string{"ports[0]", "cidr"}},
+	} {
+		hosts, err := validateDiscovery(c.cidr, c.ports)
+		if c.fields != nil {
+			var ve *ValidationError
+			if !errors.As(err, &ve) || !errors.Is(err, ErrInvalid) {
+				t.Errorf("%q %v: err = %v, want a validation error", c.cidr, c.ports, err)
+				continue
+			}
+			var fields []string
+			for _, fe := range ve.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if !slices.Equal(fields, c.fields) {
+				t.Errorf("%q %v: fields = %q, want %q", c.cidr, c.ports, fields, c.fields)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.cidr, err)
+			continue
+		}
+		if len(hosts) != c.count || hosts[0].String() != c.first || hosts[len(hosts)-1].String() != c.last {
+			t.Errorf("%q: %d hosts %s..%s, want %d hosts %s..%s", c.cidr, len(hosts), hosts[0], hosts[len(hosts)-1], c.count, c.first, c.last)
+		}
+	}
+}
+
+func TestNewPendingTarget(t *testing.T) {
+	ifaces := []AgentInterface{
+		{Name: "lo", MAC: "", IPs: []string{"127.0.0.1/8"}},
+		{Name: "eth0", MAC: "52:54:00:00:00:01", IPs: []string{"fd00::10/64", "192.168.10.20/26"}},
+		{Name: "eth1", MAC: "52:54:00:00:00:02", IPs: []string{"10.1.2.3/16", "fd00::20/64"}},
+	}
+	for _, c := range []struct {
+		ip, hostname           string
+		interfaces             []AgentInterface
+		name, mac, broadcastIP string
+	}{
+		// 探索したアドレスを持つインターフェースのサブネットからブロードキャストアドレスを求める
+		{"192.168.10.20", "web01.example.com", ifaces, "web01", "52:54:00:00:00:01", "192.168.10.63"},
+		{"10.1.2.3", "db01", ifaces, "db01", "52:54:00:00:00:02", "10.1.255.255"},
+		// IPv6 にはブロードキャストアドレスがない
+		{"fd00::20", "db01", ifaces, "db01", "52:54:00:00:00:02", ""},
+		// NAT の内側などで一致するインターフェースがない場合は最初のインターフェースの MAC アドレスのみ
+		{"203.0.113.5", "", ifaces, "host-203-0-113-5", "", ""},
+		{"203.0.113.5", "nat01", ifaces[1:], "nat01", "52:54:00:00:00:01", ""},
+		{"203.0.113.6", "", nil, "host-203-0-113-6", "", ""},
+	} {
+		p := newPendingTarget(c.ip, "8080", &agentInfo{Agent: discoveryAgentIdentity, Hostname: c.hostname, Interfaces: c.interfaces})
+		if p.Name != c.name || p.MacAddress != c.mac || p.BroadcastIP != c.broadcastIP || p.HostIP != c.ip || p.Port != "8080" {
+			t.Errorf("%s (%s): name %q, mac %q, broadcast %q, want %q, %q, %q", c.ip, c.hostname, p.Name, p.MacAddress, p.BroadcastIP, c.name, c.mac, c.broadcastIP)
+		}
+		if p.Interfaces == nil {
+			t.Errorf("%s: interfaces = nil, want an empty list", c.ip)
+		}
+	}
+}
+
+// agentInfoHandler は、/info で agent の値を返すテスト用のエージェントです。
+func agentInfoHandler(agent string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/info" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(agentInfo{
+			Agent:      agent,
+			Hostname:   "found01.example.com",
+			Interfaces: []AgentInterface{{Name: "lo", MAC: "52:54:00:00:00:09", IPs: []string{"127.0.0.1/8"}}},
+		})
+	})
+}
+
+// testPort は、startTestServer で起動したサーバのポートを返します。
+func testPort(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	_, port, _ := net.SplitHostPort(startTestServer(t, handler, false))
+	return port
+}
+
+func TestProbeAgent(t *testing.T) {
+	agent := testPort(t, agentInfoHandler(discoveryAgentIdentity))
+	other := testPort(t, agentInfoHandler("node_exporter"))
+	noInfo := testPort(t, http.NotFoundHandler())
+	closed := closedPort(t)
+
+	// 応答しないポートと power_agent 以外のサービスは飛ばし、最初に応答した power_agent を候補とする
+	p := probeAgent("127.0.0.1", []string{closed, other, noInfo, agent})
+	if p == nil {
+		t.Fatal("power_agent was not found")
+	}
+	if p.Port != agent || p.Name != "found01" || p.MacAddress != "52:54:00:00:00:09" || p.BroadcastIP != "127.255.255.255" {
+		t.Errorf("pending = %+v", p)
+	}
+
+	if p := probeAgent("127.0.0.1", []string{closed, other, noInfo}); p != nil {
+		t.Errorf("pending = %+v, want nil without a power_agent", p)
+	}
+}
+
+// addPending は、登録待ちの候補を追加し、テストの終了時に削除します。
+func addPending(t *testing.T, p *PendingTarget) {
+	t.Helper()
+	discovery.Lock()
+	discovery.pending[p.HostIP] = p
+	discovery.Unlock()
+	t.Cleanup(func() {
+		discovery.Lock()
+		delete(discovery.pending, p.HostIP)
+		discovery.Unlock()
+	})
+}
+
+// isPending は、hostIP が登録待ちの候補に残っているかを返します。
+func isPending(hostIP string) bool {
+	return slices.ContainsFunc(ListPendingTargets(), func(p PendingTarget) bool { return p.HostIP == hostIP })
+}
+
+func TestAcceptPendingTarget(t *testing.T) {
+	newTestDB(t)
+	saveTestTarget(t, &MonitorTarget{Name: "taken01", Type: "host", HostIP: "192.168.20.9", Port: "8080"})
+	addPending(t, &PendingTarget{HostIP: "192.168.20.10", Port: "8080", Name: "taken01", MacAddress: "52:54:00:00:00:10", BroadcastIP: "192.168.20.255"})
+
+	// 同じ名前のターゲットがある場合は上書きせず、候補を残す
+	if _, err := AcceptPendingTarget("192.168.20.10", nil); !errors.Is(err, ErrConflict) {
+		t.Errorf("accept with an existing name: err = %v, want ErrConflict", err)
+	}
+	if _, err := AcceptPendingTarget("192.168.20.10", []byte(`{"name":"new01","port":"70000"}`)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("accept with an invalid port: err = %v, want ErrInvalid", err)
+	}
+	if !isPending("192.168.20.10") {
+		t.Fatal("pending target was removed although it was not accepted")
+	}
+
+	config, err := AcceptPendingTarget("192.168.20.10", []byte(`{"name":"new01","tags":["web"]}`))
+	if err != nil {
+		t.Fatalf("AcceptPendingTarget: %v", err)
+	}
+	saved, err := GetTargetConfig("new01")
+	if err != nil {
+		t.Fatalf("GetTargetConfig: %v", err)
+	}
+	if saved.Type != "host" || saved.HostIP != "192.168.20.10" || saved.MacAddress != "52:54:00:00:00:10" || saved.BroadcastIP != "192.168.20.255" || strings.Join(saved.Tags, ",") != "web" {
+		t.Errorf("saved target = %+v", saved)
+	}
+	if config.Name != "new01" {
+		t.Errorf("returned target name = %q", config.Name)
+	}
+	if isPending("192.168.20.10") {
+		t.Error("accepted target is still pending")
+	}
+
+	if _, err := AcceptPendingTarget("192.168.20.10", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("accept twice: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Dockerドライバ START===========================================================START
+
+// defaultDockerHost は docker_host も環境変数 DOCKER_HOST も未指定の場合の接続先です。
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerStopTimeout は stop/restart 時にコンテナの終了を待つ秒数です。
+const dockerStopTimeout = "10"
+
+// dockerDriver は、Docker Engine API でコンテナを start/stop/restart するドライバです。
+// container ターゲットの既定ドライバで、状態はエージェントではなくエンジンの inspect 結果から判定します。
+type dockerDriver struct{}
+
+func init() {
+	RegisterPowerDriver("docker", &dockerDriver{})
+}
+
+// dockerClient は、1つの Docker Engine への接続です。
+type dockerClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+// newDockerClient は docker_host から Docker Engine API クライアントを生成します。
+// unix:// はソケットへ、tcp:// は http:// として接続します。
+func newDockerClient(config *MonitorTarget) (*dockerClient, error) {
+	host := config.DockerHost
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker_host '%s': %v", host, err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	client := &dockerClient{http: &http.Client{Timeout: 30 * time.Second, Transport: transport}}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		client.baseURL = "http://docker"
+	case "tcp", "http":
+		client.baseURL = "http://" + u.Host
+	case "https":
+		client.baseURL = "https://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported docker_host scheme: %s", u.Scheme)
+	}
+	return client, nil
+}
+
+// do は Docker Engine API にリクエストを送信し、ステータスコードと本文を返します。
+func (c *dockerClient) do(method, path string) (int, []byte, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("docker request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("failed to read docker response: %v", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// dockerContainerState は /containers/{id}/json の State です。
+type dockerContainerState struct {
+	Status  string `json:"Status"` // "created", "running", "paused", "restarting", "removing", "exited", "dead"
+	Running bool   `json:"Running"`
+	Health  *struct {
+		Status string `json:"Status"` // "starting", "healthy", "unhealthy"
+	} `json:"Health"`
+}
+
+// inspect はコンテナの状態を取得します。
+func (c *dockerClient) inspect(container string) (*dockerContainerState, error) {
+	code, body, err := c.do(http.MethodGet, "/containers/"+url.PathEscape(container)+"/json")
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, dockerError(code, body)
+	}
+
+	var info struct {
+		State dockerContainerState `json:"State"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("failed to decode docker inspect response: %v", err)
+	}
+	return &info.State, nil
+}
+
+// dockerError は Docker Engine API のエラー応答 ({"message": "..."}) をエラーに変換します。
+func dockerError(code int, body []byte) error {
+	var e struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Message != "" {
+		return fmt.Errorf("docker API returned status code %d: %s", code, e.Message)
+	}
+	return fmt.Errorf("docker API returned status code %d", code)
+}
+
+// containerName は、操作対象のコンテナ名またはIDを返します。
+func containerName(config *MonitorTarget) string {
+	if config.ContainerID != "" {
+		return config.ContainerID
+	}
+	return config.Name
+}
+
+// Validate は docker_host の形式を確認します。
+func (d *dockerDriver) Validate(config *MonitorTarget) error {
+	if config.DockerHost == "" {
+		return nil
+	}
+	_, err := newDockerClient(config)
+	return err
+}
+
+func (d *dockerDriver) Start(config *MonitorTarget, _ PowerOptions) (string, error) {
+	return d.action(config, "start", "/start")
+}
+
+func (d *dockerDriver) Stop(config *MonitorTarget, opts PowerOptions) (string, error) {
+	if opts.Delay > 0 {
+		return "", fmt.Errorf("delayed shutdown is not supported by docker driver")
+	}
+	if opts.Force {
+		return d.action(config, "kill", "/kill")
+	}
+	return d.action(config, "stop", "/stop?t="+dockerStopTimeout)
+}
+
+func (d *dockerDriver) Reboot(config *MonitorTarget, _ PowerOptions) (string, error) {
+	return d.action(config, "restart", "/restart?t="+dockerStopTimeout)
+}
+
+// Status は、エンジンの inspect 結果からコンテナの状態を返します。
+func (d *dockerDriver) Status(config *MonitorTarget) string {
+	client, err := newDockerClient(config)
+	if err != nil {
+		log.Printf("[ERROR] Health check: %v", err)
+		return StatusUnknown
+	}
+	state, err := client.inspect(containerName(config))
+	if err != nil {
+		log.Printf("[INFO] Health check: docker container '%s' inspect failed: %v", containerName(config), err)
+		return StatusUnknown
+	}
+
+	log.Printf("[INFO] Health check: docker container '%s' is %s", containerName(config), state.Status)
+	switch state.Status {
+	case "running":
+		return StatusRunning
+	case "created", "exited", "dead":
+		return StatusUnreachable
+	default:
+		return StatusUnknown
+	}
+}
+
+// Capabilities は、エンジンに接続してコンテナが存在すれば start/stop/reboot を利用可能とします。
+func (d *dockerDriver) Capabilities(config *MonitorTarget) *PowerCapabilities {
+	caps := &PowerCapabilities{Actions: []string{}}
+	client, err := newDockerClient(config)
+	if err != nil {
+		log.Printf("[INFO] Docker capabilities unavailable for '%s': %v", config.Name, err)
+		return caps
+	}
+	if _, err := client.inspect(containerName(config)); err != nil {
+		log.Printf("[INFO] Docker capabilities unavailable for '%s': %v", config.Name, err)
+		return caps
+	}
+	caps.Actions = append(caps.Actions, "start", "stop", "reboot")
+	return caps
+}
+
+// action は /containers/{id}<path> に POST し、結果をログに記録します。
+// 304 (既に起動済み/停止済み) は成功として扱います。
+func (d *dockerDriver) action(config *MonitorTarget, name string, path string) (string, error) {
+	client, err := newDockerClient(config)
+	if err != nil {
+		return "", err
+	}
+
+	container := containerName(config)
+	code, body, err := client.do(http.MethodPost, "/containers/"+url.PathEscape(container)+path)
+	if err != nil {
+		log.Printf("[ERROR] docker %s failed for '%s': %v", name, config.Name, err)
+		return "", err
+	}
+
+	switch code {
+	case http.StatusNoContent, http.StatusOK:
+		log.Printf("[INFO] docker %s succeeded for '%s'", name, config.Name)
+		return fmt.Sprintf("Container '%s' %s request accepted by docker engine", container, name), nil
+	case http.StatusNotModified:
+		log.Printf("[INFO] docker %s skipped for '%s': already in desired state", name, config.Name)
+		return fmt.Sprintf("Container '%s' is already in the requested state", container), nil
+	default:
+		err := dockerError(code, body)
+		log.Printf("[ERROR] docker %s failed for '%s': %v", name, config.Name, err)
+		return "", err
+	}
+}
+
+// Dockerドライバ END===========================================================END
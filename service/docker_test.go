@@ -0,0 +1,137 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testDockerEngine は、/containers/{id}/start|stop|restart|json を提供するテスト用の Docker Engine API です。
+type testDockerEngine struct {
+	mu         sync.Mutex
+	containers map[string]string // コンテナ名 → State.Status
+	requests   requestLog        // 受け付けた操作 ("stop?t=10" など)
+}
+
+func (e *testDockerEngine) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		status, ok := e.containers[r.PathValue("id")]
+		if !ok {
+			e.notFound(w, r.PathValue("id"))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"State": map[string]interface{}{"Status": status, "Running": status == "running"},
+		})
+	})
+	mux.HandleFunc("POST /containers/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		id, action := r.PathValue("id"), r.PathValue("action")
+		e.requests.add(action + "?" + r.URL.RawQuery)
+		status, ok := e.containers[id]
+		if !ok {
+			e.notFound(w, id)
+			return
+		}
+		switch {
+		case action == "start" && status == "running", action == "stop" && status != "running":
+			w.WriteHeader(http.StatusNotModified)
+		case action == "start", action == "restart":
+			e.containers[id] = "running"
+			w.WriteHeader(http.StatusNoContent)
+		case action == "stop", action == "kill":
+			e.containers[id] = "exited"
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	return mux
+}
+
+// notFound は、Docker Engine API と同じ形式の 404 応答を返します。
+func (e *testDockerEngine) notFound(w http.ResponseWriter, id string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(map[string]string{"message": "No such container: " + id})
+}
+
+// newTestDockerEngine は、unix ソケットで待ち受けるテスト用エンジンと、そのエンジンを使用するターゲットの設定を返します。
+func newTestDockerEngine(t *testing.T) (*testDockerEngine, *MonitorTarget) {
+	t.Helper()
+	engine := &testDockerEngine{containers: map[string]string{"web": "exited"}}
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(engine.handler())
+	server.Listener = ln
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return engine, &MonitorTarget{Name: "web", Type: "container", DockerHost: "unix://" + socket}
+}
+
+func TestDockerStartStopRestart(t *testing.T) {
+	engine, config := newTestDockerEngine(t)
+
+	// 既に要求した状態の場合、Engine API は 304 を返す
+	checkPowerCalls(t, &dockerDriver{}, config, engine.requests.all, []powerCall{
+		{name: "start", call: callStart, want: "start?", message: "request accepted"},
+		{name: "start again", call: callStart, want: "start?", message: "already in the requested state"},
+		{name: "restart", call: callReboot, want: "restart?t=10", message: "request accepted"},
+		{name: "stop", call: callStop, want: "stop?t=10", message: "request accepted"},
+		{name: "stop again", call: callStop, want: "stop?t=10", message: "already in the requested state"},
+	})
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	if status := engine.containers["web"]; status != "exited" {
+		t.Errorf("container status = %q, want exited", status)
+	}
+}
+
+func TestDockerStatus(t *testing.T) {
+	engine, config := newTestDockerEngine(t)
+	for _, c := range []struct{ state, want string }{
+		{"running", StatusRunning},
+		{"created", StatusUnreachable},
+		{"exited", StatusUnreachable},
+		{"dead", StatusUnreachable},
+		{"paused", StatusUnknown},
+		{"restarting", StatusUnknown},
+	} {
+		engine.mu.Lock()
+		engine.containers["web"] = c.state
+		engine.mu.Unlock()
+		if got := (&dockerDriver{}).Status(config); got != c.want {
+			t.Errorf("State.Status %s: status = %s, want %s", c.state, got, c.want)
+		}
+	}
+}
+
+func TestDockerContainerNotFound(t *testing.T) {
+	_, config := newTestDockerEngine(t)
+	config.ContainerID = "missing"
+	d := &dockerDriver{}
+
+	if _, err := d.Start(config, PowerOptions{}); err == nil || !strings.Contains(err.Error(), "404: No such container: missing") {
+		t.Errorf("start of missing container: err = %v", err)
+	}
+	if got := d.Status(config); got != StatusUnknown {
+		t.Errorf("status of missing container = %s, want %s", got, StatusUnknown)
+	}
+	if caps := d.Capabilities(config); len(caps.Actions) != 0 {
+		t.Errorf("capabilities of missing container = %v, want none", caps.Actions)
+	}
+}
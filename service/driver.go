@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// 電源ドライバ START===========================================================START
+
+// PowerDriver は、ターゲットの電源制御方式を表すインターフェースです。
+// 新しいハードウェアに対応する場合は、このインターフェースを実装して RegisterPowerDriver で登録します。
+type PowerDriver interface {
+	// Start はターゲットの電源を入れます。
+	Start(config *MonitorTarget, opts PowerOptions) (string, error)
+	// Stop はターゲットの電源を切ります。
+	Stop(config *MonitorTarget, opts PowerOptions) (string, error)
+	// Reboot はターゲットを再起動します。
+	Reboot(config *MonitorTarget, opts PowerOptions) (string, error)
+	// Status はターゲットの状態 (StatusRunning, StatusAgentDown, StatusUnreachable, StatusUnknown) を返します。
+	Status(config *MonitorTarget) string
+	// Capabilities はターゲットで実行可能な電源操作を返します。
+	Capabilities(config *MonitorTarget) *PowerCapabilities
+}
+
+// ActionDriver は、start/stop/reboot 以外の電源操作 (cancel, suspend, hibernate など) に対応するドライバが実装します。
+type ActionDriver interface {
+	Action(action string, config *MonitorTarget, opts PowerOptions) (string, error)
+}
+
+// AddressDriver は、死活監視の接続先がターゲットの host_ip:port と異なるドライバが実装します。
+// /status の host_port には Address の値を返します。
+type AddressDriver interface {
+	Address(config *MonitorTarget) string
+}
+
+// ConfigValidator は、ドライバ固有の必須項目をターゲット登録時に検証するドライバが実装します。
+type ConfigValidator interface {
+	Validate(config *MonitorTarget) error
+}
+
+// DefaultPowerDriver は power_driver が未指定の host ターゲットで使用するドライバ名です。
+const DefaultPowerDriver = "wol+agent"
+
+// ドライバのレジストリ
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]PowerDriver{}
+)
+
+// RegisterPowerDriver は、電源ドライバを名前で登録します。各ドライバの init から呼び出します。
+func RegisterPowerDriver(name string, driver PowerDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, exists := drivers[name]; exists {
+		panic(fmt.Sprintf("power driver '%s' is already registered", name))
+	}
+	drivers[name] = driver
+}
+
+// GetPowerDriver は、登録済みの電源ドライバを名前で取得します。
+func GetPowerDriver(name string) (PowerDriver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	driver, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown power driver: %s", name)
+	}
+	return driver, nil
+}
+
+// PowerDriverNames は、登録済みの電源ドライバ名を昇順で返します。
+func PowerDriverNames() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultDriverForType は、power_driver が未指定の場合にターゲット種別から選ぶドライバ名です。
+var defaultDriverForType = map[string]string{
+	"host":      DefaultPowerDriver,
+	"container": "docker",
+	"vm":        "libvirt",
+}
+
+// DriverNameFor は、ターゲットに使用する電源ドライバ名を返します。
+// power_driver が指定されていればそれを、未指定であればターゲット種別の既定値を使用します。
+func DriverNameFor(config *MonitorTarget) (string, error) {
+	if config.PowerDriver != "" {
+		return config.PowerDriver, nil
+	}
+	if name, ok := defaultDriverForType[config.Type]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("no power driver configured for target '%s' of type '%s'", config.Name, config.Type)
+}
+
+// driverFor は、ターゲットに使用する電源ドライバを返します。
+func driverFor(config *MonitorTarget) (PowerDriver, string, error) {
+	name, err := DriverNameFor(config)
+	if err != nil {
+		return nil, "", err
+	}
+	driver, err := GetPowerDriver(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return driver, name, nil
+}
+
+// 電源ドライバ END===========================================================END
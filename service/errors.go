@@ -0,0 +1,46 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+// エラーの種類 START===========================================================START
+
+// サービス層が返すエラーの種類です。API 層は errors.Is でこれらを判定し、HTTP ステータスとエラーコードに変換します。
+// メッセージは元のエラーのまま変えずに、種類だけを付与します。
+var (
+	ErrNotFound    = errors.New("not found")           // ターゲットなどが存在しない
+	ErrInvalid     = errors.New("invalid")             // 設定の検証に失敗した、または対応していない操作
+	ErrConflict    = errors.New("conflict")            // 現在の状態と矛盾する (同じ電源操作が進行中など)
+	ErrUnavailable = errors.New("service unavailable") // DB が利用できない
+)
+
+// kindError は、エラーに種類を付与します。Error() は元のエラーのメッセージを返します。
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// withKind は、err に種類 kind を付与します。err が nil の場合は nil を返します。
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// errNoDB は、DB 接続が初期化されていない場合のエラーです。
+func errNoDB() error {
+	return withKind(ErrUnavailable, fmt.Errorf("database connection not initialized"))
+}
+
+// errTargetNotFound は、ターゲットが存在しない場合のエラーです。
+func errTargetNotFound(name string) error {
+	return withKind(ErrNotFound, fmt.Errorf("target '%s' not found in database", name))
+}
+
+// エラーの種類 END===========================================================END
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// イベント配信 START===========================================================START
+
+// イベントの種別。SSE の event フィールドに使用します。
+const (
+	EventStatus = "status" // 確定した状態変化 (StatusTransition)
+	EventPower  = "power"  // 電源操作の進捗 (PowerEvent)
+	EventAlert  = "alert"  // 利用者に通知すべき異常 (Alert)
+)
+
+// defaultEventBufferSize は、再接続時に再送できるイベント数の既定値です (EVENT_BUFFER_SIZE)。
+const defaultEventBufferSize = 256
+
+// Event は、/events で配信する1件のイベントです。
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// PowerEvent は、電源操作の進捗です。
+type PowerEvent struct {
+	Target  string    `json:"target"`
+	Action  string    `json:"action"`
+	Phase   string    `json:"phase"` // "started", "succeeded", "failed"
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Alert は、ターゲットの異常の通知です。
+type Alert struct {
+	Target  string    `json:"target"`
+	Level   string    `json:"level"` // "warning", "critical"
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// eventBroker は、イベントを購読者へ配信し、直近のイベントをリングバッファに保持します。
+type eventBroker struct {
+	mu     sync.Mutex
+	nextID uint64
+	ring   []Event // 古い順。len(ring) <= size
+	size   int
+	subs   map[chan Event]struct{}
+}
+
+var events = &eventBroker{
+	nextID: 1,
+	size:   envInt("EVENT_BUFFER_SIZE", defaultEventBufferSize),
+	subs:   make(map[chan Event]struct{}),
+}
+
+// PublishEvent は、イベントに ID を採番してすべての購読者へ配信します。
+// 受信が追いつかない購読者へのイベントは破棄します。
+func PublishEvent(eventType string, data interface{}) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	ev := Event{ID: events.nextID, Type: eventType, Data: data}
+	events.nextID++
+
+	if len(events.ring) >= events.size {
+		events.ring = append(events.ring[:0], events.ring[1:]...)
+	}
+	events.ring = append(events.ring, ev)
+
+	for ch := range events.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// SubscribeEvents は、イベントの購読を開始します。
+// lastID より後のイベントのうちバッファに残っているものを backlog として返します。
+// lastID の次のイベントがすでにバッファから消えている (または lastID が未知の) 場合は complete に false を返します。
+// 購読をやめるときは unsubscribe を呼び出してください。
+func SubscribeEvents(lastID uint64) (ch <-chan Event, backlog []Event, complete bool, unsubscribe func()) {
+	c := make(chan Event, 64)
+
+	events.mu.Lock()
+	complete = true
+	if lastID > 0 {
+		if lastID >= events.nextID {
+			// サーバの再起動などで ID が巻き戻っている
+			complete = false
+		} else if len(events.ring) > 0 && events.ring[0].ID > lastID+1 {
+			complete = false
+		}
+		for _, ev := range events.ring {
+			if ev.ID > lastID {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+	events.subs[c] = struct{}{}
+	events.mu.Unlock()
+
+	unsubscribe = func() {
+		events.mu.Lock()
+		delete(events.subs, c)
+		events.mu.Unlock()
+	}
+	return c, backlog, complete, unsubscribe
+}
+
+// alertForTransition は、状態変化のうち通知が必要なものを Alert に変換します。
+func alertForTransition(t *StatusTransition) *Alert {
+	switch {
+	case t.flapStarted:
+		return &Alert{Target: t.Target, Level: "warning", Message: "target is flapping", At: t.At}
+	case isImmediateStatus(t.From) || isImmediateStatus(t.To):
+		// 電源操作やメンテナンスによる変化は通知しない
+		return nil
+	case t.To == StatusUnreachable || t.To == StatusAgentDown:
+		return &Alert{Target: t.Target, Level: "critical", Message: "status changed from " + t.From + " to " + t.To, At: t.At}
+	case t.To == StatusDegraded || t.To == StatusUnknown:
+		return &Alert{Target: t.Target, Level: "warning", Message: "status changed from " + t.From + " to " + t.To, At: t.At}
+	}
+	return nil
+}
+
+// イベント配信 END===========================================================END
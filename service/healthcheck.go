@@ -0,0 +1,360 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ヘルスチェック START===========================================================START
+
+// HealthCheck は、ターゲットごとに定義する追加のヘルスチェックです。
+// monitor_targets.checks に JSON 配列で保存します。
+type HealthCheck struct {
+	Name         string `json:"name,omitempty"`          // 表示名。省略時は type
+	Type         string `json:"type"`                    // "tcp", "icmp", "http", "tls", "dns"
+	Host         string `json:"host,omitempty"`          // tcp/icmp/tls の接続先。省略時は host_ip
+	Port         string `json:"port,omitempty"`          // tcp/tls のポート。省略時は tcp は port, tls は 443
+	URL          string `json:"url,omitempty"`           // http の URL。省略時は http://host_ip:port/
+	ExpectStatus int    `json:"expect_status,omitempty"` // http の期待ステータス。省略時は 200〜399
+	ExpectBody   string `json:"expect_body,omitempty"`   // http の応答本文に一致すべき正規表現
+	Insecure     bool   `json:"insecure,omitempty"`      // http/tls で証明書の検証を省略する
+	WarnDays     int    `json:"warn_days,omitempty"`     // tls の証明書期限がこの日数未満で失敗とする。省略時は14
+	Hostname     string `json:"hostname,omitempty"`      // dns で解決する名前 / tls の SNI
+	Expect       string `json:"expect,omitempty"`        // dns の解決結果に含まれるべきアドレス
+	Resolver     string `json:"resolver,omitempty"`      // dns で使用する DNS サーバ (host:port)。省略時はシステム設定
+	Privileged   bool   `json:"privileged,omitempty"`    // icmp で raw ソケットを使用する（root/CAP_NET_RAW が必要）
+	Timeout      int    `json:"timeout,omitempty"`       // タイムアウト (秒)。省略時は5
+}
+
+// HealthChecks は HealthCheck の一覧です。DB には JSON 文字列で保存します。
+type HealthChecks []HealthCheck
+
+// Scan は DB の JSON 文字列を HealthChecks に変換します。
+func (c *HealthChecks) Scan(src interface{}) error {
+	*c = nil
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported checks type: %T", src)
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, c)
+}
+
+// Value は HealthChecks を DB に保存する JSON 文字列に変換します。
+func (c HealthChecks) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// CheckResult は、1つのヘルスチェックの結果です。
+type CheckResult struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	OK        bool   `json:"ok"`
+	Message   string `json:"message"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// validateHealthChecks は、チェック定義の種別と必須項目を確認します。
+func validateHealthChecks(checks HealthChecks) error {
+	for i, c := range checks {
+		switch c.Type {
+		case "tcp", "icmp", "tls":
+		case "http":
+			if c.ExpectBody != "" {
+				if _, err := regexp.Compile(c.ExpectBody); err != nil {
+					return fmt.Errorf("checks[%d]: invalid expect_body: %v", i, err)
+				}
+			}
+		case "dns":
+			if c.Hostname == "" {
+				return fmt.Errorf("checks[%d]: hostname is required for dns check", i)
+			}
+		default:
+			return fmt.Errorf("checks[%d]: unknown check type '%s' (must be tcp, icmp, http, tls or dns)", i, c.Type)
+		}
+	}
+	return nil
+}
+
+// RunHealthChecks は、ターゲットに定義されたすべてのヘルスチェックを実行します。
+func RunHealthChecks(config *MonitorTarget) []CheckResult {
+	results := make([]CheckResult, 0, len(config.Checks))
+	for _, c := range config.Checks {
+		results = append(results, runHealthCheck(config, c))
+	}
+	return results
+}
+
+// runHealthCheck は1つのヘルスチェックを実行し、所要時間を計測します。
+func runHealthCheck(config *MonitorTarget, c HealthCheck) CheckResult {
+	name := c.Name
+	if name == "" {
+		name = c.Type
+	}
+	timeout := 5 * time.Second
+	if c.Timeout > 0 {
+		timeout = time.Duration(c.Timeout) * time.Second
+	}
+	host := c.Host
+	if host == "" {
+		host = config.HostIP
+	}
+
+	start := time.Now()
+	var message string
+	var err error
+	switch c.Type {
+	case "tcp":
+		port := c.Port
+		if port == "" {
+			port = config.Port
+		}
+		message, err = checkTCP(host, port, timeout)
+	case "icmp":
+		message, err = checkICMP(host, c.Privileged, timeout)
+	case "http":
+		url := c.URL
+		if url == "" {
+			url = fmt.Sprintf("http://%s/", net.JoinHostPort(config.HostIP, config.Port))
+		}
+		message, err = checkHTTP(url, c, timeout)
+	case "tls":
+		port := c.Port
+		if port == "" {
+			port = "443"
+		}
+		message, err = checkTLS(host, port, c, timeout)
+	case "dns":
+		message, err = checkDNS(c, timeout)
+	default:
+		err = fmt.Errorf("unknown check type '%s'", c.Type)
+	}
+
+	result := CheckResult{
+		Name:      name,
+		Type:      c.Type,
+		OK:        err == nil,
+		Message:   message,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Message = err.Error()
+		log.Printf("[INFO] Health check '%s' (%s) for '%s' failed: %v", name, c.Type, config.Name, err)
+	}
+	return result
+}
+
+// checkTCP は TCP 接続できるかを確認します。
+func checkTCP(host, port string, timeout time.Duration) (string, error) {
+	address := net.JoinHostPort(host, port)
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+	return fmt.Sprintf("connected to %s", address), nil
+}
+
+// checkICMP は ICMP Echo を送信し、応答を待ちます。
+// privileged でない場合は ICMP データグラムソケットを使用します（net.ipv4.ping_group_range の許可が必要）。
+func checkICMP(host string, privileged bool, timeout time.Duration) (string, error) {
+	addr, err := net.ResolveIPAddr("ip", host)
+	if err != nil {
+		return "", err
+	}
+
+	v4 := addr.IP.To4() != nil
+	network, listen, proto := "udp6", "::", 58
+	var echoType, replyType icmp.Type = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	if v4 {
+		network, listen, proto = "udp4", "0.0.0.0", 1
+		echoType, replyType = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	}
+	if privileged {
+		network = "ip6:ipv6-icmp"
+		if v4 {
+			network = "ip4:icmp"
+		}
+	}
+
+	conn, err := icmp.ListenPacket(network, listen)
+	if err != nil {
+		return "", fmt.Errorf("failed to open icmp socket: %v", err)
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	seq := int(time.Now().UnixNano() & 0xffff)
+	msg := icmp.Message{Type: echoType, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("srv_mng")}}
+	wb, err := msg.Marshal(nil)
+	if err != nil {
+		return "", err
+	}
+
+	var dst net.Addr = addr
+	if !privileged {
+		dst = &net.UDPAddr{IP: addr.IP, Zone: addr.Zone}
+	}
+	if _, err := conn.WriteTo(wb, dst); err != nil {
+		return "", fmt.Errorf("failed to send icmp echo: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	rb := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(rb)
+		if err != nil {
+			return "", fmt.Errorf("no icmp echo reply: %v", err)
+		}
+		reply, err := icmp.ParseMessage(proto, rb[:n])
+		if err != nil || reply.Type != replyType {
+			continue
+		}
+		// データグラムソケットではカーネルが ID を書き換えるため、シーケンス番号で照合する
+		if echo, ok := reply.Body.(*icmp.Echo); ok && echo.Seq == seq {
+			return fmt.Sprintf("echo reply from %s", addr.IP), nil
+		}
+	}
+}
+
+// checkHTTP は HTTP(S) GET を送信し、ステータスコードと本文を確認します。
+func checkHTTP(url string, c HealthCheck, timeout time.Duration) (string, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Timeout: timeout, Transport: transport}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if c.ExpectStatus != 0 {
+		if resp.StatusCode != c.ExpectStatus {
+			return "", fmt.Errorf("unexpected status code %d (expected %d)", resp.StatusCode, c.ExpectStatus)
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode > 399 {
+		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	if c.ExpectBody != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return "", fmt.Errorf("failed to read body: %v", err)
+		}
+		if !regexp.MustCompile(c.ExpectBody).Match(body) {
+			return "", fmt.Errorf("response body does not match %q", c.ExpectBody)
+		}
+	}
+	return fmt.Sprintf("%s returned %d", url, resp.StatusCode), nil
+}
+
+// checkTLS は TLS ハンドシェイクを行い、サーバ証明書の有効期限を確認します。
+func checkTLS(host, port string, c HealthCheck, timeout time.Duration) (string, error) {
+	serverName := c.Hostname
+	if serverName == "" {
+		serverName = host
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: c.Insecure,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", fmt.Errorf("no peer certificate")
+	}
+
+	warnDays := c.WarnDays
+	if warnDays <= 0 {
+		warnDays = 14
+	}
+	remaining := time.Until(certs[0].NotAfter)
+	days := int(remaining.Hours() / 24)
+	if remaining <= 0 {
+		return "", fmt.Errorf("certificate expired at %s", certs[0].NotAfter.Format(time.RFC3339))
+	}
+	if days < warnDays {
+		return "", fmt.Errorf("certificate expires in %d days (at %s)", days, certs[0].NotAfter.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("certificate valid for %d more days", days), nil
+}
+
+// checkDNS は名前解決できるか、期待するアドレスが含まれるかを確認します。
+func checkDNS(c HealthCheck, timeout time.Duration) (string, error) {
+	resolver := net.DefaultResolver
+	if c.Resolver != "" {
+		server := c.Resolver
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, c.Hostname)
+	if err != nil {
+		return "", err
+	}
+	if c.Expect != "" && !containsString(addrs, c.Expect) {
+		return "", fmt.Errorf("%s resolved to %s (expected %s)", c.Hostname, strings.Join(addrs, ", "), c.Expect)
+	}
+	return fmt.Sprintf("%s resolved to %s", c.Hostname, strings.Join(addrs, ", ")), nil
+}
+
+// checksPassed は、すべてのチェックが成功したかを返します。
+func checksPassed(results []CheckResult) bool {
+	for _, r := range results {
+		if !r.OK {
+			return false
+		}
+	}
+	return true
+}
+
+// ヘルスチェック END===========================================================END
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// closedPort は、待ち受けていない 127.0.0.1 のポートを返します。
+func closedPort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	return port
+}
+
+// healthHandler は、/healthz で "ok"、/missing で 404 を返すテスト用のハンドラです。
+var healthHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/missing" {
+		http.NotFound(w, r)
+		return
+	}
+	io.WriteString(w, "status: ok")
+})
+
+// checkCase は、1つのヘルスチェックの定義と期待する結果です。
+type checkCase struct {
+	check   HealthCheck
+	ok      bool
+	message string // 結果のメッセージに含まれるべき文字列
+}
+
+// runCheckCases は、127.0.0.1:port のターゲットに対して cases のヘルスチェックを実行し、結果を確認します。
+func runCheckCases(t *testing.T, port string, cases []checkCase) {
+	t.Helper()
+	config := &MonitorTarget{Name: "web01", HostIP: "127.0.0.1", Port: port}
+	for _, c := range cases {
+		result := runHealthCheck(config, c.check)
+		if result.OK != c.ok || !strings.Contains(result.Message, c.message) {
+			t.Errorf("%+v: ok = %t, message = %q, want ok = %t with %q", c.check, result.OK, result.Message, c.ok, c.message)
+		}
+	}
+}
+
+func TestHealthCheckTCP(t *testing.T) {
+	_, port, _ := net.SplitHostPort(startTestServer(t, healthHandler, false))
+	closed := closedPort(t)
+	runCheckCases(t, port, []checkCase{
+		{HealthCheck{Type: "tcp"}, true, "connected to 127.0.0.1:" + port},
+		{HealthCheck{Type: "tcp", Port: closed}, false, "connection refused"},
+		{HealthCheck{Type: "tcp", Host: "127.0.0.1", Port: port}, true, "connected"},
+	})
+}
+
+func TestHealthCheckHTTP(t *testing.T) {
+	_, port, _ := net.SplitHostPort(startTestServer(t, healthHandler, false))
+	base := "http://127.0.0.1:" + port
+	runCheckCases(t, port, []checkCase{
+		{HealthCheck{Type: "http"}, true, base + "/ returned 200"},
+		{HealthCheck{Type: "http", URL: base + "/missing"}, false, "unexpected status code 404"},
+		{HealthCheck{Type: "http", URL: base + "/missing", ExpectStatus: 404}, true, "returned 404"},
+		{HealthCheck{Type: "http", ExpectStatus: 204}, false, "unexpected status code 200 (expected 204)"},
+		{HealthCheck{Type: "http", ExpectBody: `status: (ok|ready)`}, true, "returned 200"},
+		{HealthCheck{Type: "http", ExpectBody: `status: ready`}, false, `does not match "status: ready"`},
+		{HealthCheck{Type: "http", URL: "http://127.0.0.1:" + closedPort(t) + "/"}, false, "connection refused"},
+	})
+}
+
+func TestHealthCheckTLS(t *testing.T) {
+	_, port, _ := net.SplitHostPort(startTestServer(t, healthHandler, true))
+	runCheckCases(t, port, []checkCase{
+		{HealthCheck{Type: "tls", Port: port}, false, "certificate"}, // 自己署名証明書は検証に失敗する
+		{HealthCheck{Type: "tls", Port: port, Insecure: true}, true, "certificate valid for"},
+		{HealthCheck{Type: "tls", Port: port, Insecure: true, WarnDays: 1 << 20}, false, "certificate expires in"},
+		{HealthCheck{Type: "tls", Port: closedPort(t), Insecure: true}, false, "connection refused"},
+		{HealthCheck{Type: "http", URL: "https://127.0.0.1:" + port + "/", Insecure: true}, true, "returned 200"},
+	})
+}
+
+func TestHealthCheckDNS(t *testing.T) {
+	runCheckCases(t, "80", []checkCase{
+		{HealthCheck{Type: "dns", Hostname: "localhost"}, true, "localhost resolved to"},
+		{HealthCheck{Type: "dns", Hostname: "localhost", Expect: "127.0.0.1"}, true, "127.0.0.1"},
+		{HealthCheck{Type: "dns", Hostname: "localhost", Expect: "192.0.2.1"}, false, "(expected 192.0.2.1)"},
+		{HealthCheck{Type: "dns", Hostname: "web01.example.invalid"}, false, "web01.example.invalid"},
+	})
+}
+
+func TestHealthCheckICMP(t *testing.T) {
+	result := runHealthCheck(&MonitorTarget{Name: "lo", HostIP: "127.0.0.1"}, HealthCheck{Type: "icmp", Timeout: 2})
+	if strings.Contains(result.Message, "failed to open icmp socket") {
+		t.Skipf("ICMP sockets are not permitted here: %s", result.Message)
+	}
+	if !result.OK || result.Message != "echo reply from 127.0.0.1" {
+		t.Errorf("icmp to 127.0.0.1: %+v", result)
+	}
+}
+
+func TestValidateHealthChecks(t *testing.T) {
+	for _, c := range []struct {
+		checks HealthChecks
+		want   string
+	}{
+		{HealthChecks{{Type: "tcp"}, {Type: "icmp"}, {Type: "tls"}, {Type: "http", ExpectBody: "ok"}, {Type: "dns", Hostname: "localhost"}}, ""},
+		{HealthChecks{{Type: "tcp"}, {Type: "smtp"}}, "checks[1]: unknown check type 'smtp'"},
+		{HealthChecks{{Type: "http", ExpectBody: "("}}, "checks[0]: invalid expect_body"},
+		{HealthChecks{{Type: "dns"}}, "checks[0]: hostname is required for dns check"},
+	} {
+		err := validateHealthChecks(c.checks)
+		if (c.want == "") != (err == nil) || (err != nil && !strings.HasPrefix(err.Error(), c.want)) {
+			t.Errorf("validateHealthChecks(%+v) = %v, want %q", c.checks, err, c.want)
+		}
+	}
+}
+
+// TestObserveTargetWithChecks は、ドライバの判定とヘルスチェックの結果から総合ステータスを決める規則を確認します。
+// チェックの失敗は Running を Degraded にするのみで、それ以外の状態は変えません。
+func TestObserveTargetWithChecks(t *testing.T) {
+	plug, config := newTestPlug(t)
+	_, port, _ := net.SplitHostPort(startTestServer(t, healthHandler, false))
+	passing := HealthCheck{Type: "tcp", Host: "127.0.0.1", Port: port}
+	failing := HealthCheck{Type: "tcp", Host: "127.0.0.1", Port: closedPort(t)}
+
+	for _, c := range []struct {
+		power       string // プラグの状態 (webhook ドライバの判定)
+		checks      HealthChecks
+		maintenance bool
+		want        string
+		results     int
+	}{
+		{"ON", nil, false, StatusRunning, 0},
+		{"ON", HealthChecks{passing, passing}, false, StatusRunning, 2},
+		{"ON", HealthChecks{passing, failing}, false, StatusDegraded, 2},
+		{"OFF", HealthChecks{failing}, false, StatusUnreachable, 1},
+		{"?", HealthChecks{failing}, false, StatusUnknown, 1},
+		{"?", HealthChecks{passing}, false, StatusUnknown, 1},
+		{"ON", HealthChecks{failing}, true, StatusMaintenance, 0},
+	} {
+		plug.mu.Lock()
+		plug.statusBody = `{"POWER":"` + c.power + `"}`
+		plug.mu.Unlock()
+		config.Checks, config.Maintenance = c.checks, c.maintenance
+
+		status, results := observeTarget(config)
+		if status != c.want || len(results) != c.results {
+			t.Errorf("power %s, checks %d, maintenance %t: status = %s with %d results, want %s with %d", c.power, len(c.checks), c.maintenance, status, len(results), c.want, c.results)
+		}
+	}
+}
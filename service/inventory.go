@@ -0,0 +1,489 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"srv_mng/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// インベントリのインポート/エクスポート START===========================================================START
+
+// InventoryFormats は、ターゲット設定の一覧 (インベントリ) のインポート・エクスポートで扱う形式です。
+var InventoryFormats = []string{"yaml", "json", "csv"}
+
+// インポートの方法
+const (
+	ImportUpsert  = "upsert"  // ファイルにあるターゲットを追加・更新し、それ以外は残す
+	ImportReplace = "replace" // ファイルの内容に置き換え、ファイルにないターゲットは削除する
+)
+
+// secretFields は、差分やエクスポートで値を出力しない項目です。
+var secretFields = []string{"ssh_pass", "bmc_pass"}
+
+// targetField は、MonitorTarget の1つの項目です。CSV の列と差分の項目名に使用します。
+type targetField struct {
+	name  string       // json タグの名前 (CSV の列名)
+	index int          // MonitorTarget のフィールドの位置
+	typ   reflect.Type // フィールドの型
+}
+
+// targetFields は、MonitorTarget の項目を定義順に並べたものです。
+var targetFields = func() []targetField {
+	t := reflect.TypeOf(MonitorTarget{})
+	fields := make([]targetField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, targetField{name: name, index: i, typ: t.Field(i).Type})
+	}
+	return fields
+}()
+
+// lookupTargetField は、項目名から targetField を返します。
+func lookupTargetField(name string) (targetField, bool) {
+	for _, f := range targetFields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return targetField{}, false
+}
+
+// tagsType は、CSV で "web,env=prod" のようにカンマ区切りで扱う Tags の型です。
+var tagsType = reflect.TypeOf(Tags{})
+
+// DecodeTargets は、YAML・JSON・CSV のインベントリをターゲット設定の一覧に変換します。
+// YAML と JSON はターゲットの配列、または "targets" にターゲットの配列を持つオブジェクトを受け付けます。
+// CSV は1行目を項目名 (name, type, host_ip など /targets の JSON と同じ名前) の見出しとし、空のセルは未指定として扱います。
+func DecodeTargets(data []byte, format string) ([]MonitorTarget, error) {
+	var items []map[string]interface{}
+	var err error
+	switch format {
+	case "yaml", "json":
+		items, err = decodeTargetDocument(data)
+	case "csv":
+		items, err = decodeTargetCSV(data)
+	default:
+		return nil, fmt.Errorf("unknown format '%s' (must be one of: %s)", format, strings.Join(InventoryFormats, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]MonitorTarget, 0, len(items))
+	for i, item := range items {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("targets[%d]: %v", i, err)
+		}
+		// 項目名の誤りに気付けるよう、未知の項目はエラーにする
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		var t MonitorTarget
+		if err := dec.Decode(&t); err != nil {
+			return nil, fmt.Errorf("targets[%d]: %v", i, err)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// decodeTargetDocument は、YAML または JSON (YAML として読み込む) のインベントリを項目名と値の map の一覧にします。
+func decodeTargetDocument(data []byte) ([]map[string]interface{}, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory: %v", err)
+	}
+	if m, ok := doc.(map[string]interface{}); ok {
+		doc = m["targets"]
+	}
+	if doc == nil {
+		return nil, nil
+	}
+	list, ok := doc.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("inventory must be a list of targets or an object with a 'targets' list")
+	}
+
+	items := make([]map[string]interface{}, 0, len(list))
+	for i, v := range list {
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("targets[%d]: must be an object", i)
+		}
+		// YAML では "port: 22" のように数値で書けるよう、文字列の項目に指定された数値などは文字列に変換する
+		for name, value := range item {
+			f, ok := lookupTargetField(name)
+			if !ok || f.typ.Kind() != reflect.String {
+				continue
+			}
+			switch value.(type) {
+			case int, float64, bool:
+				item[name] = fmt.Sprint(value)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// decodeTargetCSV は、CSV のインベントリを項目名と値の map の一覧にします。
+func decodeTargetCSV(data []byte) ([]map[string]interface{}, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %v", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	columns := make([]targetField, len(header))
+	for i, name := range header {
+		f, ok := lookupTargetField(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV column '%s'", name)
+		}
+		columns[i] = f
+	}
+
+	var items []map[string]interface{}
+	for n, record := range records[1:] {
+		// 表計算ソフトが出力する空行は読み飛ばす
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		pos := fmt.Sprintf("targets[%d] (line %d)", len(items), n+2)
+		if len(record) > len(columns) {
+			return nil, fmt.Errorf("%s: too many columns", pos)
+		}
+		item := map[string]interface{}{}
+		for i, cell := range record {
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			f := columns[i]
+			switch {
+			case f.typ == tagsType:
+				var tags []string
+				for _, tag := range strings.Split(cell, ",") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						tags = append(tags, tag)
+					}
+				}
+				item[f.name] = tags
+			case f.typ.Kind() == reflect.String:
+				item[f.name] = cell
+			case f.typ.Kind() == reflect.Bool:
+				b, err := strconv.ParseBool(cell)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %s must be true or false", pos, f.name)
+				}
+				item[f.name] = b
+			default:
+				// webhook と checks は JSON で記述する
+				if !json.Valid([]byte(cell)) {
+					return nil, fmt.Errorf("%s: %s must be JSON", pos, f.name)
+				}
+				item[f.name] = json.RawMessage(cell)
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// EncodeTargets は、ターゲット設定の一覧を YAML・JSON・CSV のインベントリに変換します。
+// 出力したインベントリは DecodeTargets でそのまま読み込めます。秘密情報を除く場合は、呼び出し元で Redacted() を使用します。
+func EncodeTargets(targets []MonitorTarget, format string) ([]byte, error) {
+	if targets == nil {
+		targets = []MonitorTarget{}
+	}
+	switch format {
+	case "json":
+		return json.MarshalIndent(targets, "", "  ")
+	case "yaml":
+		raw, err := json.Marshal(targets)
+		if err != nil {
+			return nil, err
+		}
+		return utils.JSONToYAML(raw)
+	case "csv":
+		return encodeTargetCSV(targets)
+	}
+	return nil, fmt.Errorf("unknown format '%s' (must be one of: %s)", format, strings.Join(InventoryFormats, ", "))
+}
+
+// encodeTargetCSV は、ターゲット設定の一覧を CSV に変換します。tags はカンマ区切り、webhook と checks は JSON で出力します。
+func encodeTargetCSV(targets []MonitorTarget) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := make([]string, len(targetFields))
+	for i, f := range targetFields {
+		header[i] = f.name
+	}
+	w.Write(header)
+
+	for _, t := range targets {
+		v := reflect.ValueOf(t)
+		row := make([]string, len(targetFields))
+		for i, f := range targetFields {
+			fv := v.Field(f.index)
+			switch {
+			case fv.Type() == tagsType:
+				row[i] = strings.Join(t.Tags, ",")
+			case fv.Kind() == reflect.String:
+				row[i] = fv.String()
+			case fv.Kind() == reflect.Bool:
+				row[i] = strconv.FormatBool(fv.Bool())
+			case !fv.IsZero():
+				raw, err := json.Marshal(fv.Interface())
+				if err != nil {
+					return nil, err
+				}
+				row[i] = string(raw)
+			}
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// FieldChange は、インポートで変わる1つの項目です。秘密情報の値は "********" と表示します。
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// TargetDiff は、インポートで更新されるターゲットと変わる項目の一覧です。
+type TargetDiff struct {
+	Name    string        `json:"name"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// ImportResult は、インポートの結果 (dry_run の場合は実行した場合の結果) です。
+type ImportResult struct {
+	Mode      string       `json:"mode"`
+	DryRun    bool         `json:"dry_run"`
+	Created   []string     `json:"created"`   // 追加されるターゲット
+	Updated   []TargetDiff `json:"updated"`   // 更新されるターゲットと変わる項目
+	Unchanged []string     `json:"unchanged"` // 変更のないターゲット
+	Deleted   []string     `json:"deleted"`   // 削除されるターゲット (replace のみ)
+	Conflicts []string     `json:"conflicts"` // 同じ名前のターゲットが管理対象外のため変更しないターゲット (インベントリファイルの反映のみ)
+	Skipped   []string     `json:"skipped"`   // インベントリファイルで管理しているため削除しないターゲット (replace のみ)
+}
+
+// ImportTargets は、ターゲット設定の一覧を DB に反映します。
+// すべてのターゲットを検証してから1つのトランザクションで反映するため、1件でも誤りがあれば何も変更しません。
+// replace では一覧にないターゲットを削除しますが、インベントリファイルで管理しているターゲットは削除せず skipped に記録します。
+// 既存のターゲットで ssh_pass・bmc_pass が空の場合は既存の値を引き継ぎます (秘密情報を除いたエクスポートを編集して戻せるように)。
+// dryRun の場合は DB を変更せず、反映した場合の差分のみを返します。
+func ImportTargets(targets []MonitorTarget, mode string, dryRun bool) (*ImportResult, error) {
+	if mode != ImportUpsert && mode != ImportReplace {
+		return nil, withKind(ErrInvalid, fmt.Errorf("mode must be '%s' or '%s'", ImportUpsert, ImportReplace))
+	}
+	if err := checkImportManagedByTags(targets); err != nil {
+		return nil, err
+	}
+	var prune func(MonitorTarget) bool
+	var skipped []string
+	if mode == ImportReplace {
+		prune = func(t MonitorTarget) bool {
+			if isFileManaged(t) {
+				skipped = append(skipped, t.Name)
+				return false
+			}
+			return true
+		}
+	}
+	result, err := applyTargets(targets, mode, dryRun, nil, prune)
+	if err != nil {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		result.Skipped = skipped
+		log.Printf("[INFO] Targets managed by the inventory file were not deleted: %v", skipped)
+	}
+	return result, nil
+}
+
+// checkImportManagedByTags は、API からのインポートで managed_by=file タグを付け外ししていないかを確認します。
+func checkImportManagedByTags(targets []MonitorTarget) error {
+	existing, err := ListMonitorTargets()
+	if err != nil {
+		return err
+	}
+	current := map[string]MonitorTarget{}
+	for _, t := range existing {
+		current[t.Name] = t
+	}
+	ve := &ValidationError{}
+	for i := range targets {
+		var old *MonitorTarget
+		if t, ok := current[targets[i].Name]; ok {
+			old = &t
+		}
+		if err := checkManagedByTag(old, &targets[i]); err != nil {
+			ve.add(fmt.Sprintf("targets[%d].tags", i), "%v", err)
+		}
+	}
+	if len(ve.Errors) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// applyTargets は、ターゲット設定の一覧を DB に反映します (ImportTargets とインベントリファイルの反映で共通)。
+// owns が false を返す既存のターゲットは管理対象外として、同じ名前のターゲットが targets にあっても変更せず conflicts に記録します
+// (インベントリファイルの反映で、API で登録したターゲットを引き継がないため)。owns が nil の場合はすべて変更します。
+// targets にない既存のターゲットのうち、prune が true を返すものを削除します。prune が nil の場合は削除しません。
+func applyTargets(targets []MonitorTarget, mode string, dryRun bool, owns, prune func(MonitorTarget) bool) (*ImportResult, error) {
+	if db == nil {
+		return nil, errNoDB()
+	}
+
+	// 検証エラーは "targets[2].port" のように位置を付けてまとめて返す
+	ve := &ValidationError{}
+	seen := map[string]int{}
+	for i := range targets {
+		if err := ValidateMonitorTarget(&targets[i]); err != nil {
+			for _, fe := range err.(*ValidationError).Errors {
+				ve.add(fmt.Sprintf("targets[%d].%s", i, fe.Field), "%s", fe.Message)
+			}
+		}
+		if name := targets[i].Name; name != "" {
+			if j, ok := seen[name]; ok {
+				ve.add(fmt.Sprintf("targets[%d].name", i), "duplicate name '%s' (also at targets[%d])", name, j)
+			}
+			seen[name] = i
+		}
+	}
+	if len(ve.Errors) > 0 {
+		return nil, ve
+	}
+
+	existing, err := ListMonitorTargets()
+	if err != nil {
+		return nil, err
+	}
+	current := map[string]MonitorTarget{}
+	for _, t := range existing {
+		current[t.Name] = t
+	}
+
+	result := &ImportResult{Mode: mode, DryRun: dryRun, Created: []string{}, Updated: []TargetDiff{}, Unchanged: []string{}, Deleted: []string{}, Conflicts: []string{}, Skipped: []string{}}
+	var writes []*MonitorTarget
+	for i := range targets {
+		t := &targets[i]
+		old, ok := current[t.Name]
+		if !ok {
+			result.Created = append(result.Created, t.Name)
+			writes = append(writes, t)
+			continue
+		}
+		if owns != nil && !owns(old) {
+			result.Conflicts = append(result.Conflicts, t.Name)
+			continue
+		}
+		if t.SSHPass == "" {
+			t.SSHPass = old.SSHPass
+		}
+		if t.BMCPass == "" {
+			t.BMCPass = old.BMCPass
+		}
+		t.Webhook.restoreSecrets(old.Webhook)
+		if changes := diffTargets(old, *t); len(changes) > 0 {
+			result.Updated = append(result.Updated, TargetDiff{Name: t.Name, Changes: changes})
+			writes = append(writes, t)
+		} else {
+			result.Unchanged = append(result.Unchanged, t.Name)
+		}
+	}
+	if prune != nil {
+		for _, t := range existing {
+			if _, ok := seen[t.Name]; !ok && prune(t) {
+				result.Deleted = append(result.Deleted, t.Name)
+			}
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, withKind(ErrUnavailable, fmt.Errorf("failed to begin transaction: %w", err))
+	}
+	defer tx.Rollback()
+	for _, t := range writes {
+		query := "INSERT OR REPLACE INTO monitor_targets (" + targetColumns + ") VALUES (" + placeholders(len(t.values())) + ")"
+		if _, err := tx.Exec(query, t.values()...); err != nil {
+			log.Printf("[ERROR] Failed to import target '%s': %v", t.Name, err)
+			return nil, withKind(ErrUnavailable, fmt.Errorf("failed to save target '%s': %w", t.Name, err))
+		}
+	}
+	for _, name := range result.Deleted {
+		if _, err := tx.Exec("DELETE FROM monitor_targets WHERE name = ?", name); err != nil {
+			log.Printf("[ERROR] Failed to delete target '%s': %v", name, err)
+			return nil, withKind(ErrUnavailable, fmt.Errorf("failed to delete target '%s': %w", name, err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, withKind(ErrUnavailable, fmt.Errorf("failed to commit import: %w", err))
+	}
+
+	for _, name := range result.Deleted {
+		debouncer.forget(name)
+		deleteMetrics(name)
+	}
+	log.Printf("[INFO] Targets imported (mode: %s): %d created, %d updated, %d unchanged, %d deleted, %d conflicts",
+		mode, len(result.Created), len(result.Updated), len(result.Unchanged), len(result.Deleted), len(result.Conflicts))
+	return result, nil
+}
+
+// diffTargets は、old から new で変わる項目を targetFields の順に返します。
+func diffTargets(old, new MonitorTarget) []FieldChange {
+	ov, nv := reflect.ValueOf(old), reflect.ValueOf(new)
+	var changes []FieldChange
+	for _, f := range targetFields {
+		of, nf := ov.Field(f.index), nv.Field(f.index)
+		// DB から読み込んだ空のタグ (nil) とインポートした空のタグ ([]) などは同じとみなす
+		if reflect.DeepEqual(of.Interface(), nf.Interface()) || (of.Kind() == reflect.Slice && of.Len() == 0 && nf.Len() == 0) {
+			continue
+		}
+		o, n := of.Interface(), nf.Interface()
+		if slices.Contains(secretFields, f.name) {
+			o, n = maskSecret(o.(string)), maskSecret(n.(string))
+		}
+		if f.name == "webhook" {
+			o, n = old.Webhook.Redacted(), new.Webhook.Redacted()
+		}
+		changes = append(changes, FieldChange{Field: f.name, Old: o, New: n})
+	}
+	return changes
+}
+
+// maskSecret は、秘密情報の値を伏せ字にします。空の場合は空のままにします。
+func maskSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "********"
+}
+
+// インベントリのインポート/エクスポート END===========================================================END
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// inventoryTargets は、インポート・エクスポートのテストで使用するターゲットの一覧です。
+func inventoryTargets() []MonitorTarget {
+	return []MonitorTarget{
+		{Name: "web01", Type: "host", HostIP: "172.16.0.11", Port: "8080", MacAddress: "01:23:34:56:78:9a", BroadcastIP: "172.16.0.255", Tags: Tags{"web", "env=prod"}},
+		{Name: "bmc01", Type: "host", HostIP: "172.16.0.12", Port: "22", PowerDriver: "redfish", BMCAddress: "172.16.1.12", BMCUser: "admin", BMCInsecure: true,
+			Checks: HealthChecks{{Type: "http", URL: "http://172.16.0.12/health", ExpectStatus: 204}}},
+		{Name: "plug01", Type: "host", HostIP: "172.16.0.13", Port: "80", PowerDriver: "webhook", Maintenance: true,
+			Webhook: WebhookConfig{
+				On:  &WebhookRequest{Method: "POST", URL: "http://172.16.0.13/relay/0?turn=on", Headers: map[string]string{"Authorization": "Bearer abc"}},
+				Off: &WebhookRequest{Method: "POST", URL: "http://172.16.0.13/relay/0?turn=off", Body: `{"a": "b,c"}`},
+			}},
+	}
+}
+
+func TestInventoryRoundTrip(t *testing.T) {
+	want := inventoryTargets()
+	for _, format := range InventoryFormats {
+		data, err := EncodeTargets(want, format)
+		if err != nil {
+			t.Fatalf("EncodeTargets(%s): %v", format, err)
+		}
+		got, err := DecodeTargets(data, format)
+		if err != nil {
+			t.Fatalf("DecodeTargets(%s): %v\n%s", format, err, data)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s round trip:\n got %+v\nwant %+v\n%s", format, got, want, data)
+		}
+	}
+}
+
+func TestDecodeTargetsErrors(t *testing.T) {
+	for _, c := range []struct {
+		format, data, want string
+	}{
+		{"csv", "name,type,hostip\nweb01,host,172.16.0.11\n", "unknown CSV column 'hostip'"},
+		{"csv", "name,type\nweb01,host,extra\n", "targets[0] (line 2): too many columns"},
+		{"csv", "name,maintenance\nweb01,yes\n", "targets[0] (line 2): maintenance must be true or false"},
+		{"csv", "name,checks\nweb01,[{\n", "targets[0] (line 2): checks must be JSON"},
+		{"yaml", "- name: web01\n  hostip: 172.16.0.11\n", `targets[0]: json: unknown field "hostip"`},
+		{"json", `{"targets": {"name": "web01"}}`, "inventory must be a list of targets"},
+		{"xml", "<targets/>", "unknown format 'xml'"},
+	} {
+		_, err := DecodeTargets([]byte(c.data), c.format)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("DecodeTargets(%s, %q) error = %v, want %q", c.format, c.data, err, c.want)
+		}
+	}
+}
+
+func TestImportDuplicateName(t *testing.T) {
+	newTestDB(t)
+	targets := inventoryTargets()
+	targets[2].Name = "web01"
+
+	_, err := ImportTargets(targets, ImportUpsert, false)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("err = %v, want a ValidationError", err)
+	}
+	if len(ve.Errors) != 1 || ve.Errors[0].Field != "targets[2].name" || ve.Errors[0].Message != "duplicate name 'web01' (also at targets[0])" {
+		t.Errorf("errors = %+v", ve.Errors)
+	}
+	if got := targetNames(t); len(got) != 0 {
+		t.Errorf("targets = %v, want none after a failed import", got)
+	}
+}
+
+func TestImportDryRunMasksSecrets(t *testing.T) {
+	newTestDB(t)
+	old := inventoryTargets()[2]
+	old.SSHPass = "old-secret"
+	saveTestTarget(t, &old)
+
+	updated := inventoryTargets()[2]
+	updated.SSHPass = "new-secret"
+	updated.Webhook.On.Headers = map[string]string{"Authorization": "Bearer xyz"}
+	result, err := ImportTargets([]MonitorTarget{updated}, ImportUpsert, true)
+	if err != nil {
+		t.Fatalf("ImportTargets: %v", err)
+	}
+	if !result.DryRun || len(result.Updated) != 1 {
+		t.Fatalf("result = %+v, want one update", result)
+	}
+	changes := map[string]FieldChange{}
+	for _, c := range result.Updated[0].Changes {
+		changes[c.Field] = c
+	}
+	if c := changes["ssh_pass"]; c.Old != "********" || c.New != "********" {
+		t.Errorf("ssh_pass change = %+v, want masked", c)
+	}
+	webhook, err := json.Marshal(changes["webhook"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(webhook), maskedHeaderValue) || strings.Contains(string(webhook), "Bearer") {
+		t.Errorf("webhook change = %s, want masked headers", webhook)
+	}
+
+	// dry_run では DB を変更しない
+	stored, err := GetTargetConfig("plug01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SSHPass != "old-secret" || stored.Webhook.On.Headers["Authorization"] != "Bearer abc" {
+		t.Errorf("dry run changed the target: ssh_pass %q, headers %v", stored.SSHPass, stored.Webhook.On.Headers)
+	}
+}
+
+func TestImportKeepsBlankSecrets(t *testing.T) {
+	newTestDB(t)
+	old := inventoryTargets()[1]
+	old.SSHPass, old.BMCPass = "ssh-secret", "bmc-secret"
+	saveTestTarget(t, &old)
+
+	// 秘密情報を除いたエクスポートをそのまま戻しても変わらない
+	exported, err := EncodeTargets([]MonitorTarget{old.Redacted()}, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets, err := DecodeTargets(exported, "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ImportTargets(targets, ImportUpsert, false)
+	if err != nil {
+		t.Fatalf("ImportTargets: %v", err)
+	}
+	if !slices.Equal(result.Unchanged, []string{"bmc01"}) {
+		t.Errorf("result = %+v, want bmc01 unchanged", result)
+	}
+	stored, err := GetTargetConfig("bmc01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.SSHPass != "ssh-secret" || stored.BMCPass != "bmc-secret" {
+		t.Errorf("secrets = %q, %q, want them kept", stored.SSHPass, stored.BMCPass)
+	}
+}
+
+func TestImportReplaceDeletes(t *testing.T) {
+	newTestDB(t)
+	for _, target := range inventoryTargets() {
+		saveTestTarget(t, &target)
+	}
+
+	keep := inventoryTargets()[:1]
+	keep = append(keep, MonitorTarget{Name: "db01", Type: "host", HostIP: "172.16.0.14", Port: "8080"})
+	result, err := ImportTargets(keep, ImportReplace, true)
+	if err != nil {
+		t.Fatalf("ImportTargets (dry run): %v", err)
+	}
+	if !slices.Equal(result.Deleted, []string{"bmc01", "plug01"}) && !slices.Equal(result.Deleted, []string{"plug01", "bmc01"}) {
+		t.Errorf("deleted = %v, want bmc01 and plug01", result.Deleted)
+	}
+	if got := targetNames(t); len(got) != 3 {
+		t.Errorf("dry run changed the targets: %v", got)
+	}
+
+	result, err = ImportTargets(keep, ImportReplace, false)
+	if err != nil {
+		t.Fatalf("ImportTargets: %v", err)
+	}
+	if !slices.Equal(result.Created, []string{"db01"}) || !slices.Equal(result.Unchanged, []string{"web01"}) {
+		t.Errorf("result = %+v", result)
+	}
+	if got := targetNames(t); !slices.Equal(got, []string{"db01", "web01"}) {
+		t.Errorf("targets = %v, want [db01 web01]", got)
+	}
+
+	if _, err := ImportTargets(keep, "merge", false); !errors.Is(err, ErrInvalid) {
+		t.Errorf("unknown mode: err = %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// インベントリファイル START===========================================================START
+
+// ManagedByFileTag は、インベントリファイルで管理しているターゲットに付けるタグです。
+// 反映時に削除するのはこのタグを持つターゲットのみで、API で登録したターゲットはそのまま残します。
+const ManagedByFileTag = "managed_by=file"
+
+// defaultInventoryPollInterval は、インベントリファイルの変更を確認する間隔の既定値です (INVENTORY_POLL_INTERVAL)。
+const defaultInventoryPollInterval = 5 * time.Second
+
+// ReconcileMode は、インベントリファイルの反映結果 (ImportResult.Mode) に設定する値です。
+const ReconcileMode = "reconcile"
+
+// inventoryFile は、インベントリファイルと最後に反映した内容です。
+var inventoryFile struct {
+	sync.Mutex
+	path      string
+	targets   []MonitorTarget // 最後に反映した内容 (ManagedByFileTag を付与済み)
+	hash      [sha256.Size]byte
+	appliedAt time.Time
+	lastErr   error
+}
+
+// InventoryReport は、インベントリファイルと DB の差分 (ドリフト) です。
+// 差分の old は DB の値、new はファイルの値です。
+type InventoryReport struct {
+	File        string       `json:"file"`
+	AppliedAt   time.Time    `json:"applied_at"`           // 最後に反映した日時
+	LastError   string       `json:"last_error,omitempty"` // 最後の読み込み・反映で発生したエラー
+	FileChanged bool         `json:"file_changed"`         // ファイルが最後に反映した内容から変更されている (反映待ち)
+	InSync      bool         `json:"in_sync"`              // DB がファイルの内容と一致している
+	Missing     []string     `json:"missing"`              // ファイルにあるが DB にないターゲット
+	Changed     []TargetDiff `json:"changed"`              // DB の設定がファイルと異なるターゲット
+	Extra       []string     `json:"extra"`                // managed_by=file だがファイルにないターゲット
+	Conflicts   []string     `json:"conflicts"`            // ファイルにあるが、同じ名前のターゲットが API で登録済みのため反映していないターゲット
+}
+
+// isFileManaged は、ターゲットがインベントリファイルで管理されているかを返します。
+func isFileManaged(t MonitorTarget) bool {
+	return slices.Contains(t.Tags, ManagedByFileTag)
+}
+
+// checkManagedByTag は、API による登録・更新で managed_by=file タグを付け外ししていないかを確認します。
+// このタグはインベントリファイルの反映でのみ付与・削除し、API ではファイル管理のターゲットかどうかを変更できません。
+// old は同じ名前の既存のターゲットで、新規の場合は nil です。
+func checkManagedByTag(old, config *MonitorTarget) error {
+	managed := old != nil && isFileManaged(*old)
+	if isFileManaged(*config) == managed {
+		return nil
+	}
+	if managed {
+		return fmt.Errorf("'%s' cannot be removed (the target is managed by the inventory file)", ManagedByFileTag)
+	}
+	return fmt.Errorf("'%s' is reserved for targets managed by the inventory file", ManagedByFileTag)
+}
+
+// StartInventory は、環境変数 INVENTORY_FILE で指定した YAML のインベントリファイルを DB に反映し、
+// 以降は SIGHUP を受けたとき、またはファイルの内容が変わったときに反映し直します。INVENTORY_FILE が未設定の場合は何もしません。
+func StartInventory() {
+	path := os.Getenv("INVENTORY_FILE")
+	if path == "" {
+		return
+	}
+	interval := envDuration("INVENTORY_POLL_INTERVAL", defaultInventoryPollInterval)
+
+	inventoryFile.Lock()
+	inventoryFile.path = path
+	inventoryFile.Unlock()
+
+	log.Printf("[INFO] Inventory file enabled: %s (poll interval: %s)", path, interval)
+	ReconcileInventory()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hup:
+				// SIGHUP では内容が同じでも反映し直し、API による変更 (ドリフト) を元に戻す
+				log.Printf("[INFO] SIGHUP received, reconciling inventory file")
+				ReconcileInventory()
+			case <-ticker.C:
+				if inventoryFileChanged() {
+					log.Printf("[INFO] Inventory file changed, reconciling")
+					ReconcileInventory()
+				}
+			}
+		}
+	}()
+}
+
+// readInventoryFile は、インベントリファイルを読み込み、ManagedByFileTag を付与したターゲットの一覧とファイルのハッシュを返します。
+func readInventoryFile(path string) ([]MonitorTarget, [sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, [sha256.Size]byte{}, err
+	}
+	hash := sha256.Sum256(data)
+	targets, err := DecodeTargets(data, "yaml")
+	if err != nil {
+		return nil, hash, err
+	}
+	for i := range targets {
+		if !isFileManaged(targets[i]) {
+			targets[i].Tags = append(targets[i].Tags, ManagedByFileTag)
+		}
+	}
+	return targets, hash, nil
+}
+
+// inventoryFileChanged は、インベントリファイルの内容が最後に反映したときから変わっているかを返します。
+// 読み込めない場合は、エラーを記録するために反映を試みるよう true を返します (同じエラーが続く場合は false)。
+func inventoryFileChanged() bool {
+	inventoryFile.Lock()
+	path, hash, lastErr := inventoryFile.path, inventoryFile.hash, inventoryFile.lastErr
+	inventoryFile.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lastErr == nil || lastErr.Error() != err.Error()
+	}
+	return sha256.Sum256(data) != hash
+}
+
+// ReconcileInventory は、インベントリファイルを読み込み、DB に反映します。
+// ファイルにあるターゲットを追加・更新し、managed_by=file のターゲットのうちファイルにないものを削除します。
+// 読み込みまたは検証に失敗した場合は何も変更せず、アラートを通知します。
+// ファイルと同じ名前のターゲットが API で登録済み (managed_by=file でない) の場合は、そのターゲットを変更せずアラートを通知します。
+func ReconcileInventory() (*ImportResult, error) {
+	inventoryFile.Lock()
+	defer inventoryFile.Unlock()
+	if inventoryFile.path == "" {
+		return nil, withKind(ErrNotFound, fmt.Errorf("inventory file is not configured (set INVENTORY_FILE)"))
+	}
+
+	targets, hash, err := readInventoryFile(inventoryFile.path)
+	// 検証に失敗した内容で何度も反映を試みないよう、ハッシュは失敗した場合も記録する
+	inventoryFile.hash = hash
+	var result *ImportResult
+	if err == nil {
+		// applyTargets は既存のパスワードを引き継ぐために targets を書き換えるため、コピーを渡す
+		result, err = applyTargets(slices.Clone(targets), ReconcileMode, false, isFileManaged, isFileManaged)
+	}
+	inventoryFile.lastErr = err
+	if err != nil {
+		log.Printf("[ERROR] Failed to reconcile inventory file %s: %v", inventoryFile.path, err)
+		PublishEvent(EventAlert, Alert{Target: "inventory", Level: "warning", Message: fmt.Sprintf("inventory file %s was not applied: %v", inventoryFile.path, err), At: time.Now()})
+		return nil, err
+	}
+
+	inventoryFile.targets = targets
+	inventoryFile.appliedAt = time.Now()
+	if len(result.Conflicts) > 0 {
+		// API で登録したターゲットは引き継がず、名前の重複として通知する
+		log.Printf("[ERROR] Inventory file %s: targets already registered via the API were not applied: %v", inventoryFile.path, result.Conflicts)
+		PublishEvent(EventAlert, Alert{Target: "inventory", Level: "warning", Message: fmt.Sprintf("inventory file %s: targets already registered via the API were not applied: %s", inventoryFile.path, strings.Join(result.Conflicts, ", ")), At: time.Now()})
+	}
+	return result, nil
+}
+
+// InventoryDrift は、最後に反映したインベントリファイルの内容と DB の差分を返します。
+// API でファイル管理のターゲットを変更・削除した場合に、ファイルとの違いを確認するために使用します。
+func InventoryDrift() (*InventoryReport, error) {
+	inventoryFile.Lock()
+	path, targets, appliedAt, lastErr := inventoryFile.path, slices.Clone(inventoryFile.targets), inventoryFile.appliedAt, inventoryFile.lastErr
+	inventoryFile.Unlock()
+
+	if path == "" {
+		return nil, withKind(ErrNotFound, fmt.Errorf("inventory file is not configured (set INVENTORY_FILE)"))
+	}
+	if appliedAt.IsZero() {
+		return nil, withKind(ErrUnavailable, fmt.Errorf("inventory file %s has not been applied yet: %v", path, lastErr))
+	}
+
+	plan, err := applyTargets(targets, ReconcileMode, true, isFileManaged, isFileManaged)
+	if err != nil {
+		return nil, err
+	}
+	report := &InventoryReport{
+		File:        path,
+		AppliedAt:   appliedAt,
+		FileChanged: inventoryFileChanged(),
+		Missing:     plan.Created,
+		Changed:     plan.Updated,
+		Extra:       plan.Deleted,
+		Conflicts:   plan.Conflicts,
+	}
+	if lastErr != nil {
+		report.LastError = lastErr.Error()
+	}
+	report.InSync = len(report.Missing) == 0 && len(report.Changed) == 0 && len(report.Extra) == 0 && len(report.Conflicts) == 0
+	return report, nil
+}
+
+// インベントリファイル END===========================================================END
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// useInventoryFile は、一時ディレクトリのインベントリファイルを設定し、テストの終了時に設定を元に戻します。
+func useInventoryFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "inventory.yaml")
+	inventoryFile.Lock()
+	inventoryFile.path = path
+	inventoryFile.Unlock()
+	t.Cleanup(func() {
+		inventoryFile.Lock()
+		defer inventoryFile.Unlock()
+		inventoryFile.path, inventoryFile.targets, inventoryFile.appliedAt, inventoryFile.lastErr = "", nil, time.Time{}, nil
+	})
+	return path
+}
+
+// reconcile は、インベントリファイルに content を書き込んで反映します。
+func reconcile(t *testing.T, path, content string) *ImportResult {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ReconcileInventory()
+	if err != nil {
+		t.Fatalf("ReconcileInventory: %v", err)
+	}
+	return result
+}
+
+// targetNames は、登録されているターゲットの名前を返します。
+func targetNames(t *testing.T) []string {
+	t.Helper()
+	targets, err := ListMonitorTargets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, target := range targets {
+		names = append(names, target.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+const inventoryTwoHosts = `targets:
+  - {name: web01, type: host, host_ip: 172.16.0.11, port: 8080}
+  - {name: db01, type: host, host_ip: 172.16.0.12, port: 8080}
+`
+
+func TestReconcileInventory(t *testing.T) {
+	newTestDB(t)
+	path := useInventoryFile(t)
+	saveTestTarget(t, &MonitorTarget{Name: "api01", Type: "host", HostIP: "172.16.0.20", Port: "8080"})
+
+	// 追加: ファイルのターゲットには managed_by=file を付ける
+	result := reconcile(t, path, inventoryTwoHosts)
+	if !slices.Equal(result.Created, []string{"web01", "db01"}) {
+		t.Errorf("created = %v", result.Created)
+	}
+	web, err := GetTargetConfig("web01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isFileManaged(*web) {
+		t.Errorf("web01 tags = %v, want %s", web.Tags, ManagedByFileTag)
+	}
+
+	// 更新と削除: ファイルにない managed_by=file のターゲットのみ削除し、API で登録したターゲットは残す
+	result = reconcile(t, path, `targets:
+  - {name: web01, type: host, host_ip: 172.16.0.11, port: 9090}
+`)
+	if len(result.Updated) != 1 || result.Updated[0].Name != "web01" || result.Updated[0].Changes[0].Field != "port" {
+		t.Errorf("updated = %+v", result.Updated)
+	}
+	if !slices.Equal(result.Deleted, []string{"db01"}) {
+		t.Errorf("deleted = %v, want [db01]", result.Deleted)
+	}
+	if got := targetNames(t); !slices.Equal(got, []string{"api01", "web01"}) {
+		t.Errorf("targets = %v, want [api01 web01]", got)
+	}
+
+	// 同じ内容を反映し直しても変更しない
+	result = reconcile(t, path, `targets:
+  - {name: web01, type: host, host_ip: 172.16.0.11, port: 9090}
+`)
+	if !slices.Equal(result.Unchanged, []string{"web01"}) || len(result.Updated) != 0 || len(result.Deleted) != 0 {
+		t.Errorf("result = %+v, want web01 unchanged", result)
+	}
+}
+
+func TestReconcileInventoryConflict(t *testing.T) {
+	newTestDB(t)
+	path := useInventoryFile(t)
+	saveTestTarget(t, &MonitorTarget{Name: "web01", Type: "host", HostIP: "172.16.0.99", Port: "22"})
+
+	result := reconcile(t, path, inventoryTwoHosts)
+	if !slices.Equal(result.Conflicts, []string{"web01"}) || !slices.Equal(result.Created, []string{"db01"}) {
+		t.Errorf("conflicts = %v, created = %v", result.Conflicts, result.Created)
+	}
+	web, err := GetTargetConfig("web01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if web.HostIP != "172.16.0.99" || isFileManaged(*web) {
+		t.Errorf("API-owned web01 was changed: %+v", web)
+	}
+
+	report, err := InventoryDrift()
+	if err != nil {
+		t.Fatalf("InventoryDrift: %v", err)
+	}
+	if report.InSync || !slices.Equal(report.Conflicts, []string{"web01"}) {
+		t.Errorf("report = %+v, want web01 in conflicts", report)
+	}
+}
+
+func TestInventoryDriftAfterAPIEdit(t *testing.T) {
+	newTestDB(t)
+	path := useInventoryFile(t)
+	reconcile(t, path, inventoryTwoHosts)
+
+	report, err := InventoryDrift()
+	if err != nil {
+		t.Fatalf("InventoryDrift: %v", err)
+	}
+	if !report.InSync || report.FileChanged {
+		t.Errorf("report right after reconcile = %+v, want in sync", report)
+	}
+
+	// API で変更・削除すると、ファイルとの差分として報告する
+	if _, err := UpdateMonitorTarget("web01", []byte(`{"port": "9090"}`)); err != nil {
+		t.Fatalf("UpdateMonitorTarget: %v", err)
+	}
+	if err := DeleteMonitorTarget("db01"); err != nil {
+		t.Fatalf("DeleteMonitorTarget: %v", err)
+	}
+	report, err = InventoryDrift()
+	if err != nil {
+		t.Fatalf("InventoryDrift: %v", err)
+	}
+	if report.InSync {
+		t.Error("report is in sync after API edits")
+	}
+	if !slices.Equal(report.Missing, []string{"db01"}) {
+		t.Errorf("missing = %v, want [db01]", report.Missing)
+	}
+	if len(report.Changed) != 1 || report.Changed[0].Name != "web01" {
+		t.Fatalf("changed = %+v, want web01", report.Changed)
+	}
+	if c := report.Changed[0].Changes[0]; c.Field != "port" || c.Old != "9090" || c.New != "8080" {
+		t.Errorf("change = %+v, want port 9090 -> 8080", c)
+	}
+
+	// SIGHUP と同様に反映し直すとファイルの内容に戻る
+	reconcile(t, path, inventoryTwoHosts)
+	if report, err = InventoryDrift(); err != nil || !report.InSync {
+		t.Errorf("report after reconcile = %+v, %v, want in sync", report, err)
+	}
+}
+
+func TestImportReplaceKeepsFileManaged(t *testing.T) {
+	newTestDB(t)
+	path := useInventoryFile(t)
+	reconcile(t, path, inventoryTwoHosts)
+	saveTestTarget(t, &MonitorTarget{Name: "api01", Type: "host", HostIP: "172.16.0.20", Port: "8080"})
+
+	imported := []MonitorTarget{{Name: "api02", Type: "host", HostIP: "172.16.0.21", Port: "8080"}}
+	result, err := ImportTargets(imported, ImportReplace, false)
+	if err != nil {
+		t.Fatalf("ImportTargets: %v", err)
+	}
+	if !slices.Equal(result.Deleted, []string{"api01"}) {
+		t.Errorf("deleted = %v, want [api01]", result.Deleted)
+	}
+	if slices.Sort(result.Skipped); !slices.Equal(result.Skipped, []string{"db01", "web01"}) {
+		t.Errorf("skipped = %v, want [db01 web01]", result.Skipped)
+	}
+	if got := targetNames(t); !slices.Equal(got, []string{"api02", "db01", "web01"}) {
+		t.Errorf("targets = %v, want [api02 db01 web01]", got)
+	}
+}
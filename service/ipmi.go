@@ -0,0 +1,116 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"srv_mng/ipmi"
+)
+
+// IPMIドライバ START===========================================================START
+
+// ipmiTimeout は BMC からの応答を待つ時間です（再送ごと）。
+const ipmiTimeout = 2 * time.Second
+
+// ipmiDriver は、IPMI v2.0 (RMCP+) の Chassis Control で電源を制御するドライバです。
+// start は power up、stop は soft shutdown（force 指定時は power down）、reboot は power cycle（force 指定時は hard reset）を送信します。
+type ipmiDriver struct{}
+
+func init() {
+	RegisterPowerDriver("ipmi", &ipmiDriver{})
+}
+
+// Validate は、IPMI ドライバに必要な BMC の接続情報を確認します。
+func (d *ipmiDriver) Validate(config *MonitorTarget) error {
+	if config.BMCAddress == "" || config.BMCUser == "" {
+		return fmt.Errorf("bmc_address and bmc_user are required for ipmi driver")
+	}
+	if strings.Contains(config.BMCAddress, "://") {
+		return fmt.Errorf("bmc_address for ipmi driver must be 'host' or 'host:port'")
+	}
+	return nil
+}
+
+func (d *ipmiDriver) Start(config *MonitorTarget, _ PowerOptions) (string, error) {
+	return d.control(config, ipmi.PowerUp, "power up")
+}
+
+func (d *ipmiDriver) Stop(config *MonitorTarget, opts PowerOptions) (string, error) {
+	if opts.Delay > 0 {
+		return "", fmt.Errorf("delayed shutdown is not supported by ipmi driver")
+	}
+	if opts.Force {
+		return d.control(config, ipmi.PowerDown, "power down")
+	}
+	return d.control(config, ipmi.SoftShutdown, "soft shutdown")
+}
+
+func (d *ipmiDriver) Reboot(config *MonitorTarget, opts PowerOptions) (string, error) {
+	if opts.Force {
+		return d.control(config, ipmi.HardReset, "hard reset")
+	}
+	return d.control(config, ipmi.PowerCycle, "power cycle")
+}
+
+// Status は、Get Chassis Status の電源状態から状態を返します。
+func (d *ipmiDriver) Status(config *MonitorTarget) string {
+	var on bool
+	err := withIPMIClient(config, func(c *ipmi.Client) error {
+		var err error
+		on, err = c.ChassisStatus()
+		return err
+	})
+	if err != nil {
+		log.Printf("[INFO] Health check: ipmi %s failed: %v", config.BMCAddress, err)
+		return StatusUnknown
+	}
+
+	log.Printf("[INFO] Health check: ipmi %s power on=%t", config.BMCAddress, on)
+	if on {
+		return StatusRunning
+	}
+	return StatusUnreachable
+}
+
+// Address は、状態を取得する BMC のアドレスを返します。
+func (d *ipmiDriver) Address(config *MonitorTarget) string {
+	return config.BMCAddress
+}
+
+// Capabilities は、BMC とのセッションを確立できれば start/stop/reboot を利用可能とします。
+func (d *ipmiDriver) Capabilities(config *MonitorTarget) *PowerCapabilities {
+	caps := &PowerCapabilities{Actions: []string{}}
+	if err := withIPMIClient(config, func(c *ipmi.Client) error { return nil }); err != nil {
+		log.Printf("[INFO] IPMI capabilities unavailable for '%s': %v", config.Name, err)
+		return caps
+	}
+	caps.Actions = append(caps.Actions, "start", "stop", "reboot")
+	return caps
+}
+
+// control は Chassis Control を送信し、結果をログに記録します。
+func (d *ipmiDriver) control(config *MonitorTarget, control ipmi.ChassisControl, name string) (string, error) {
+	err := withIPMIClient(config, func(c *ipmi.Client) error {
+		return c.ChassisControl(control)
+	})
+	if err != nil {
+		log.Printf("[ERROR] ipmi %s failed for '%s': %v", name, config.Name, err)
+		return "", err
+	}
+	log.Printf("[INFO] ipmi %s succeeded for '%s'", name, config.Name)
+	return fmt.Sprintf("IPMI chassis %s command accepted by BMC", name), nil
+}
+
+// withIPMIClient は BMC とのセッションを確立して fn を実行し、セッションを閉じます。
+func withIPMIClient(config *MonitorTarget, fn func(c *ipmi.Client) error) error {
+	client, err := ipmi.Dial(config.BMCAddress, config.BMCUser, config.BMCPass, ipmiTimeout)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return fn(client)
+}
+
+// IPMIドライバ END===========================================================END
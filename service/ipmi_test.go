@@ -0,0 +1,71 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"srv_mng/ipmi"
+)
+
+// newIPMITarget は、BMC シミュレータを起動し、それを使用するターゲットの設定を返します。
+func newIPMITarget(t *testing.T) (*ipmi.Simulator, *MonitorTarget) {
+	t.Helper()
+	sim, err := ipmi.NewSimulator(testBMCUser, testBMCPass)
+	if err != nil {
+		t.Fatalf("NewSimulator: %v", err)
+	}
+	t.Cleanup(func() { sim.Close() })
+	return sim, bmcTarget("ipmi", sim.Addr())
+}
+
+// controlName は、シャーシ制御を "0x1" のような文字列にします。
+func controlName(c ipmi.ChassisControl) string {
+	return fmt.Sprintf("%#x", c)
+}
+
+// controlNames は、シミュレータが受け付けたシャーシ制御を順に返す関数を返します。
+func controlNames(sim *ipmi.Simulator) func() []string {
+	return func() []string {
+		var names []string
+		for _, c := range sim.Controls() {
+			names = append(names, controlName(c))
+		}
+		return names
+	}
+}
+
+func TestIPMIDriverControls(t *testing.T) {
+	sim, config := newIPMITarget(t)
+	checkPowerCalls(t, &ipmiDriver{}, config, controlNames(sim), []powerCall{
+		{name: "start", call: callStart, want: controlName(ipmi.PowerUp)},
+		{name: "stop", call: callStop, want: controlName(ipmi.SoftShutdown)},
+		{name: "stop force", call: callForceStop, want: controlName(ipmi.PowerDown)},
+		{name: "reboot", call: callReboot, want: controlName(ipmi.PowerCycle)},
+		{name: "reboot force", call: callForceReboot, want: controlName(ipmi.HardReset)},
+	})
+}
+
+func TestIPMIDriverStatus(t *testing.T) {
+	sim, config := newIPMITarget(t)
+	d := &ipmiDriver{}
+
+	sim.SetPowerOn(true)
+	if got := d.Status(config); got != StatusRunning {
+		t.Errorf("status with power on = %s, want %s", got, StatusRunning)
+	}
+	sim.SetPowerOn(false)
+	if got := d.Status(config); got != StatusUnreachable {
+		t.Errorf("status with power off = %s, want %s", got, StatusUnreachable)
+	}
+
+	config.BMCPass = "wrong"
+	if got := d.Status(config); got != StatusUnknown {
+		t.Errorf("status with wrong password = %s, want %s", got, StatusUnknown)
+	}
+	if _, err := d.Start(config, PowerOptions{}); err == nil {
+		t.Error("start with wrong password succeeded")
+	}
+	if controls := sim.Controls(); len(controls) != 0 {
+		t.Errorf("controls = %v, want none", controls)
+	}
+}
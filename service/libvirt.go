@@ -0,0 +1,157 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// libvirtドライバ START===========================================================START
+
+// libvirtDriver は、ハイパーバイザ上の power_agent に virsh を実行させて KVM ゲストを制御するドライバです。
+// vm ターゲットの既定ドライバで、hypervisor には power_agent が動作する host ターゲットの名前を指定します。
+type libvirtDriver struct{}
+
+func init() {
+	RegisterPowerDriver("libvirt", &libvirtDriver{})
+}
+
+// vmDomain は、操作対象の libvirt ドメイン名を返します。
+func vmDomain(config *MonitorTarget) string {
+	if config.VMDomain != "" {
+		return config.VMDomain
+	}
+	return config.Name
+}
+
+// hypervisorConfig は、VM をホストしているハイパーバイザのターゲット設定を取得します。
+func hypervisorConfig(config *MonitorTarget) (*MonitorTarget, error) {
+	if config.Hypervisor == "" {
+		return nil, fmt.Errorf("hypervisor is not set for vm target '%s'", config.Name)
+	}
+	hv, err := GetTargetConfig(config.Hypervisor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hypervisor '%s': %v", config.Hypervisor, err)
+	}
+	return hv, nil
+}
+
+// Validate は、hypervisor が指定されていることを確認します。
+func (d *libvirtDriver) Validate(config *MonitorTarget) error {
+	if config.Hypervisor == "" {
+		return fmt.Errorf("hypervisor is required for libvirt driver")
+	}
+	if config.Hypervisor == config.Name {
+		return fmt.Errorf("hypervisor must be a different target")
+	}
+	return nil
+}
+
+func (d *libvirtDriver) Start(config *MonitorTarget, _ PowerOptions) (string, error) {
+	return d.action(config, "start")
+}
+
+func (d *libvirtDriver) Stop(config *MonitorTarget, opts PowerOptions) (string, error) {
+	if opts.Delay > 0 {
+		return "", fmt.Errorf("delayed shutdown is not supported by libvirt driver")
+	}
+	if opts.Force {
+		return d.action(config, "destroy")
+	}
+	return d.action(config, "shutdown")
+}
+
+func (d *libvirtDriver) Reboot(config *MonitorTarget, opts PowerOptions) (string, error) {
+	if opts.Force {
+		return d.action(config, "reset")
+	}
+	return d.action(config, "reboot")
+}
+
+// Status は、ハイパーバイザの virsh domstate からドメインの状態を返します。
+func (d *libvirtDriver) Status(config *MonitorTarget) string {
+	state, err := d.domainState(config)
+	if err != nil {
+		log.Printf("[INFO] Health check: libvirt domain '%s' state failed: %v", vmDomain(config), err)
+		return StatusUnknown
+	}
+
+	log.Printf("[INFO] Health check: libvirt domain '%s' is %s", vmDomain(config), state)
+	switch state {
+	case "running":
+		return StatusRunning
+	case "shut off", "crashed":
+		return StatusUnreachable
+	default:
+		return StatusUnknown
+	}
+}
+
+// Capabilities は、ハイパーバイザの power_agent が virsh を実行できれば start/stop/reboot を利用可能とします。
+func (d *libvirtDriver) Capabilities(config *MonitorTarget) *PowerCapabilities {
+	caps := &PowerCapabilities{Actions: []string{}}
+	hv, err := hypervisorConfig(config)
+	if err != nil {
+		log.Printf("[INFO] libvirt capabilities unavailable for '%s': %v", config.Name, err)
+		return caps
+	}
+	agentCaps, err := fetchAgentCapabilities(hv)
+	if err != nil {
+		log.Printf("[INFO] libvirt capabilities unavailable for '%s': %v", config.Name, err)
+		return caps
+	}
+	caps.AgentReachable = true
+	if agentCaps.Libvirt {
+		caps.Actions = append(caps.Actions, "start", "stop", "reboot")
+	}
+	return caps
+}
+
+// action は、ハイパーバイザの power_agent の /vm/<action> を呼び出します。
+func (d *libvirtDriver) action(config *MonitorTarget, action string) (string, error) {
+	hv, err := hypervisorConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	body := map[string]string{"domain": vmDomain(config)}
+	if err := postToAgent(hv, "/vm/"+action, body); err != nil {
+		log.Printf("[ERROR] libvirt %s failed for '%s': %v", action, config.Name, err)
+		return "", fmt.Errorf("failed to %s vm via hypervisor '%s': %v", action, hv.Name, err)
+	}
+
+	log.Printf("[INFO] libvirt %s succeeded for '%s'", action, config.Name)
+	return fmt.Sprintf("virsh %s sent to hypervisor '%s' for domain '%s'", action, hv.Name, vmDomain(config)), nil
+}
+
+// domainState は、ハイパーバイザの power_agent の /vm/state からドメインの状態を取得します。
+func (d *libvirtDriver) domainState(config *MonitorTarget) (string, error) {
+	hv, err := hypervisorConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := fmt.Sprintf("http://%s:%s/vm/state?domain=%s", hv.HostIP, hv.Port, url.QueryEscape(vmDomain(config)))
+	resp, err := getFromAgent(endpoint, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("agent /vm/state returned status code: %d", resp.StatusCode)
+	}
+
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vm state: %v", err)
+	}
+	return body.State, nil
+}
+
+// libvirtドライバ END===========================================================END
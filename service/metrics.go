@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// メトリクス START===========================================================START
+
+// defaultMetricsSamples は、ターゲットごとに保持するメトリクスの既定の件数です (METRICS_SAMPLES)。
+const defaultMetricsSamples = 120
+
+// MetricSample は、1回の死活確認で取得したメトリクスです。
+type MetricSample struct {
+	At        time.Time `json:"at"`
+	Up        bool      `json:"up"`                  // Running または Degraded
+	LatencyMs int64     `json:"latency_ms"`          // 死活確認 (ヘルスチェックを含む) の所要時間
+	CPU       *float64  `json:"cpu_usage,omitempty"` // power_agent の /cpucheck で取得した CPU 使用率 (%)
+}
+
+// metricsStore は、ターゲットごとの直近のメトリクスをメモリ上に保持します。
+var metricsStore = struct {
+	sync.RWMutex
+	size    int
+	samples map[string][]MetricSample
+}{
+	size:    envInt("METRICS_SAMPLES", defaultMetricsSamples),
+	samples: make(map[string][]MetricSample),
+}
+
+// recordMetric は、ターゲットのメトリクスを追加し、古いものを捨てます。
+func recordMetric(name string, sample MetricSample) {
+	metricsStore.Lock()
+	defer metricsStore.Unlock()
+
+	samples := append(metricsStore.samples[name], sample)
+	if len(samples) > metricsStore.size {
+		samples = samples[len(samples)-metricsStore.size:]
+	}
+	metricsStore.samples[name] = samples
+}
+
+// deleteMetrics は、削除されたターゲットのメトリクスを破棄します。
+func deleteMetrics(name string) {
+	metricsStore.Lock()
+	delete(metricsStore.samples, name)
+	metricsStore.Unlock()
+}
+
+// GetMetrics は、ターゲットごとのメトリクスを古い順に返します。targetName が空の場合は全ターゲットを返します。
+func GetMetrics(targetName string) map[string][]MetricSample {
+	metricsStore.RLock()
+	defer metricsStore.RUnlock()
+
+	result := make(map[string][]MetricSample)
+	for name, samples := range metricsStore.samples {
+		if targetName != "" && name != targetName {
+			continue
+		}
+		result[name] = append([]MetricSample(nil), samples...)
+	}
+	return result
+}
+
+// fetchAgentCPU は、power_agent の /cpucheck から CPU 使用率を取得します。
+func fetchAgentCPU(config *MonitorTarget) (float64, error) {
+	resp, err := getFromAgent(fmt.Sprintf("http://%s:%s/cpucheck", config.HostIP, config.Port), 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("agent returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		CPUUsage float64 `json:"cpu_usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode cpucheck response: %v", err)
+	}
+	return result.CPUUsage, nil
+}
+
+// collectMetric は、観測した状態と所要時間からメトリクスを記録します。
+// power_agent が稼働している場合は CPU 使用率も取得します。
+func collectMetric(config *MonitorTarget, status string, latency time.Duration) {
+	sample := MetricSample{At: time.Now(), Up: isUpStatus(status), LatencyMs: latency.Milliseconds()}
+	if sample.Up {
+		if name, err := DriverNameFor(config); err == nil && name == DefaultPowerDriver {
+			if cpu, err := fetchAgentCPU(config); err == nil {
+				sample.CPU = &cpu
+			}
+		}
+	}
+	recordMetric(config.Name, sample)
+}
+
+// メトリクス END===========================================================END
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// バックグラウンド監視 START===========================================================START
+
+// defaultMonitorInterval は、バックグラウンド監視の既定の間隔です (MONITOR_INTERVAL)。
+const defaultMonitorInterval = 15 * time.Second
+
+// statusCache は、バックグラウンド監視で取得した最新のステータスです。
+// /status や /events の接続ごとにエージェントへ問い合わせないよう、監視結果を共有します。
+var statusCache = struct {
+	sync.RWMutex
+	statuses  []TargetStatus
+	updatedAt time.Time
+	running   bool
+}{}
+
+// refreshMu は、死活確認を同時に1つだけ実行するためのロックです。
+// 並行して実行すると、デバウンスの連続観測回数が重複して数えられるためです。
+var refreshMu sync.Mutex
+
+// RefreshStatuses は、全ターゲットの死活確認を実行してキャッシュを更新します。
+func RefreshStatuses() ([]TargetStatus, error) {
+	refreshMu.Lock()
+	defer refreshMu.Unlock()
+
+	statuses, transitions, err := collectTargetsStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	statusCache.Lock()
+	statusCache.statuses = statuses
+	statusCache.updatedAt = time.Now()
+	statusCache.Unlock()
+
+	// イベントを受け取ったクライアントが /status を取得したとき新しい結果を返せるよう、キャッシュの更新後に配信する
+	for _, t := range transitions {
+		recordTransition(t)
+	}
+	return statuses, nil
+}
+
+// ProbeStatuses は、全ターゲットの死活確認をその場で実行し、デバウンス前の観測結果を返します (/status?refresh=true)。
+// 観測結果はデバウンス・フラップ検知・メトリクスに反映しないため、繰り返し呼び出しても状態は確定しません。
+// 状態の確定はバックグラウンド監視 (RefreshStatuses) のみが行います。
+func ProbeStatuses() ([]TargetStatus, error) {
+	targets, err := GetAllTargetsFromDB()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]TargetStatus, 0, len(targets))
+	for _, target := range targets {
+		status, checks := observeTarget(&target)
+		state, _ := debouncer.current(target.Name)
+		results = append(results, newTargetStatus(&target, status, state, checks))
+	}
+	return results, nil
+}
+
+// GetStatusSnapshot は、バックグラウンド監視の最新結果を返します。
+// 監視が動作していない、またはまだ結果がない場合はその場で死活確認を実行します。
+func GetStatusSnapshot() ([]TargetStatus, error) {
+	statusCache.RLock()
+	statuses, ok := statusCache.statuses, statusCache.running && !statusCache.updatedAt.IsZero()
+	statusCache.RUnlock()
+	if ok {
+		return statuses, nil
+	}
+	return RefreshStatuses()
+}
+
+// StartMonitor は、MONITOR_INTERVAL ごとに全ターゲットの死活確認を行うバックグラウンド監視を開始します。
+func StartMonitor() {
+	interval := envDuration("MONITOR_INTERVAL", defaultMonitorInterval)
+
+	statusCache.Lock()
+	if statusCache.running {
+		statusCache.Unlock()
+		return
+	}
+	statusCache.running = true
+	statusCache.Unlock()
+
+	log.Printf("[INFO] Background monitor started (interval: %s)", interval)
+	go func() {
+		for {
+			if _, err := RefreshStatuses(); err != nil {
+				log.Printf("[ERROR] Background monitor failed: %v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// バックグラウンド監視 END===========================================================END
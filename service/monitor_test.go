@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestProbeStatusesDoesNotCommit は、?refresh=true の死活確認を繰り返しても状態が確定しないことを確認します。
+func TestProbeStatusesDoesNotCommit(t *testing.T) {
+	newTestDB(t)
+	plug := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"POWER":"OFF"}`))
+	}))
+	defer plug.Close()
+
+	config := &MonitorTarget{
+		Name: "plug01", Type: "host", HostIP: "127.0.0.1", Port: "80", PowerDriver: "webhook",
+		Webhook: WebhookConfig{
+			On:     &WebhookRequest{URL: plug.URL + "/on"},
+			Off:    &WebhookRequest{URL: plug.URL + "/off"},
+			Status: &WebhookStatus{WebhookRequest: WebhookRequest{URL: plug.URL + "/status"}, Path: "POWER"},
+		},
+	}
+	saveTestTarget(t, config)
+	since := time.Now().Add(-time.Hour)
+	debouncer.observe(config.Name, StatusRunning, since)
+
+	for i := 0; i < debouncer.config.failThreshold*2; i++ {
+		statuses, err := ProbeStatuses()
+		if err != nil {
+			t.Fatalf("ProbeStatuses: %v", err)
+		}
+		if len(statuses) != 1 || statuses[0].Status != StatusUnreachable || !statuses[0].Since.IsZero() {
+			t.Fatalf("probe %d: statuses = %+v, want live Unreachable without since", i, statuses)
+		}
+	}
+
+	state, _ := debouncer.current(config.Name)
+	if state.stable != StatusRunning || state.count != 0 || !state.since.Equal(since) {
+		t.Errorf("debouncer state = %+v, want Running since %s with no pending observations", state, since)
+	}
+	if history, err := GetStatusHistory(config.Name, 10); err != nil || len(history) != 0 {
+		t.Errorf("history = %+v, %v, want none", history, err)
+	}
+}
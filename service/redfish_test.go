@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testBMC は、Systems コレクションと ComputerSystem.Reset を提供するテスト用の Redfish BMC です。
+type testBMC struct {
+	mu         sync.Mutex
+	powerState string
+	allowed    []string
+	resets     requestLog // 受け付けた ResetType
+}
+
+func (b *testBMC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != testBMCUser || pass != testBMCPass {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/redfish/v1/Systems":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Members": []map[string]string{{"@odata.id": "/redfish/v1/Systems/1"}},
+		})
+	case r.Method == http.MethodGet && r.URL.Path == "/redfish/v1/Systems/1":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"PowerState": b.powerState,
+			"Actions": map[string]interface{}{
+				"#ComputerSystem.Reset": map[string]interface{}{
+					"target":                            "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset",
+					"ResetType@Redfish.AllowableValues": b.allowed,
+				},
+			},
+		})
+	case r.Method == http.MethodPost && r.URL.Path == "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset":
+		var body struct{ ResetType string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b.resets.add(body.ResetType)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newTestBMC は、TLS で応答するテスト用 BMC と、その BMC を使用するターゲットの設定を返します。
+func newTestBMC(t *testing.T) (*testBMC, *MonitorTarget) {
+	t.Helper()
+	bmc := &testBMC{powerState: "On", allowed: []string{"On", "ForceOff", "GracefulShutdown", "ForceRestart"}}
+	config := bmcTarget("redfish", startTestServer(t, bmc, true))
+	config.BMCInsecure = true
+	return bmc, config
+}
+
+func TestRedfishResetTypes(t *testing.T) {
+	bmc, config := newTestBMC(t)
+	d := &redfishDriver{}
+
+	checkPowerCalls(t, d, config, bmc.resets.all, []powerCall{
+		{name: "start", call: callStart, want: "On"},
+		{name: "stop", call: callStop, want: "GracefulShutdown"},
+		{name: "stop force", call: callForceStop, want: "ForceOff"},
+		{name: "reboot", call: callReboot, want: "ForceRestart"},
+	})
+
+	if _, err := d.Stop(config, PowerOptions{Delay: 60}); err == nil {
+		t.Error("delayed stop was accepted")
+	}
+}
+
+func TestRedfishStopFallsBackToForceOff(t *testing.T) {
+	bmc, config := newTestBMC(t)
+	bmc.allowed = []string{"On", "ForceOff"}
+	d := &redfishDriver{}
+
+	if got := strings.Join(d.Capabilities(config).Actions, ","); got != "start,stop" {
+		t.Errorf("capabilities = %s, want start,stop", got)
+	}
+	checkPowerCalls(t, d, config, bmc.resets.all, []powerCall{
+		{name: "stop", call: callStop, want: "ForceOff", message: "GracefulShutdown is not allowed"},
+	})
+}
+
+func TestRedfishResetTypeNotAllowed(t *testing.T) {
+	bmc, config := newTestBMC(t)
+	bmc.allowed = []string{"On"}
+	d := &redfishDriver{}
+
+	if _, err := d.Stop(config, PowerOptions{}); err == nil {
+		t.Fatal("stop succeeded although the BMC allows neither GracefulShutdown nor ForceOff")
+	}
+	if _, err := d.Reboot(config, PowerOptions{}); err == nil {
+		t.Fatal("ForceRestart was sent although the BMC does not allow it")
+	}
+	if resets := bmc.resets.all(); len(resets) != 0 {
+		t.Errorf("resets = %q, want none", resets)
+	}
+	if got := strings.Join(d.Capabilities(config).Actions, ","); got != "start" {
+		t.Errorf("capabilities = %s, want start", got)
+	}
+}
+
+func TestRedfishStatus(t *testing.T) {
+	bmc, config := newTestBMC(t)
+	for _, c := range []struct{ powerState, want string }{
+		{"On", StatusRunning},
+		{"Off", StatusUnreachable},
+		{"PoweringOn", StatusUnknown},
+		{"PoweringOff", StatusUnknown},
+	} {
+		bmc.mu.Lock()
+		bmc.powerState = c.powerState
+		bmc.mu.Unlock()
+		if got := (&redfishDriver{}).Status(config); got != c.want {
+			t.Errorf("PowerState %s: status = %s, want %s", c.powerState, got, c.want)
+		}
+	}
+
+	config.BMCPass = "wrong"
+	if got := (&redfishDriver{}).Status(config); got != StatusUnknown {
+		t.Errorf("status with wrong password = %s, want %s", got, StatusUnknown)
+	}
+}
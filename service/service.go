@@ -2,17 +2,22 @@ package service
 
 import (
 	"bytes"
+	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3" // SQLiteドライバ
+
+	"srv_mng/internal/agentapi"
 )
 
 // 型 START===========================================================START
@@ -20,22 +25,65 @@ import (
 // MonitorTarget は monitor_targets テーブルから読み込まれる設定の構造体です。
 // power_control.sh の実行に必要な全情報を含みます。
 type MonitorTarget struct {
-	Name        string `json:"name"`         // DB column: name
-	Type        string `json:"type"`         // DB column: type ("host" or "container")
-	HostIP      string `json:"host_ip"`      // DB column: host_ip
-	Port        string `json:"port"`         // DB column: port (死活確認用、SSHポートやHTTPポートなど)
-	MacAddress  string `json:"mac_address"`  // DB column: mac_address (WOL用, hostのみ使用)
-	SSHUser     string `json:"ssh_user"`     // DB column: ssh_user (SSH Shutdown用, hostのみ使用)
-	SSHPass     string `json:"ssh_pass"`     // DB column: ssh_pass (SSH Shutdown用, hostのみ使用)
-	BroadcastIP string `json:"broadcast_ip"` // DB column: broadcast_ip (WOL用, hostのみ使用)
+	Name        string        `json:"name"`             // DB column: name
+	Type        string        `json:"type"`             // DB column: type ("host", "container" or "vm")
+	HostIP      string        `json:"host_ip"`          // DB column: host_ip
+	Port        string        `json:"port"`             // DB column: port (死活確認用、SSHポートやHTTPポートなど)
+	MacAddress  string        `json:"mac_address"`      // DB column: mac_address (WOL用, hostのみ使用)
+	SSHUser     string        `json:"ssh_user"`         // DB column: ssh_user (SSH Shutdown用, hostのみ使用)
+	SSHPass     string        `json:"ssh_pass"`         // DB column: ssh_pass (SSH Shutdown用, hostのみ使用)
+	BroadcastIP string        `json:"broadcast_ip"`     // DB column: broadcast_ip (WOL用, hostのみ使用)
+	SSHPort     string        `json:"ssh_port"`         // DB column: ssh_port (SSHドライバ用, 空の場合は22)
+	SSHKeyPath  string        `json:"ssh_key_path"`     // DB column: ssh_key_path (SSHドライバの秘密鍵ファイル, ssh_passはパスフレーズ/sudo用)
+	PowerDriver string        `json:"power_driver"`     // DB column: power_driver (PowerDriverNames() のいずれか, 空の場合は種別の既定値)
+	BMCAddress  string        `json:"bmc_address"`      // DB column: bmc_address (Redfish/IPMI用, "host[:port]"。Redfishは "https://host" も可)
+	BMCUser     string        `json:"bmc_user"`         // DB column: bmc_user (Redfish/IPMI用)
+	BMCPass     string        `json:"bmc_pass"`         // DB column: bmc_pass (Redfish/IPMI用)
+	BMCInsecure bool          `json:"bmc_insecure"`     // DB column: bmc_insecure (Redfish用, BMCの自己署名証明書を許可する場合はtrue)
+	DockerHost  string        `json:"docker_host"`      // DB column: docker_host (containerのみ使用, "unix:///var/run/docker.sock" や "tcp://host:2375")
+	ContainerID string        `json:"container_id"`     // DB column: container_id (containerのみ使用, コンテナ名またはID。空の場合はname)
+	Hypervisor  string        `json:"hypervisor"`       // DB column: hypervisor (vmのみ使用, virshを実行するpower_agentが動作するhostターゲット名)
+	VMDomain    string        `json:"vm_domain"`        // DB column: vm_domain (vmのみ使用, libvirtのドメイン名。空の場合はname)
+	Webhook     WebhookConfig `json:"webhook,omitzero"` // DB column: webhook_config (webhookドライバ用のリクエスト定義, JSON)
+	Checks      HealthChecks  `json:"checks,omitempty"` // DB column: checks (追加のヘルスチェック定義, JSON)
+	Maintenance bool          `json:"maintenance"`      // DB column: maintenance (trueの間は死活監視を行わず Maintenance と表示)
+	Tags        Tags          `json:"tags,omitempty"`   // DB column: tags (セレクタで絞り込むためのタグ, JSON)
+}
+
+// Redacted は、パスワードなどの秘密情報を空にしたコピーを返します。一覧APIなどで使用します。
+func (t MonitorTarget) Redacted() MonitorTarget {
+	t.SSHPass = ""
+	t.BMCPass = ""
+	t.Webhook = t.Webhook.Redacted()
+	return t
 }
 
 // TargetStatus は、APIエンドポイントで返す監視対象のステータス構造体です。
 type TargetStatus struct {
-	Type     string `json:"type"`      // "host", "container"
-	Name     string `json:"name"`      // ターゲット名
-	HostPort string `json:"host_port"` // IP:Port
-	Status   string `json:"status"`    // "Running", "Stopped/Unreachable", "Unknown"
+	Type     string        `json:"type"`               // "host", "container", "vm"
+	Name     string        `json:"name"`               // ターゲット名
+	HostPort string        `json:"host_port"`          // 死活監視の接続先 (ssh ドライバでは SSH ポート、redfish/ipmi では BMC)
+	Status   string        `json:"status"`             // Status* 定数のいずれか (state.go)
+	Flapping bool          `json:"flapping,omitempty"` // 短時間に状態が変化し続けている
+	Since    time.Time     `json:"since,omitzero"`     // 現在の状態になった時刻
+	Checks   []CheckResult `json:"checks,omitempty"`   // 追加のヘルスチェックの個別結果
+	Tags     []string      `json:"tags,omitempty"`     // ターゲットのタグ
+}
+
+// PowerOptions は電源操作に付随するオプションです。
+type PowerOptions struct {
+	Delay   int    // シャットダウンまでの猶予 (分)。0 の場合は即時
+	Message string // ログイン中のユーザーへ送る wall メッセージ
+	Force   bool   // 強制停止 (対応するドライバのみ。Redfish では ForceOff)
+}
+
+// PowerCapabilities は、ターゲットで実行可能な電源操作の一覧です。
+type PowerCapabilities struct {
+	Target         string   `json:"target"`
+	Driver         string   `json:"driver"`
+	Actions        []string `json:"actions"`                   // "start", "stop", "cancel", "reboot", "suspend", "hibernate"
+	AgentReachable bool     `json:"agent_reachable,omitempty"` // エージェントから能力情報を取得できたか (wol+agent, libvirt のみ)
+	PrivilegeMode  string   `json:"privilege_mode,omitempty"`  // エージェントの特権モード ("sudo-password", "sudoers", "logind")
 }
 
 // 型 END===========================================================END
@@ -45,6 +93,96 @@ type TargetStatus struct {
 // DB接続
 var db *sql.DB
 
+// targetColumns は monitor_targets テーブルのカラム一覧です。SELECT/INSERT で共通に使用します。
+const targetColumns = "name, type, host_ip, port, mac_address, ssh_user, ssh_pass, broadcast_ip, ssh_port, ssh_key_path, power_driver, " +
+	"bmc_address, bmc_user, bmc_pass, bmc_insecure, docker_host, container_id, hypervisor, vm_domain, webhook_config, checks, maintenance, tags"
+
+// targetMigrations は、初期スキーマ以降に追加されたカラムです。
+// 既存のDBファイルに対して ALTER TABLE で追加します。
+var targetMigrations = []struct {
+	column     string
+	definition string
+}{
+	{"ssh_port", "TEXT NOT NULL DEFAULT ''"},
+	{"ssh_key_path", "TEXT NOT NULL DEFAULT ''"},
+	{"power_driver", "TEXT NOT NULL DEFAULT ''"},
+	{"bmc_address", "TEXT NOT NULL DEFAULT ''"},
+	{"bmc_user", "TEXT NOT NULL DEFAULT ''"},
+	{"bmc_pass", "TEXT NOT NULL DEFAULT ''"},
+	{"bmc_insecure", "INTEGER NOT NULL DEFAULT 0"},
+	{"docker_host", "TEXT NOT NULL DEFAULT ''"},
+	{"container_id", "TEXT NOT NULL DEFAULT ''"},
+	{"hypervisor", "TEXT NOT NULL DEFAULT ''"},
+	{"vm_domain", "TEXT NOT NULL DEFAULT ''"},
+	{"webhook_config", "TEXT NOT NULL DEFAULT ''"},
+	{"checks", "TEXT NOT NULL DEFAULT ''"},
+	{"maintenance", "INTEGER NOT NULL DEFAULT 0"},
+	{"tags", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// scanFields は、targetColumns の順にScan先のポインタを返します。
+func (t *MonitorTarget) scanFields() []interface{} {
+	return []interface{}{
+		&t.Name,
+		&t.Type,
+		&t.HostIP,
+		&t.Port,
+		&t.MacAddress,
+		&t.SSHUser,
+		&t.SSHPass,
+		&t.BroadcastIP,
+		&t.SSHPort,
+		&t.SSHKeyPath,
+		&t.PowerDriver,
+		&t.BMCAddress,
+		&t.BMCUser,
+		&t.BMCPass,
+		&t.BMCInsecure,
+		&t.DockerHost,
+		&t.ContainerID,
+		&t.Hypervisor,
+		&t.VMDomain,
+		&t.Webhook,
+		&t.Checks,
+		&t.Maintenance,
+		&t.Tags,
+	}
+}
+
+// placeholders は、n 個のプレースホルダ "?, ?, ..." を返します。
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// values は、targetColumns の順にINSERTする値を返します。
+func (t *MonitorTarget) values() []interface{} {
+	return []interface{}{
+		t.Name,
+		t.Type,
+		t.HostIP,
+		t.Port,
+		t.MacAddress,
+		t.SSHUser,
+		t.SSHPass,
+		t.BroadcastIP,
+		t.SSHPort,
+		t.SSHKeyPath,
+		t.PowerDriver,
+		t.BMCAddress,
+		t.BMCUser,
+		t.BMCPass,
+		t.BMCInsecure,
+		t.DockerHost,
+		t.ContainerID,
+		t.Hypervisor,
+		t.VMDomain,
+		t.Webhook,
+		t.Checks,
+		t.Maintenance,
+		t.Tags,
+	}
+}
+
 // InitDB はデータベース接続を初期化します。
 // DSN (Data Source Name) は SQLite ファイルのパスを想定しています。
 func InitDB(dsn string) error {
@@ -65,10 +203,20 @@ func InitDB(dsn string) error {
 	return nil
 }
 
+// CloseDB は、InitDB で開いたデータベース接続を閉じます。
+func CloseDB() error {
+	if db == nil {
+		return nil
+	}
+	err := db.Close()
+	db = nil
+	return err
+}
+
 // CreateInitialTables は monitor_targets テーブルが存在しない場合に作成します。
 func CreateInitialTables() error {
 	if db == nil {
-		return fmt.Errorf("database connection not initialized")
+		return errNoDB()
 	}
 
 	// テーブル作成クエリ
@@ -89,6 +237,16 @@ func CreateInitialTables() error {
 		return fmt.Errorf("failed to create monitor_targets table: %w", err)
 	}
 
+	// 追加カラムのマイグレーション
+	if err := migrateMonitorTargets(); err != nil {
+		return err
+	}
+
+	// 状態変化の履歴テーブル
+	if err := createStatusEventsTable(); err != nil {
+		return err
+	}
+
 	// 初期データの挿入 (ダミーデータ。パスワードは安全のため空欄にしています)
 	insertDataSQL := `
 	INSERT OR IGNORE INTO monitor_targets 
@@ -104,37 +262,76 @@ func CreateInitialTables() error {
 	return nil
 }
 
+// migrateMonitorTargets は、monitor_targets に存在しないカラムを追加します。
+func migrateMonitorTargets() error {
+	rows, err := db.Query("PRAGMA table_info(monitor_targets)")
+	if err != nil {
+		return fmt.Errorf("failed to read monitor_targets schema: %w", err)
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan monitor_targets schema: %w", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for _, m := range targetMigrations {
+		if existing[m.column] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE monitor_targets ADD COLUMN %s %s", m.column, m.definition)); err != nil {
+			return fmt.Errorf("failed to add column '%s' to monitor_targets: %w", m.column, err)
+		}
+		log.Printf("[INFO] Added column '%s' to monitor_targets", m.column)
+	}
+	return nil
+}
+
 // SaveMonitorTarget は、ターゲット設定をDBに保存（または既存のものを更新）します。
 func SaveMonitorTarget(config *MonitorTarget) error {
 	if db == nil {
 		log.Printf("[ERROR] database connection not initialized")
-		return fmt.Errorf("database connection not initialized")
+		return errNoDB()
 	}
-	if config.Name == "" || config.HostIP == "" || config.Port == "" || config.Type == "" {
-		log.Printf("[ERROR] name, host_ip, port, and type are required fields Name:'%s', HostIP:'%s', Port:'%s', Type:'%s'", config.Name, config.HostIP, config.Port, config.Type)
-		return fmt.Errorf("name, host_ip, port, and type are required fields")
+	// 誤りのある項目をまとめて返す (API は項目ごとのエラーの一覧を error.details で返す)
+	if err := ValidateMonitorTarget(config); err != nil {
+		log.Printf("[ERROR] invalid configuration for target '%s': %v", config.Name, err)
+		return err
+	}
+
+	// managed_by=file タグは API から付け外しできない (インベントリファイルの反映でのみ変更する)
+	old := &MonitorTarget{}
+	err := db.QueryRow("SELECT "+targetColumns+" FROM monitor_targets WHERE name = ?", config.Name).Scan(old.scanFields()...)
+	if err == sql.ErrNoRows {
+		old = nil
+	} else if err != nil {
+		log.Printf("[ERROR] database query error: %v", err)
+		return withKind(ErrUnavailable, fmt.Errorf("database query error: %w", err))
+	}
+	if err := checkManagedByTag(old, config); err != nil {
+		log.Printf("[ERROR] invalid configuration for target '%s': %v", config.Name, err)
+		return &ValidationError{Errors: []FieldError{{Field: "tags", Message: err.Error()}}}
+	}
+	// GET で取得した (webhook の headers が伏せ字の) 設定をそのまま保存しても、既存の値を引き継ぐ
+	if old != nil {
+		config.Webhook.restoreSecrets(old.Webhook)
 	}
 
 	// INSERT OR REPLACE は、PRIMARY KEY(name)が衝突した場合に既存の行を削除し、新しい行を挿入します。
-	query := `
-	INSERT OR REPLACE INTO monitor_targets 
-	(name, type, host_ip, port, mac_address, ssh_user, ssh_pass, broadcast_ip) 
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`
-	_, err := db.Exec(query,
-		config.Name,
-		config.Type,
-		config.HostIP,
-		config.Port,
-		config.MacAddress,
-		config.SSHUser,
-		config.SSHPass,
-		config.BroadcastIP,
-	)
+	query := "INSERT OR REPLACE INTO monitor_targets (" + targetColumns + ") VALUES (" + placeholders(len(config.values())) + ")"
+	_, err = db.Exec(query, config.values()...)
 
 	if err != nil {
 		log.Printf("[ERROR] Failed to save target '%s': %v", config.Name, err)
-		return fmt.Errorf("failed to save target config to database: %w", err)
+		return withKind(ErrUnavailable, fmt.Errorf("failed to save target config to database: %w", err))
 	}
 
 	log.Printf("[INFO] Target saved/updated: %s (%s)", config.Name, config.HostIP)
@@ -144,82 +341,138 @@ func SaveMonitorTarget(config *MonitorTarget) error {
 // GetTargetConfig は指定されたターゲットの設定をDBから取得
 func GetTargetConfig(targetName string) (*MonitorTarget, error) {
 	if db == nil {
-		return nil, fmt.Errorf("database connection not initialized")
+		return nil, errNoDB()
 	}
 
 	// DBから全フィールドを選択
-	query := "SELECT name, type, host_ip, port, mac_address, ssh_user, ssh_pass, broadcast_ip FROM monitor_targets WHERE name = ?"
+	query := "SELECT " + targetColumns + " FROM monitor_targets WHERE name = ?"
 
 	config := &MonitorTarget{}
-	err := db.QueryRow(query, targetName).Scan(
-		&config.Name,
-		&config.Type,
-		&config.HostIP,
-		&config.Port,
-		&config.MacAddress,
-		&config.SSHUser,
-		&config.SSHPass,
-		&config.BroadcastIP,
-	)
+	err := db.QueryRow(query, targetName).Scan(config.scanFields()...)
 
 	if err == sql.ErrNoRows {
 		log.Printf("[ERROR] target '%s' not found in database", targetName)
-		return nil, fmt.Errorf("target '%s' not found in database", targetName)
+		return nil, errTargetNotFound(targetName)
 	}
 	if err != nil {
-		log.Printf("[ERROR] database query error: %w", err)
-		return nil, fmt.Errorf("database query error: %w", err)
+		log.Printf("[ERROR] database query error: %v", err)
+		return nil, withKind(ErrUnavailable, fmt.Errorf("database query error: %w", err))
 	}
 	log.Printf("[SUCCESS] GetTarget query succeed")
 	return config, nil
 }
 
+// SetMaintenance は、ターゲットのメンテナンスモードを切り替えます。
+func SetMaintenance(targetName string, enabled bool) error {
+	if db == nil {
+		return errNoDB()
+	}
+
+	result, err := db.Exec("UPDATE monitor_targets SET maintenance = ? WHERE name = ?", enabled, targetName)
+	if err != nil {
+		log.Printf("[ERROR] failed to update maintenance for '%s': %v", targetName, err)
+		return withKind(ErrUnavailable, fmt.Errorf("failed to update maintenance: %w", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errTargetNotFound(targetName)
+	}
+	log.Printf("[SUCCESS] Maintenance for target '%s' set to %t", targetName, enabled)
+	return nil
+}
+
+// UpdateMonitorTarget は、既存のターゲット設定に patch (JSON) で指定された項目のみを上書きして保存します。
+// patch に含まれない項目は既存の値を引き継ぐため、パスワードを再送する必要はありません。
+func UpdateMonitorTarget(targetName string, patch []byte) (*MonitorTarget, error) {
+	config, err := GetTargetConfig(targetName)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, config); err != nil {
+		return nil, withKind(ErrInvalid, fmt.Errorf("invalid JSON format: %v", err))
+	}
+	if config.Name != targetName {
+		return nil, withKind(ErrConflict, fmt.Errorf("target name cannot be changed ('%s' -> '%s')", targetName, config.Name))
+	}
+	if err := SaveMonitorTarget(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// DeleteMonitorTarget は、ターゲットをDBから削除し、監視の状態も破棄します。
+func DeleteMonitorTarget(targetName string) error {
+	if db == nil {
+		return errNoDB()
+	}
+
+	result, err := db.Exec("DELETE FROM monitor_targets WHERE name = ?", targetName)
+	if err != nil {
+		log.Printf("[ERROR] Failed to delete target '%s': %v", targetName, err)
+		return withKind(ErrUnavailable, fmt.Errorf("failed to delete target: %w", err))
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errTargetNotFound(targetName)
+	}
+
+	debouncer.forget(targetName)
+	deleteMetrics(targetName)
+	log.Printf("[INFO] Target deleted: %s", targetName)
+	return nil
+}
+
+// ListMonitorTargets は、すべてのターゲットの設定を名前順に返します。ターゲットがない場合は空のスライスを返します。
+func ListMonitorTargets() ([]MonitorTarget, error) {
+	if db == nil {
+		return nil, errNoDB()
+	}
+	return queryTargets("SELECT " + targetColumns + " FROM monitor_targets ORDER BY name")
+}
+
 // GetAllTargetsFromDB はすべてのターゲットの設定をDBから取得します。
 func GetAllTargetsFromDB() ([]MonitorTarget, error) {
 	if db == nil {
-		return nil, fmt.Errorf("database connection not initialized")
+		return nil, errNoDB()
 	}
 
-	query := "SELECT name, type, host_ip, port, mac_address, ssh_user, ssh_pass, broadcast_ip FROM monitor_targets"
-	rows, err := db.Query(query)
+	targets, err := queryTargets("SELECT " + targetColumns + " FROM monitor_targets")
 	if err != nil {
-		log.Printf("[ERROR] database query error: %w", err)
-		return nil, fmt.Errorf("database query error: %w", err)
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		// データがない場合もエラーとして扱う
+		log.Printf("[ERROR] no monitoring targets found in database")
+		return nil, withKind(ErrNotFound, fmt.Errorf("no monitoring targets found in database"))
+	}
+	log.Printf("[INFO] GetALLTarget query succeed")
+	return targets, nil
+}
+
+// queryTargets は、targetColumns を選択するクエリを実行し、ターゲット設定の一覧を返します。
+func queryTargets(query string, args ...interface{}) ([]MonitorTarget, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("[ERROR] database query error: %v", err)
+		return nil, withKind(ErrUnavailable, fmt.Errorf("database query error: %w", err))
 	}
 	defer rows.Close()
 
-	var targets []MonitorTarget
+	targets := []MonitorTarget{}
 	for rows.Next() {
 		config := MonitorTarget{}
-		err := rows.Scan(
-			&config.Name,
-			&config.Type,
-			&config.HostIP,
-			&config.Port,
-			&config.MacAddress,
-			&config.SSHUser,
-			&config.SSHPass,
-			&config.BroadcastIP,
-		)
+		err := rows.Scan(config.scanFields()...)
 		if err != nil {
 			// DBスキーマと構造体が一致しない、またはデータエラー
-			log.Printf("[ERROR] error scanning row from database: %w", err)
-			return nil, fmt.Errorf("error scanning row from database: %w", err)
+			log.Printf("[ERROR] error scanning row from database: %v", err)
+			return nil, withKind(ErrUnavailable, fmt.Errorf("error scanning row from database: %w", err))
 		}
 		targets = append(targets, config)
 	}
 
 	if err = rows.Err(); err != nil {
-		log.Printf("[ERROR] error iterating over database rows: %w", err)
-		return nil, fmt.Errorf("error iterating over database rows: %w", err)
+		log.Printf("[ERROR] error iterating over database rows: %v", err)
+		return nil, withKind(ErrUnavailable, fmt.Errorf("error iterating over database rows: %w", err))
 	}
-
-	if len(targets) == 0 {
-		// データがない場合もエラーとして扱う
-		log.Printf("[ERROR] no monitoring targets found in database")
-		return nil, fmt.Errorf("no monitoring targets found in database")
-	}
-	log.Printf("[INFO] GetALLTarget query succeed")
 	return targets, nil
 }
 
@@ -227,24 +480,141 @@ func GetAllTargetsFromDB() ([]MonitorTarget, error) {
 
 // 電源操作 START===========================================================START
 
-// ExecutePowerScript は、すべての電源ON/OFF操作を行うサービスロジックです。
-// Goコードで直接WOLパケットを送信し、エージェント経由でシャットダウンを実行します。
-func ExecutePowerScript(action string, config *MonitorTarget) (string, error) {
-	log.Printf("[INFO] Executing power action '%s' for target '%s'...", action, config.Name)
+// ExecutePowerScript は、すべての電源操作を行うサービスロジックです。
+// ターゲットの power_driver（未指定の場合は種別の既定値）に対応する電源ドライバへ処理を委譲します。
+func ExecutePowerScript(action string, config *MonitorTarget, opts PowerOptions) (string, error) {
+	driver, driverName, err := driverFor(config)
+	if err != nil {
+		return "", withKind(ErrInvalid, err)
+	}
+	// start/stop/reboot 以外はドライバが対応している場合のみ実行 ("started" のイベントを通知する前に確認する)
+	actionDriver, isActionDriver := driver.(ActionDriver)
+	if action != "start" && action != "stop" && action != "reboot" && !isActionDriver {
+		return "", withKind(ErrInvalid, fmt.Errorf("action '%s' is not supported by power driver '%s'", action, driverName))
+	}
+	// 同じ操作の二重実行 (ボタンの連打など) を防ぐ。force の場合は進行中でも実行する
+	if !opts.Force && transitionInProgress(config.Name, action) {
+		return "", withKind(ErrConflict, fmt.Errorf("power action '%s' for target '%s' is already in progress", action, config.Name))
+	}
+	log.Printf("[INFO] Executing power action '%s' for target '%s' (driver: %s)...", action, config.Name, driverName)
+	PublishEvent(EventPower, PowerEvent{Target: config.Name, Action: action, Phase: "started", At: time.Now()})
 
+	var output string
 	switch action {
 	case "start":
-		// WOLパケットを直接送信
-		return sendWOLPacket(config.MacAddress, config.BroadcastIP, config.Name)
-		
+		output, err = driver.Start(config, opts)
 	case "stop":
-		// エージェント経由でシャットダウン
-		return shutdownViaAgent(config)
+		output, err = driver.Stop(config, opts)
+	case "reboot":
+		output, err = driver.Reboot(config, opts)
+	default:
+		output, err = actionDriver.Action(action, config, opts)
+	}
+	if err != nil {
+		PublishEvent(EventPower, PowerEvent{Target: config.Name, Action: action, Phase: "failed", Message: err.Error(), At: time.Now()})
+		return output, err
+	}
+	PublishEvent(EventPower, PowerEvent{Target: config.Name, Action: action, Phase: "succeeded", Message: output, At: time.Now()})
+
+	// 受け付けた操作に応じて PoweringOn / ShuttingDown を表示し、監視結果にもすぐ反映する
+	beginTransition(config.Name, action, opts.Delay)
+	go RefreshStatuses()
+	return output, nil
+}
+
+// GetPowerCapabilities は、ターゲットで実行可能な電源操作を返します。
+func GetPowerCapabilities(config *MonitorTarget) (*PowerCapabilities, error) {
+	driver, driverName, err := driverFor(config)
+	if err != nil {
+		return nil, withKind(ErrInvalid, err)
+	}
+
+	caps := driver.Capabilities(config)
+	caps.Target = config.Name
+	caps.Driver = driverName
+	if caps.Actions == nil {
+		caps.Actions = []string{}
+	}
+	return caps, nil
+}
+
+// wolAgentDriver は、WOLで起動し power_agent 経由で停止・再起動などを行う既定の電源ドライバです。
+type wolAgentDriver struct{}
+
+func init() {
+	RegisterPowerDriver(DefaultPowerDriver, &wolAgentDriver{})
+}
+
+func (d *wolAgentDriver) Start(config *MonitorTarget, _ PowerOptions) (string, error) {
+	// WOLパケットを直接送信
+	return sendWOLPacket(config.MacAddress, config.BroadcastIP, config.Name)
+}
+
+func (d *wolAgentDriver) Stop(config *MonitorTarget, opts PowerOptions) (string, error) {
+	// エージェント経由でシャットダウン
+	return shutdownViaAgent(config, opts)
+}
+
+func (d *wolAgentDriver) Reboot(config *MonitorTarget, _ PowerOptions) (string, error) {
+	// エージェント経由で systemctl reboot を実行
+	return systemActionViaAgent(config, "reboot")
+}
+
+func (d *wolAgentDriver) Action(action string, config *MonitorTarget, opts PowerOptions) (string, error) {
+	switch action {
+	case "cancel":
+		// エージェント経由で予約済みシャットダウンを取り消し
+		return cancelShutdownViaAgent(config, opts)
+	case "suspend", "hibernate":
+		// エージェント経由で systemctl を実行
+		return systemActionViaAgent(config, action)
 	default:
 		return "", fmt.Errorf("unsupported action: %s", action)
 	}
 }
 
+// Status は、power_agent の /status で死活確認を行います。
+// エージェントが応答しない場合は ICMP と SSH ポートで到達性を確認し、AgentDown と Unreachable を区別します。
+func (d *wolAgentDriver) Status(config *MonitorTarget) string {
+	if CheckServiceStatus(config.HostIP, config.Port) == StatusRunning {
+		return StatusRunning
+	}
+	if hostReachable(config.HostIP, sshPort(config)) {
+		log.Printf("[INFO] Health check: %s is reachable but power_agent is down", config.HostIP)
+		return StatusAgentDown
+	}
+	return StatusUnreachable
+}
+
+// Capabilities は、start を WOL に必要な情報の有無で判定し、それ以外はエージェントの /capabilities から取得します。
+func (d *wolAgentDriver) Capabilities(config *MonitorTarget) *PowerCapabilities {
+	caps := &PowerCapabilities{Actions: []string{}}
+	if config.MacAddress != "" && config.BroadcastIP != "" {
+		caps.Actions = append(caps.Actions, "start")
+	}
+
+	agentCaps, err := fetchAgentCapabilities(config)
+	if err != nil {
+		// エージェントが停止中でも start の情報は返す
+		log.Printf("[INFO] Agent capabilities unavailable for '%s': %v", config.Name, err)
+		return caps
+	}
+	caps.AgentReachable = true
+	caps.PrivilegeMode = agentCaps.PrivilegeMode
+	if caps.PrivilegeMode == "" {
+		caps.PrivilegeMode = "sudo-password"
+	}
+
+	for _, a := range agentCaps.Actions {
+		// エージェントの shutdown は API の stop に相当する
+		if a == "shutdown" {
+			a = "stop"
+		}
+		caps.Actions = append(caps.Actions, a)
+	}
+	return caps
+}
+
 // sendWOLPacket は、指定されたMACアドレスにWOLパケットを送信します。
 func sendWOLPacket(macAddress string, broadcastIP string, Name string) (string, error) {
 	// MACアドレスをバイト配列に変換
@@ -314,92 +684,338 @@ func buildWOLPacket(macBytes []byte) []byte {
 	return pkt
 }
 
+// agentPowerRequest は、エージェントの電源操作エンドポイントに送るリクエストボディです。
+type agentPowerRequest struct {
+	Password string `json:"password,omitempty"`
+	Delay    int    `json:"delay,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// agentCapabilities は、エージェントの /capabilities の応答です。
+type agentCapabilities struct {
+	Actions       []string `json:"actions"`
+	PrivilegeMode string   `json:"privilege_mode"` // "sudo-password", "sudoers", "logind"
+	Libvirt       bool     `json:"libvirt"`        // virsh によるVM操作が可能か
+
+	authenticated bool // 応答したエージェントが共有トークンを持つことを証明したか
+}
+
+// requiresPassword は、エージェントが sudo のパスワードを必要とするモードで動作しているかを返します。
+// privilege_mode を返さない古いエージェントはパスワードが必要とみなします。
+func (c *agentCapabilities) requiresPassword() bool {
+	return c.PrivilegeMode == "" || c.PrivilegeMode == "sudo-password"
+}
+
+// newAgentPowerRequest は、エージェントの特権モードを確認してリクエストボディを組み立てます。
+// パスワードはエージェントが sudo-password モードの場合にのみ送信します。
+// SRVMNG_AGENT_TOKEN が設定されている場合は、/capabilities の応答でトークンを持つことを証明したエージェントにのみ送信し、
+// 証明がない (/capabilities のない古いエージェント、トークンを確認しないエージェントなど) 場合はパスワードを送らずにエラーとします。
+func newAgentPowerRequest(config *MonitorTarget) (*agentPowerRequest, *agentCapabilities, error) {
+	caps, err := fetchAgentCapabilities(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch agent capabilities: %v", err)
+	}
+
+	body := &agentPowerRequest{}
+	if caps.requiresPassword() {
+		if agentToken() != "" && !caps.authenticated {
+			return nil, nil, fmt.Errorf("agent at %s:%s did not prove that it holds SRVMNG_AGENT_TOKEN; refusing to send the sudo password (set AGENT_TOKEN on the agent)", config.HostIP, config.Port)
+		}
+		body.Password = config.SSHPass // ここでパスワードを設定
+	}
+	return body, caps, nil
+}
+
 // shutdownViaAgent は、エージェント経由でシャットダウンを実行します。
-func shutdownViaAgent(config *MonitorTarget) (string, error) {
-	// エージェントのAPIエンドポイントを構築
-	url := fmt.Sprintf("http://%s:%s/shutdown", config.HostIP, config.Port)
+func shutdownViaAgent(config *MonitorTarget, opts PowerOptions) (string, error) {
+	body, _, err := newAgentPowerRequest(config)
+	if err != nil {
+		return "", err
+	}
+	body.Delay = opts.Delay
+	body.Message = opts.Message
+
+	if err := postToAgent(config, "/shutdown", body); err != nil {
+		return "", fmt.Errorf("failed to shutdown via agent: %v", err)
+	}
+
+	if opts.Delay > 0 {
+		return fmt.Sprintf("Shutdown scheduled via agent in %d minute(s)", opts.Delay), nil
+	}
+	return "Shutdown command sent via agent successfully", nil
+}
+
+// cancelShutdownViaAgent は、エージェント経由で予約済みのシャットダウンを取り消します。
+func cancelShutdownViaAgent(config *MonitorTarget, opts PowerOptions) (string, error) {
+	body, _, err := newAgentPowerRequest(config)
+	if err != nil {
+		return "", err
+	}
+	body.Message = opts.Message
+
+	if err := postToAgent(config, "/cancel", body); err != nil {
+		return "", fmt.Errorf("failed to cancel shutdown via agent: %v", err)
+	}
+
+	return "Scheduled shutdown cancelled via agent successfully", nil
+}
+
+// systemActionViaAgent は、エージェント経由で reboot/suspend/hibernate を実行します。
+// 実行前にエージェントの能力情報を確認し、未対応の操作は送信しません。
+func systemActionViaAgent(config *MonitorTarget, action string) (string, error) {
+	body, caps, err := newAgentPowerRequest(config)
+	if err != nil {
+		return "", err
+	}
+	if !containsString(caps.Actions, action) {
+		return "", withKind(ErrInvalid, fmt.Errorf("action '%s' is not supported by target '%s'", action, config.Name))
+	}
+
+	if err := postToAgent(config, "/"+action, body); err != nil {
+		return "", fmt.Errorf("failed to %s via agent: %v", action, err)
+	}
+
+	return fmt.Sprintf("%s command sent via agent successfully", action), nil
+}
+
+// fetchAgentCapabilities は、エージェントの /capabilities から実行可能な操作と特権モードを取得します。
+// /capabilities を持たない古いエージェントは sudo-password モードで shutdown のみ対応とみなします。
+func fetchAgentCapabilities(config *MonitorTarget) (*agentCapabilities, error) {
+	url := fmt.Sprintf("http://%s:%s/capabilities", config.HostIP, config.Port)
+
+	req, err := newAgentRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// 共有トークンを持つことの証明をエージェントに求める
+	nonce := rand.Text()
+	req.Header.Set(agentapi.NonceHeader, nonce)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &agentCapabilities{Actions: []string{"shutdown"}}, nil
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("agent /capabilities rejected the request (status code: %d); check that SRVMNG_AGENT_TOKEN matches the agent's AGENT_TOKEN", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent /capabilities returned status code: %d", resp.StatusCode)
+	}
+
+	caps := &agentCapabilities{}
+	if err := json.NewDecoder(resp.Body).Decode(caps); err != nil {
+		return nil, fmt.Errorf("failed to decode capabilities: %v", err)
+	}
+	if token := agentToken(); token != "" {
+		caps.authenticated = agentapi.ValidProof(token, nonce, resp.Header.Get(agentapi.ProofHeader))
+	}
+	return caps, nil
+}
 
-	// パスワードを含むJSONボディを構築
-	body := map[string]string{
-		"password": config.SSHPass, // ここでパスワードを設定
+// containsString は、スライスに指定の文字列が含まれているかを返します。
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
 	}
+	return false
+}
+
+// newAgentRequest は、エージェントへのリクエストを作成します。
+// 環境変数 SRVMNG_AGENT_TOKEN が設定されている場合は、エージェントの AGENT_TOKEN と照合する共有トークンを
+// "Authorization: Bearer <token>" ヘッダーで送ります。
+func newAgentRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if token := agentToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// agentToken は、エージェントとの共有トークン (環境変数 SRVMNG_AGENT_TOKEN) を返します。
+func agentToken() string {
+	return os.Getenv("SRVMNG_AGENT_TOKEN")
+}
+
+// getFromAgent は、共有トークンを付けてエージェントへ GET リクエストを送ります。
+func getFromAgent(url string, timeout time.Duration) (*http.Response, error) {
+	req, err := newAgentRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: timeout}
+	return client.Do(req)
+}
+
+// postToAgent は、エージェントの指定パスへJSONボディをPOSTし、200以外をエラーとして返します。
+func postToAgent(config *MonitorTarget, path string, body interface{}) error {
+	// エージェントのAPIエンドポイントを構築
+	url := fmt.Sprintf("http://%s:%s%s", config.HostIP, config.Port, path)
+
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal JSON: %v", err)
+		return fmt.Errorf("failed to marshal JSON: %v", err)
 	}
 
 	// HTTPリクエストを送信
 	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := newAgentRequest("POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return fmt.Errorf("failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to shutdown via agent: %v", err)
+		return err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("agent %s rejected the request (status code: %d); check that SRVMNG_AGENT_TOKEN matches the agent's AGENT_TOKEN", path, resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("agent shutdown returned status code: %d", resp.StatusCode)
+		return fmt.Errorf("agent %s returned status code: %d", path, resp.StatusCode)
 	}
 
-	return "Shutdown command sent via agent successfully", nil
+	return nil
 }
 
 // 電源操作 END===========================================================END
 
 // 死活確認 START===========================================================START
 
-// CheckServiceStatus は、指定されたホストとポートへのTCP接続を試み、死活確認を行います。
-// エージェント経由で死活確認を実行します。
+// CheckServiceStatus は、エージェント経由で死活確認を実行します。
 func CheckServiceStatus(host, port string) string {
 	// エージェントのAPIエンドポイントを構築
 	// 例: http://<host_ip>:<agent_port>/status
 	url := fmt.Sprintf("http://%s:%s/status", host, port)
 
 	// HTTPリクエストを送信
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(url)
+	resp, err := getFromAgent(url, 5*time.Second)
 	if err != nil {
 		log.Printf("[INFO] Health check: %s is Down", url)
-		return "Stopped/Unreachable"
+		return StatusUnreachable
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusOK {
 		log.Printf("[INFO] Health check: %s is Up", url)
-		return "Running"
+		return StatusRunning
 	}
 
 	log.Printf("[INFO] Health check: %s is Down (status code: %d)", url, resp.StatusCode)
-	return "Stopped/Unreachable"
+	return StatusUnreachable
+}
+
+// statusAddress は、/status の host_port に返す接続先を返します。
+// ドライバが AddressDriver を実装していればその値、それ以外は host_ip:port です。
+func statusAddress(config *MonitorTarget) string {
+	if driver, _, err := driverFor(config); err == nil {
+		if addressDriver, ok := driver.(AddressDriver); ok {
+			return addressDriver.Address(config)
+		}
+	}
+	return net.JoinHostPort(config.HostIP, config.Port)
+}
+
+// CheckTCPStatus は、指定されたホストとポートへのTCP接続を試み、死活確認を行います。
+// エージェントを導入していない SSH ドライバのターゲットで使用します。
+func CheckTCPStatus(host, port string) string {
+	address := net.JoinHostPort(host, port)
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		log.Printf("[INFO] Health check: tcp://%s is Down", address)
+		return StatusUnreachable
+	}
+	conn.Close()
+
+	log.Printf("[INFO] Health check: tcp://%s is Up", address)
+	return StatusRunning
 }
 
-// GetAllTargetsStatus は、DBからターゲットリストを読み込み、それぞれの死活確認結果を返します。
-func GetAllTargetsStatus() ([]TargetStatus, error) {
+// collectTargetsStatus は、全ターゲットの死活確認を行い、結果と確定した状態変化を返します。
+// 状態変化の記録と配信は呼び出し側で行います。
+func collectTargetsStatus() ([]TargetStatus, []*StatusTransition, error) {
 	// ターゲットリストをDBから取得
 	targets, err := GetAllTargetsFromDB()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var results []TargetStatus
+	var transitions []*StatusTransition
 	for _, target := range targets {
-		// ホストIPとポートを使って死活確認
-		status := CheckServiceStatus(target.HostIP, target.Port)
+		start := time.Now()
+		status, checks := observeTarget(&target)
+		if !target.Maintenance {
+			collectMetric(&target, status, time.Since(start))
+		}
+
+		// 連続観測回数で状態を確定させる
+		state, transition := debouncer.observe(target.Name, status, time.Now())
+		if transition != nil {
+			transitions = append(transitions, transition)
+		}
+
+		results = append(results, newTargetStatus(&target, state.stable, state, checks))
+	}
+
+	return results, transitions, nil
+}
+
+// newTargetStatus は、ターゲットの status を返す TargetStatus を作成します。
+// since は status が確定した状態と同じ場合のみ設定します。
+func newTargetStatus(target *MonitorTarget, status string, state targetState, checks []CheckResult) TargetStatus {
+	ts := TargetStatus{
+		Type:     target.Type,
+		Name:     target.Name,
+		HostPort: statusAddress(target),
+		Status:   status,
+		Flapping: state.flapping,
+		Checks:   checks,
+		Tags:     target.Tags,
+	}
+	if status == state.stable {
+		ts.Since = state.since
+	}
+	return ts
+}
+
+// observeTarget は、1つのターゲットの現在の状態を観測します。
+// 返す状態はデバウンス前の値です。
+func observeTarget(target *MonitorTarget) (string, []CheckResult) {
+	// メンテナンス中のターゲットは死活確認を行わない
+	if target.Maintenance {
+		return StatusMaintenance, nil
+	}
+
+	// ターゲットの電源ドライバで死活確認
+	status := StatusUnknown
+	if driver, _, err := driverFor(target); err != nil {
+		log.Printf("[ERROR] Health check skipped for '%s': %v", target.Name, err)
+	} else {
+		status = driver.Status(target)
+	}
 
-		results = append(results, TargetStatus{
-			Type:     target.Type,
-			Name:     target.Name,
-			HostPort: fmt.Sprintf("%s:%s", target.HostIP, target.Port),
-			Status:   status,
-		})
+	// 追加のヘルスチェックを実行し、稼働中でも失敗があれば Degraded とする (Running 以外の判定は変えない)
+	checks := RunHealthChecks(target)
+	if status == StatusRunning && !checksPassed(checks) {
+		status = StatusDegraded
 	}
 
-	return results, nil
+	// 電源操作の直後は遷移中の状態を表示
+	return applyTransition(target.Name, status), checks
 }
 
 // 死活確認 END===========================================================END
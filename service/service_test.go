@@ -0,0 +1,247 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"srv_mng/internal/agentapi"
+)
+
+// newTestDB は、一時ディレクトリの SQLite でテーブルを作成し、テストの終了時に閉じます。
+// 初期データのサンプルは削除し、ターゲットが登録されていない状態で返します。
+func newTestDB(t *testing.T) {
+	t.Helper()
+	// テストの DB は残さないため、書き込みごとの fsync を省略する
+	if err := InitDB("file:" + filepath.Join(t.TempDir(), "monitor.db") + "?_sync=OFF"); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { CloseDB() })
+	// main と同様に、初期データの挿入の失敗は無視する (テーブルは作成済み)
+	if err := CreateInitialTables(); err != nil {
+		t.Logf("CreateInitialTables: %v", err)
+	}
+	if _, err := db.Exec("DELETE FROM monitor_targets"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// saveTestTarget は、ターゲットを登録し、テストの終了時にデバウンスの状態を破棄します。
+func saveTestTarget(t *testing.T, config *MonitorTarget) {
+	t.Helper()
+	if err := SaveMonitorTarget(config); err != nil {
+		t.Fatalf("SaveMonitorTarget(%s): %v", config.Name, err)
+	}
+	t.Cleanup(func() { debouncer.forget(config.Name) })
+}
+
+// テスト用 BMC (Redfish・IPMI) の認証情報
+const (
+	testBMCUser = "admin"
+	testBMCPass = "secret"
+)
+
+// bmcTarget は、address で待ち受けるテスト用 BMC を driver で操作するターゲットの設定を返します。
+func bmcTarget(driver, address string) *MonitorTarget {
+	return &MonitorTarget{Name: "bmc01", Type: "host", PowerDriver: driver, BMCAddress: address, BMCUser: testBMCUser, BMCPass: testBMCPass}
+}
+
+// startTestServer は、handler を提供するテスト用の HTTP サーバを起動し、テストの終了時に停止します。
+// useTLS が true の場合は自己署名証明書の HTTPS で待ち受けます。戻り値は "host:port" です。
+func startTestServer(t *testing.T, handler http.Handler, useTLS bool) string {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	if useTLS {
+		server.StartTLS()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+// requestLog は、テスト用サーバが受け付けた操作を順に記録します。
+type requestLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *requestLog) add(entry string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+func (l *requestLog) all() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.entries...)
+}
+
+// powerCall は、電源操作の呼び出しと、その呼び出しでテスト用サーバが受け付けるべき操作です。
+type powerCall struct {
+	name    string
+	call    func(d PowerDriver, config *MonitorTarget) (string, error)
+	want    string // サーバが記録する操作
+	message string // 結果のメッセージに含まれるべき文字列 (空の場合は確認しない)
+}
+
+// よく使う電源操作の呼び出し
+var (
+	callStart       = func(d PowerDriver, c *MonitorTarget) (string, error) { return d.Start(c, PowerOptions{}) }
+	callStop        = func(d PowerDriver, c *MonitorTarget) (string, error) { return d.Stop(c, PowerOptions{}) }
+	callForceStop   = func(d PowerDriver, c *MonitorTarget) (string, error) { return d.Stop(c, PowerOptions{Force: true}) }
+	callReboot      = func(d PowerDriver, c *MonitorTarget) (string, error) { return d.Reboot(c, PowerOptions{}) }
+	callForceReboot = func(d PowerDriver, c *MonitorTarget) (string, error) { return d.Reboot(c, PowerOptions{Force: true}) }
+)
+
+// checkPowerCalls は、calls を順に実行し、呼び出しごとにサーバが1つの操作を受け付け、それが want と一致することを確認します。
+// recorded は、サーバがそれまでに受け付けた操作を順に返します。
+func checkPowerCalls(t *testing.T, d PowerDriver, config *MonitorTarget, recorded func() []string, calls []powerCall) {
+	t.Helper()
+	for i, c := range calls {
+		message, err := c.call(d, config)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if c.message != "" && !strings.Contains(message, c.message) {
+			t.Errorf("%s: message = %q, want it to contain %q", c.name, message, c.message)
+		}
+		if got := recorded(); len(got) != i+1 || got[i] != c.want {
+			t.Errorf("%s: server received %q, want %q last", c.name, got, c.want)
+		}
+	}
+}
+
+// TestExecutePowerScriptUnsupportedAction は、ドライバが対応していない操作では電源操作のイベントを通知しないことを確認します。
+func TestExecutePowerScriptUnsupportedAction(t *testing.T) {
+	ch, _, _, unsubscribe := SubscribeEvents(0)
+	defer unsubscribe()
+
+	config := &MonitorTarget{Name: "bmc01", Type: "host", PowerDriver: "redfish", BMCAddress: "127.0.0.1:1", BMCUser: "admin"}
+	if _, err := ExecutePowerScript("suspend", config, PowerOptions{}); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("err = %v, want ErrInvalid", err)
+	}
+
+	for {
+		select {
+		case ev := <-ch:
+			if pe, ok := ev.Data.(PowerEvent); ok && pe.Target == config.Name {
+				t.Errorf("unexpected power event for unsupported action: %+v", pe)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func TestStatusAddress(t *testing.T) {
+	for _, c := range []struct {
+		config *MonitorTarget
+		want   string
+	}{
+		{&MonitorTarget{Type: "host", HostIP: "192.168.1.10", Port: "8080"}, "192.168.1.10:8080"},
+		{&MonitorTarget{Type: "host", HostIP: "192.168.1.10", Port: "8080", PowerDriver: "ssh"}, "192.168.1.10:22"},
+		{&MonitorTarget{Type: "host", HostIP: "192.168.1.10", Port: "8080", PowerDriver: "ssh", SSHPort: "2222"}, "192.168.1.10:2222"},
+		{&MonitorTarget{Type: "host", HostIP: "192.168.1.10", Port: "8080", PowerDriver: "ipmi", BMCAddress: "192.168.1.110"}, "192.168.1.110"},
+		{&MonitorTarget{Type: "host", HostIP: "fe80::1", Port: "8080"}, "[fe80::1]:8080"},
+	} {
+		if got := statusAddress(c.config); got != c.want {
+			t.Errorf("statusAddress(driver %q) = %q, want %q", c.config.PowerDriver, got, c.want)
+		}
+	}
+}
+
+// testAgent は、/capabilities と /shutdown を提供するテスト用の power_agent です。
+type testAgent struct {
+	token          string // 空でなければ Bearer トークンを確認する
+	privilegeMode  string
+	prove          bool // true の場合、nonce に対するトークンの証明を返す
+	noCapabilities bool // true の場合、/capabilities を持たない古いエージェントとして 404 を返す
+
+	mu        sync.Mutex
+	passwords []string
+}
+
+func (a *testAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.token != "" && r.Header.Get("Authorization") != "Bearer "+a.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/capabilities":
+		if a.noCapabilities {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if a.prove {
+			w.Header().Set(agentapi.ProofHeader, agentapi.TokenProof(a.token, r.Header.Get(agentapi.NonceHeader)))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"actions": []string{"shutdown"}, "privilege_mode": a.privilegeMode})
+	case "/shutdown":
+		var body agentPowerRequest
+		json.NewDecoder(r.Body).Decode(&body)
+		a.mu.Lock()
+		a.passwords = append(a.passwords, body.Password)
+		a.mu.Unlock()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// TestAgentPasswordDecision は、エージェントの特権モードとトークンの証明に応じて sudo のパスワードを送るかを確認します。
+func TestAgentPasswordDecision(t *testing.T) {
+	cases := []struct {
+		name         string
+		managerToken string
+		agent        *testAgent
+		wantErr      bool
+		wantPassword string // wantErr でない場合に /shutdown が受け取るパスワード
+	}{
+		{"no token, sudo-password", "", &testAgent{privilegeMode: "sudo-password"}, false, "secret"},
+		{"no token, old agent", "", &testAgent{noCapabilities: true}, false, "secret"},
+		{"no token, sudoers", "", &testAgent{privilegeMode: "sudoers"}, false, ""},
+		{"token, proven", "tok", &testAgent{token: "tok", privilegeMode: "sudo-password", prove: true}, false, "secret"},
+		{"token, empty mode proven", "tok", &testAgent{token: "tok", prove: true}, false, "secret"},
+		{"token, agent without proof", "tok", &testAgent{privilegeMode: "sudo-password"}, true, ""},
+		{"token, empty mode without proof", "tok", &testAgent{}, true, ""},
+		{"token, old agent", "tok", &testAgent{noCapabilities: true}, true, ""},
+		{"token, wrong proof", "tok", &testAgent{privilegeMode: "sudo-password", prove: true}, true, ""},
+		{"token, rejected", "tok", &testAgent{token: "other", privilegeMode: "sudo-password", prove: true}, true, ""},
+		{"token, sudoers without proof", "tok", &testAgent{privilegeMode: "sudoers"}, false, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("SRVMNG_AGENT_TOKEN", c.managerToken)
+			agent := c.agent
+			host, port, _ := net.SplitHostPort(startTestServer(t, agent, false))
+			config := &MonitorTarget{Name: "agent01", Type: "host", HostIP: host, Port: port, SSHPass: "secret"}
+			_, err := shutdownViaAgent(config, PowerOptions{})
+
+			agent.mu.Lock()
+			defer agent.mu.Unlock()
+			if c.wantErr {
+				if err == nil {
+					t.Error("shutdown succeeded, want an error")
+				}
+				if len(agent.passwords) != 0 {
+					t.Errorf("agent received %q, want no request", agent.passwords)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("shutdownViaAgent: %v", err)
+			}
+			if len(agent.passwords) != 1 || agent.passwords[0] != c.wantPassword {
+				t.Errorf("agent received passwords %q, want [%q]", agent.passwords, c.wantPassword)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHドライバ START===========================================================START
+
+// sshTimeout は SSH 接続とコマンド実行のタイムアウトです。
+const sshTimeout = 15 * time.Second
+
+// knownHostsPath は、ホスト鍵の検証に使用する known_hosts ファイルのパスを返します。
+// 環境変数 SSH_KNOWN_HOSTS が指定されていない場合は ~/.ssh/known_hosts を使用します。
+func knownHostsPath() string {
+	if path := os.Getenv("SSH_KNOWN_HOSTS"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ssh/known_hosts"
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// sshKeyDir は、ssh_key_path に指定できる秘密鍵を置くディレクトリを返します。
+// 環境変数 SSH_KEY_DIR が指定されていない場合は ~/.ssh を使用します。
+func sshKeyDir() string {
+	if dir := os.Getenv("SSH_KEY_DIR"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".ssh"
+	}
+	return filepath.Join(home, ".ssh")
+}
+
+// resolveSSHKeyPath は、ssh_key_path を秘密鍵のディレクトリ内のパスに解決します。
+// 相対パスはディレクトリからのパスとし、ディレクトリの外 (シンボリックリンクの先を含む) を指す場合はエラーを返します。
+func resolveSSHKeyPath(keyPath string) (string, error) {
+	dir, err := filepath.Abs(sshKeyDir())
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve ssh key directory: %v", err)
+	}
+	path := keyPath
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !withinDir(dir, path) {
+		return "", fmt.Errorf("must be inside the ssh key directory %s (SSH_KEY_DIR)", dir)
+	}
+
+	// 鍵ファイルが存在する場合は、シンボリックリンクを解決しても外に出ないことを確認する
+	if realPath, err := filepath.EvalSymlinks(path); err == nil {
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			realDir = dir
+		}
+		if !withinDir(realDir, realPath) {
+			return "", fmt.Errorf("must be inside the ssh key directory %s (SSH_KEY_DIR)", dir)
+		}
+	}
+	return path, nil
+}
+
+// withinDir は、path が dir の下にあるかどうかを返します。
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// sshPort は、ターゲットの SSH ポートを返します。未設定の場合は 22 です。
+func sshPort(config *MonitorTarget) string {
+	if config.SSHPort == "" {
+		return "22"
+	}
+	return config.SSHPort
+}
+
+// sshAddress は、ターゲットの SSH 接続先 (host:port) を返します。
+func sshAddress(config *MonitorTarget) string {
+	return net.JoinHostPort(config.HostIP, sshPort(config))
+}
+
+// newSSHClientConfig は、ターゲットの認証情報から SSH クライアント設定を組み立てます。
+// ssh_key_path があれば公開鍵認証（ssh_pass はパスフレーズとしても使用）、ssh_pass があればパスワード認証を試みます。
+func newSSHClientConfig(config *MonitorTarget) (*ssh.ClientConfig, error) {
+	if config.SSHUser == "" {
+		return nil, fmt.Errorf("ssh_user is required for ssh driver")
+	}
+
+	var auths []ssh.AuthMethod
+	if config.SSHKeyPath != "" {
+		keyPath, err := resolveSSHKeyPath(config.SSHKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh_key_path: %v", err)
+		}
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssh key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if _, ok := err.(*ssh.PassphraseMissingError); ok {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(config.SSHPass))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ssh key: %v", err)
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if config.SSHPass != "" {
+		password := config.SSHPass
+		auths = append(auths,
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range questions {
+					answers[i] = password
+				}
+				return answers, nil
+			}),
+		)
+	}
+	if len(auths) == 0 {
+		return nil, fmt.Errorf("ssh_pass or ssh_key_path is required for ssh driver")
+	}
+
+	// known_hosts によるホスト鍵の検証（未登録のホストには接続しない）
+	hostKeyCallback, err := knownhosts.New(knownHostsPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts: %v", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            config.SSHUser,
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sshTimeout,
+	}, nil
+}
+
+// runSSHCommand は、ターゲットに SSH で接続してコマンドを実行し、出力を返します。
+// privileged の場合、root 以外のユーザーでは sudo を付け、ssh_pass があれば標準入力から渡します。
+func runSSHCommand(config *MonitorTarget, privileged bool, args ...string) (string, error) {
+	clientConfig, err := newSSHClientConfig(config)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := ssh.Dial("tcp", sshAddress(config), clientConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect via ssh: %v", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to open ssh session: %v", err)
+	}
+	defer session.Close()
+
+	command := shellJoin(args)
+	if privileged && config.SSHUser != "root" {
+		if config.SSHPass != "" {
+			command = "sudo -S -p '' " + command
+			session.Stdin = strings.NewReader(config.SSHPass + "\n")
+		} else {
+			command = "sudo -n " + command
+		}
+	}
+
+	// shutdown 実行後は接続が切断されることがあるため、タイムアウトを設けて待つ
+	done := make(chan error, 1)
+	var output []byte
+	go func() {
+		var runErr error
+		output, runErr = session.CombinedOutput(command)
+		done <- runErr
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(sshTimeout):
+		return "", fmt.Errorf("ssh command timed out: %s", args[0])
+	}
+
+	if err != nil {
+		// 接続断による終了ステータス欠落は、電源断が始まったものとして扱う
+		if _, ok := err.(*ssh.ExitMissingError); ok {
+			return string(output), nil
+		}
+		return string(output), fmt.Errorf("ssh command failed: %v", err)
+	}
+	return string(output), nil
+}
+
+// sshDriver は、power_agent を導入していないホストに SSH で直接コマンドを実行する電源ドライバです。
+// start は SSH では実行できないため WOL を使用します。
+type sshDriver struct{}
+
+func init() {
+	RegisterPowerDriver("ssh", &sshDriver{})
+}
+
+func (d *sshDriver) Start(config *MonitorTarget, _ PowerOptions) (string, error) {
+	return sendWOLPacket(config.MacAddress, config.BroadcastIP, config.Name)
+}
+
+func (d *sshDriver) Stop(config *MonitorTarget, opts PowerOptions) (string, error) {
+	when := "now"
+	if opts.Delay > 0 {
+		when = "+" + strconv.Itoa(opts.Delay)
+	}
+	args := []string{"shutdown", "-h", when}
+	if opts.Message != "" {
+		args = append(args, opts.Message)
+	}
+	return d.run("stop", config, args...)
+}
+
+func (d *sshDriver) Reboot(config *MonitorTarget, _ PowerOptions) (string, error) {
+	return d.run("reboot", config, "systemctl", "reboot")
+}
+
+func (d *sshDriver) Action(action string, config *MonitorTarget, opts PowerOptions) (string, error) {
+	switch action {
+	case "cancel":
+		args := []string{"shutdown", "-c"}
+		if opts.Message != "" {
+			args = append(args, opts.Message)
+		}
+		return d.run(action, config, args...)
+	case "suspend", "hibernate":
+		return d.run(action, config, "systemctl", action)
+	default:
+		return "", fmt.Errorf("unsupported action: %s", action)
+	}
+}
+
+// Status は、SSH ポートへの TCP 接続で死活確認を行います。
+// SSH ポートが応答せず ICMP のみ応答する場合は AgentDown とします。
+func (d *sshDriver) Status(config *MonitorTarget) string {
+	if CheckTCPStatus(config.HostIP, sshPort(config)) == StatusRunning {
+		return StatusRunning
+	}
+	if hostReachable(config.HostIP) {
+		return StatusAgentDown
+	}
+	return StatusUnreachable
+}
+
+// Address は、死活監視で接続する SSH ポートのアドレスを返します。
+func (d *sshDriver) Address(config *MonitorTarget) string {
+	return sshAddress(config)
+}
+
+// Capabilities は、/sys/power/state を読み取り、サスペンド・ハイバネートの可否を判定します。
+func (d *sshDriver) Capabilities(config *MonitorTarget) *PowerCapabilities {
+	caps := &PowerCapabilities{Actions: []string{}}
+	if config.MacAddress != "" && config.BroadcastIP != "" {
+		caps.Actions = append(caps.Actions, "start")
+	}
+
+	output, err := runSSHCommand(config, false, "cat", "/sys/power/state")
+	if err != nil {
+		log.Printf("[INFO] SSH capabilities unavailable for '%s': %v", config.Name, err)
+		return caps
+	}
+	caps.Actions = append(caps.Actions, "stop", "cancel", "reboot")
+	for _, s := range strings.Fields(output) {
+		switch s {
+		case "mem":
+			caps.Actions = append(caps.Actions, "suspend")
+		case "disk":
+			caps.Actions = append(caps.Actions, "hibernate")
+		}
+	}
+	return caps
+}
+
+// run は SSH でコマンドを実行し、結果をログに記録します。
+func (d *sshDriver) run(action string, config *MonitorTarget, args ...string) (string, error) {
+	output, err := runSSHCommand(config, true, args...)
+	if err != nil {
+		log.Printf("[ERROR] ssh %s failed for '%s': %v", action, config.Name, err)
+		return output, err
+	}
+	log.Printf("[INFO] ssh %s succeeded for '%s'", action, config.Name)
+	return fmt.Sprintf("%s command executed via ssh successfully", action), nil
+}
+
+// shellJoin は、引数をシングルクォートで囲んでシェルのコマンド文字列に変換します。
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// SSHドライバ END===========================================================END
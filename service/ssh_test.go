@@ -0,0 +1,276 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// errPermissionDenied は、テスト用サーバが認証を拒否するときのエラーです。
+var errPermissionDenied = errors.New("permission denied")
+
+// testSSHServer は、exec リクエストを記録して応答するテスト用の SSH サーバです。
+// コマンドに shutdown を含む場合は、終了ステータスを送らずにチャネルを閉じます (電源断による切断の再現)。
+type testSSHServer struct {
+	addr     string
+	hostKey  ssh.Signer
+	password string
+	userKey  ssh.PublicKey
+
+	mu       sync.Mutex
+	commands []string
+	stdins   []string
+}
+
+// exec は、受け付けたコマンドと標準入力の記録を返します。
+func (s *testSSHServer) exec() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...), append([]string(nil), s.stdins...)
+}
+
+// newTestSSHServer は、127.0.0.1 の空きポートで SSH サーバを起動し、known_hosts と鍵のディレクトリを設定します。
+func newTestSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	s := &testSSHServer{addr: ln.Addr().String(), hostKey: hostKey, password: "secret"}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == s.password {
+				return nil, nil
+			}
+			return nil, errPermissionDenied
+		},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if s.userKey != nil && string(key.Marshal()) == string(s.userKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errPermissionDenied
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+
+	dir := t.TempDir()
+	t.Setenv("SSH_KEY_DIR", dir)
+	t.Setenv("SSH_KNOWN_HOSTS", filepath.Join(dir, "known_hosts"))
+	writeKnownHosts(t, s.addr, hostKey.PublicKey())
+	return s
+}
+
+// serve は、1つの SSH 接続のセッションで exec リクエストを処理します。
+func (s *testSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				command := string(req.Payload[4:])
+				req.Reply(true, nil)
+
+				stdin, _ := io.ReadAll(channel)
+				s.mu.Lock()
+				s.commands = append(s.commands, command)
+				s.stdins = append(s.stdins, string(stdin))
+				s.mu.Unlock()
+
+				if strings.Contains(command, "shutdown") {
+					return
+				}
+				io.WriteString(channel, "freeze mem disk\n")
+				status := make([]byte, 4)
+				binary.BigEndian.PutUint32(status, 0)
+				channel.SendRequest("exit-status", false, status)
+				return
+			}
+		}()
+	}
+}
+
+// writeKnownHosts は、addr のホスト鍵を SSH_KNOWN_HOSTS のファイルに書き込みます。
+func writeKnownHosts(t *testing.T, addr string, key ssh.PublicKey) {
+	t.Helper()
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key) + "\n"
+	if err := os.WriteFile(os.Getenv("SSH_KNOWN_HOSTS"), []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sshTarget は、テスト用サーバに接続するターゲットの設定を返します。
+func (s *testSSHServer) sshTarget(user string) *MonitorTarget {
+	host, port, _ := net.SplitHostPort(s.addr)
+	return &MonitorTarget{Name: "ssh01", Type: "host", HostIP: host, Port: port, SSHPort: port, SSHUser: user, PowerDriver: "ssh"}
+}
+
+func TestSSHPasswordAuth(t *testing.T) {
+	s := newTestSSHServer(t)
+	config := s.sshTarget("root")
+	config.SSHPass = "secret"
+
+	output, err := runSSHCommand(config, false, "cat", "/sys/power/state")
+	if err != nil {
+		t.Fatalf("runSSHCommand: %v", err)
+	}
+	if output != "freeze mem disk\n" {
+		t.Errorf("output = %q", output)
+	}
+	if commands, _ := s.exec(); len(commands) != 1 || commands[0] != "'cat' '/sys/power/state'" {
+		t.Errorf("commands = %q", commands)
+	}
+
+	config.SSHPass = "wrong"
+	if _, err := runSSHCommand(config, false, "true"); err == nil {
+		t.Error("wrong password was accepted")
+	}
+}
+
+func TestSSHKeyAuth(t *testing.T) {
+	s := newTestSSHServer(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.userKey, err = ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(os.Getenv("SSH_KEY_DIR"), "id_ed25519"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := s.sshTarget("root")
+	config.SSHKeyPath = "id_ed25519"
+	caps := (&sshDriver{}).Capabilities(config)
+	if got := strings.Join(caps.Actions, ","); got != "stop,cancel,reboot,suspend,hibernate" {
+		t.Errorf("capabilities = %s", got)
+	}
+}
+
+func TestSSHKeyPathOutsideKeyDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("SSH_KEY_DIR", dir)
+	if err := os.Symlink("/etc/hostname", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/etc/shadow", "../id_ed25519", "keys/../../id_ed25519", "link"} {
+		if _, err := resolveSSHKeyPath(path); err == nil {
+			t.Errorf("resolveSSHKeyPath(%q) was accepted", path)
+		}
+	}
+	if _, err := resolveSSHKeyPath("keys/id_ed25519"); err != nil {
+		t.Errorf("resolveSSHKeyPath(keys/id_ed25519): %v", err)
+	}
+}
+
+func TestSSHKnownHostsMismatch(t *testing.T) {
+	s := newTestSSHServer(t)
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ssh.NewSignerFromKey(otherPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKnownHosts(t, s.addr, other.PublicKey())
+
+	config := s.sshTarget("root")
+	config.SSHPass = "secret"
+	if _, err := runSSHCommand(config, false, "true"); err == nil {
+		t.Fatal("host key mismatch was accepted")
+	}
+	if commands, _ := s.exec(); len(commands) != 0 {
+		t.Errorf("command was executed despite host key mismatch: %q", commands)
+	}
+}
+
+func TestSSHSudoPassword(t *testing.T) {
+	s := newTestSSHServer(t)
+	config := s.sshTarget("admin")
+	config.SSHPass = "secret"
+
+	if _, err := (&sshDriver{}).Reboot(config, PowerOptions{}); err != nil {
+		t.Fatalf("Reboot: %v", err)
+	}
+	commands, stdins := s.exec()
+	if len(commands) != 1 || commands[0] != "sudo -S -p '' 'systemctl' 'reboot'" {
+		t.Errorf("commands = %q", commands)
+	}
+	if len(stdins) != 1 || stdins[0] != "secret\n" {
+		t.Errorf("stdin = %q", stdins)
+	}
+}
+
+func TestSSHShutdownExitMissing(t *testing.T) {
+	s := newTestSSHServer(t)
+	config := s.sshTarget("root")
+	config.SSHPass = "secret"
+
+	message, err := (&sshDriver{}).Stop(config, PowerOptions{})
+	if err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if message != "stop command executed via ssh successfully" {
+		t.Errorf("message = %q", message)
+	}
+	if commands, _ := s.exec(); len(commands) != 1 || commands[0] != "'shutdown' '-h' 'now'" {
+		t.Errorf("commands = %q", commands)
+	}
+}
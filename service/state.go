@@ -0,0 +1,149 @@
+package service
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// ターゲット状態 START===========================================================START
+
+// ターゲットの状態。/status の status に返します。
+const (
+	StatusRunning      = "Running"      // 稼働中 (エージェント・BMC などが稼働と応答)
+	StatusDegraded     = "Degraded"     // 稼働中だが追加のヘルスチェックに失敗
+	StatusAgentDown    = "AgentDown"    // ホストは到達可能だが power_agent (ssh ドライバでは sshd) が応答しない
+	StatusUnreachable  = "Unreachable"  // 電源断、またはホストに到達できない
+	StatusPoweringOn   = "PoweringOn"   // 起動・再起動の操作後、稼働を確認するまで
+	StatusShuttingDown = "ShuttingDown" // 停止・サスペンドなどの操作後、停止を確認するまで
+	StatusMaintenance  = "Maintenance"  // メンテナンス中 (死活監視を行わない)
+	StatusUnknown      = "Unknown"      // 判定できない (ドライバ未設定、BMC の応答不正など)
+)
+
+// Statuses は、ターゲットの状態として返す値の一覧です (OpenAPI ドキュメントの enum に使用)。
+// Degraded は checks (追加のヘルスチェック) を設定したターゲットのみで返します。
+var Statuses = []string{
+	StatusRunning, StatusDegraded, StatusAgentDown, StatusUnreachable,
+	StatusPoweringOn, StatusShuttingDown, StatusMaintenance, StatusUnknown,
+}
+
+// reachabilityTimeout は、到達性確認 (ICMP/TCP) のタイムアウトです。
+const reachabilityTimeout = 2 * time.Second
+
+// hostReachable は、ICMP Echo または指定した TCP ポートのいずれかに応答があるかを確認します。
+// ICMP ソケットを開けない環境でも TCP で判定できるよう、両方を順に試します。
+func hostReachable(host string, ports ...string) bool {
+	if _, err := checkICMP(host, false, reachabilityTimeout); err == nil {
+		return true
+	}
+	for _, port := range ports {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), reachabilityTimeout)
+		if err == nil {
+			conn.Close()
+			return true
+		}
+	}
+	return false
+}
+
+// 電源操作の遷移状態の追跡 ----------------------------------------------------
+
+// transitionTimeout は、電源操作後に遷移中の状態を表示し続ける最大時間です。
+const transitionTimeout = 5 * time.Minute
+
+// rebootGrace は、再起動後に一度も停止を観測できなかった場合に遷移を打ち切るまでの時間です。
+// 停止から起動までが監視間隔より短い再起動に対応します。
+const rebootGrace = 2 * time.Minute
+
+// powerTransition は、電源操作を受け付けてから期待する状態に達するまでの遷移です。
+type powerTransition struct {
+	action   string    // 受け付けた電源操作 (start, stop, reboot など)
+	state    string    // StatusPoweringOn または StatusShuttingDown
+	reboot   bool      // 停止を観測した後 PoweringOn に移る
+	started  time.Time // 操作を受け付けた時刻
+	deadline time.Time // この時刻を過ぎたら遷移を破棄する
+}
+
+var transitions = struct {
+	sync.Mutex
+	m map[string]*powerTransition
+}{m: make(map[string]*powerTransition)}
+
+// beginTransition は、成功した電源操作に応じてターゲットの遷移状態を記録します。
+// delay 分後の停止予約では、予約時刻までを停止中として扱います。
+func beginTransition(name, action string, delay int) {
+	now := time.Now()
+	t := &powerTransition{action: action, started: now, deadline: now.Add(transitionTimeout)}
+	switch action {
+	case "start":
+		t.state = StatusPoweringOn
+	case "reboot":
+		t.state = StatusShuttingDown
+		t.reboot = true
+	case "stop", "suspend", "hibernate":
+		t.state = StatusShuttingDown
+		t.deadline = t.deadline.Add(time.Duration(delay) * time.Minute)
+	case "cancel":
+		transitions.Lock()
+		delete(transitions.m, name)
+		transitions.Unlock()
+		return
+	default:
+		return
+	}
+
+	transitions.Lock()
+	transitions.m[name] = t
+	transitions.Unlock()
+}
+
+// transitionInProgress は、ターゲットで同じ電源操作の遷移が進行中 (期待する状態に未到達) かを返します。
+func transitionInProgress(name, action string) bool {
+	transitions.Lock()
+	defer transitions.Unlock()
+
+	t, ok := transitions.m[name]
+	return ok && t.action == action && time.Now().Before(t.deadline)
+}
+
+// applyTransition は、観測した状態と遷移中の電源操作から表示する状態を決定します。
+// 期待する状態に達した、または期限を過ぎた遷移は破棄します。
+func applyTransition(name, observed string) string {
+	transitions.Lock()
+	defer transitions.Unlock()
+
+	t, ok := transitions.m[name]
+	if !ok {
+		return observed
+	}
+	now := time.Now()
+	if now.After(t.deadline) {
+		delete(transitions.m, name)
+		return observed
+	}
+
+	up := observed == StatusRunning || observed == StatusDegraded
+	switch t.state {
+	case StatusPoweringOn:
+		if up {
+			delete(transitions.m, name)
+			return observed
+		}
+	case StatusShuttingDown:
+		if t.reboot {
+			if !up {
+				// 停止を観測したので、以降は起動待ち
+				t.state = StatusPoweringOn
+			} else if now.Sub(t.started) > rebootGrace {
+				delete(transitions.m, name)
+				return observed
+			}
+		} else if observed == StatusUnreachable {
+			delete(transitions.m, name)
+			return observed
+		}
+	}
+	return t.state
+}
+
+// ターゲット状態 END===========================================================END
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// タグ START===========================================================START
+
+// Tags は、ターゲットに付けるタグの一覧です。"web" のような単語、または "env=prod" のような key=value を指定します。
+// DB には JSON 配列で保存します。
+type Tags []string
+
+// Scan は DB の JSON 文字列を Tags に変換します。
+func (t *Tags) Scan(src interface{}) error {
+	*t = nil
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported tags type: %T", src)
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, t)
+}
+
+// Value は Tags を DB に保存する JSON 文字列に変換します。
+func (t Tags) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "", nil
+	}
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// validateTags は、空のタグや空白・カンマを含むタグを拒否します。
+func validateTags(tags Tags) error {
+	for i, tag := range tags {
+		if tag == "" || strings.ContainsAny(tag, ", \t") {
+			return fmt.Errorf("tags[%d]: invalid tag %q (must be non-empty and contain no spaces or commas)", i, tag)
+		}
+	}
+	return nil
+}
+
+// MatchSelector は、タグがセレクタを満たすかを返します。
+// セレクタはカンマ区切りのタグの一覧で、すべてを含む場合に一致します (例: "web,env=prod")。
+// "!web" のように先頭に ! を付けると、そのタグを含まないことを条件にします。空のセレクタは常に一致します。
+func MatchSelector(tags Tags, selector string) bool {
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		if negated, ok := strings.CutPrefix(term, "!"); ok {
+			if containsString(tags, negated) {
+				return false
+			}
+			continue
+		}
+		if !containsString(tags, term) {
+			return false
+		}
+	}
+	return true
+}
+
+// タグ END===========================================================END
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"srv_mng/internal/agentapi"
+)
+
+// 登録内容の検証 START===========================================================START
+
+// TargetTypes は、ターゲットの種別として指定できる値です。
+var TargetTypes = []string{"host", "container", "vm"}
+
+// hostLookupTimeout は、host_ip のホスト名を名前解決する場合のタイムアウトです。
+const hostLookupTimeout = 3 * time.Second
+
+// skipHostLookup は、host_ip のホスト名を名前解決せずに登録するかを返します。
+// 登録時に名前解決できない環境 (監視対象の DNS にマネージャから到達できないなど) では、環境変数 SKIP_HOST_LOOKUP=true で明示的に無効にします。
+func skipHostLookup() bool {
+	return os.Getenv("SKIP_HOST_LOOKUP") == "true"
+}
+
+// FieldError は、1つの項目の検証エラーです。
+type FieldError struct {
+	Field   string `json:"field"`   // JSON の項目名 (例: "mac_address", "checks[0]")
+	Message string `json:"message"` // エラーの内容
+}
+
+// ValidationError は、ターゲット設定の検証エラーの一覧です。
+// API は Errors を応答の error.details に設定し、どの項目が誤っているかを返します。
+type ValidationError struct {
+	Errors  []FieldError
+	subject string // 検証した内容 (空の場合は "target configuration")
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	subject := e.subject
+	if subject == "" {
+		subject = "target configuration"
+	}
+	return "invalid " + subject + ": " + strings.Join(msgs, "; ")
+}
+
+// Unwrap は、検証エラーを ErrInvalid として判定できるようにします。
+func (e *ValidationError) Unwrap() error { return ErrInvalid }
+
+// add は、項目 field のエラーを追加します。
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// addIndexed は、"checks[0]: ..." のように要素の位置から始まるエラーを、その要素の項目名のエラーとして追加します。
+func (e *ValidationError) addIndexed(field string, err error) {
+	if prefix, msg, ok := strings.Cut(err.Error(), ": "); ok && strings.HasPrefix(prefix, field+"[") {
+		e.add(prefix, "%s", msg)
+		return
+	}
+	e.add(field, "%v", err)
+}
+
+// ValidateMonitorTarget は、ターゲット設定を検証し、誤りのある項目をすべて ValidationError で返します。
+// 必須項目に加え、host_ip (IP アドレス、または名前解決できるホスト名)、ポートの範囲、MAC アドレスの形式、
+// ブロードキャストアドレスと host_ip のサブネットの整合性、種別と電源ドライバを確認します。
+// SKIP_HOST_LOOKUP=true の場合はホスト名の形式のみ確認し、ホスト名の broadcast_ip との整合性の確認は省略します。
+func ValidateMonitorTarget(config *MonitorTarget) error {
+	ve := &ValidationError{}
+
+	if config.Name == "" {
+		ve.add("name", "is required")
+	}
+
+	switch {
+	case config.Type == "":
+		ve.add("type", "is required")
+	case !slices.Contains(TargetTypes, config.Type):
+		ve.add("type", "must be one of: %s", strings.Join(TargetTypes, ", "))
+	}
+
+	// hostIPv4s は host_ip の IPv4 アドレス (resolved が false の場合は名前解決していない)
+	var hostIPv4s []net.IP
+	hostValid, resolved := false, false
+	switch {
+	case config.HostIP == "":
+		ve.add("host_ip", "is required")
+	case net.ParseIP(config.HostIP) == nil && !validHostname(config.HostIP):
+		ve.add("host_ip", "must be an IPv4/IPv6 address or a hostname (got %q)", config.HostIP)
+	case net.ParseIP(config.HostIP) == nil && skipHostLookup():
+		hostValid = true
+	default:
+		ips, err := resolveHostIPv4(config.HostIP)
+		if err != nil {
+			log.Printf("[INFO] host_ip of '%s' does not resolve: %v", config.Name, err)
+			ve.add("host_ip", "does not resolve")
+			break
+		}
+		hostIPv4s, hostValid, resolved = ips, true, true
+	}
+
+	if config.Port == "" {
+		ve.add("port", "is required")
+	} else if err := validatePort(config.Port); err != nil {
+		ve.add("port", "%v", err)
+	}
+	if config.SSHPort != "" {
+		if err := validatePort(config.SSHPort); err != nil {
+			ve.add("ssh_port", "%v", err)
+		}
+	}
+
+	// 秘密鍵は SSH_KEY_DIR の下のファイルのみ使用できる
+	if config.SSHKeyPath != "" {
+		if _, err := resolveSSHKeyPath(config.SSHKeyPath); err != nil {
+			ve.add("ssh_key_path", "%v", err)
+		}
+	}
+
+	// WOL で送信するときと同じ parseMAC で確認する
+	if config.MacAddress != "" {
+		if _, err := parseMAC(config.MacAddress); err != nil {
+			ve.add("mac_address", "%v", err)
+		}
+	}
+
+	if config.BroadcastIP != "" {
+		bcast := net.ParseIP(config.BroadcastIP).To4()
+		switch {
+		case bcast == nil:
+			ve.add("broadcast_ip", "must be an IPv4 address")
+		case !hostValid || bcast.Equal(net.IPv4bcast):
+			// host_ip の誤りは報告済み。255.255.255.255 はどのサブネットでも有効
+		case !resolved:
+			// SKIP_HOST_LOOKUP=true でホスト名を名前解決していない
+			log.Printf("[INFO] Skipping broadcast_ip check for '%s': host lookup is disabled", config.Name)
+		case len(hostIPv4s) > 0 && !broadcastMatchesAny(hostIPv4s, bcast):
+			ve.add("broadcast_ip", "%s is not the broadcast address of a subnet containing host_ip %s", config.BroadcastIP, config.HostIP)
+		}
+	}
+
+	// libvirt のドメイン名は power_agent が virsh の引数に渡すため、power_agent と同じ規則で確認する
+	if name, err := DriverNameFor(config); err == nil && name == "libvirt" && !agentapi.DomainNamePattern.MatchString(vmDomain(config)) {
+		field := "vm_domain"
+		if config.VMDomain == "" {
+			field = "name"
+		}
+		ve.add(field, "%q is not a valid libvirt domain name (letters, digits and . _ + : -, starting with a letter or digit)", vmDomain(config))
+	}
+
+	if err := validateTags(config.Tags); err != nil {
+		ve.addIndexed("tags", err)
+	}
+	if err := validateHealthChecks(config.Checks); err != nil {
+		ve.addIndexed("checks", err)
+	}
+
+	// 指定された電源ドライバと、ドライバ固有の必須項目
+	if config.PowerDriver != "" {
+		driver, err := GetPowerDriver(config.PowerDriver)
+		if err != nil {
+			ve.add("power_driver", "must be one of: %s", strings.Join(PowerDriverNames(), ", "))
+		} else if validator, ok := driver.(ConfigValidator); ok {
+			if err := validator.Validate(config); err != nil {
+				ve.add("power_driver", "%v", err)
+			}
+		}
+	}
+
+	if len(ve.Errors) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// validHostname は、host がホスト名 (英数字とハイフンのラベルをドットで区切ったもの) の形式かを返します。
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// resolveHostIPv4 は、host_ip が IP アドレスであればそのまま、ホスト名であれば名前解決した IPv4 アドレスを返します。
+func resolveHostIPv4(host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), hostLookupTimeout)
+		defer cancel()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, fmt.Errorf("lookup of %q failed: %v", host, err)
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	var v4 []net.IP
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			v4 = append(v4, ip4)
+		}
+	}
+	return v4, nil
+}
+
+// validatePort は、ポート番号が 1〜65535 の整数であることを確認します。
+func validatePort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("must be an integer between 1 and 65535 (got %q)", port)
+	}
+	return nil
+}
+
+// broadcastMatchesAny は、bcast がいずれかのホストのアドレスを含むサブネットのブロードキャストアドレスかを返します。
+// サブネットのマスク長は分からないため、/8 から /30 までのいずれかで一致すればよいものとします。
+// 255.255.255.255 (リミテッドブロードキャスト) は常に有効です。
+func broadcastMatchesAny(hosts []net.IP, bcast net.IP) bool {
+	if bcast.Equal(net.IPv4bcast) {
+		return true
+	}
+	for _, host := range hosts {
+		for bits := 8; bits <= 30; bits++ {
+			mask := net.CIDRMask(bits, 32)
+			expected := make(net.IP, net.IPv4len)
+			for i := range expected {
+				expected[i] = host[i]&mask[i] | ^mask[i]
+			}
+			if expected.Equal(bcast) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 登録内容の検証 END===========================================================END
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fieldErrors は、ValidateMonitorTarget のエラーから項目名の一覧を返します。
+func fieldErrors(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("error is not a ValidationError: %v", err)
+	}
+	fields := make([]string, 0, len(ve.Errors))
+	for _, fe := range ve.Errors {
+		fields = append(fields, fe.Field)
+	}
+	return fields
+}
+
+func TestValidateHostIP(t *testing.T) {
+	for _, c := range []struct {
+		hostIP, broadcastIP string
+		skipLookup          bool
+		want                string // 期待するエラーメッセージ (空ならエラーなし)
+	}{
+		{"192.168.1.10", "", false, ""},
+		{"fe80::1", "", false, ""},
+		{"fe80::1", "192.168.1.255", false, ""},
+		{"localhost", "", false, ""},
+		{"localhost", "127.255.255.255", false, ""},
+		{"localhost", "10.0.0.255", false, "broadcast_ip: 10.0.0.255 is not the broadcast address of a subnet containing host_ip localhost"},
+		{"web01.example.invalid", "", false, "host_ip: does not resolve"},
+		{"web01.example.invalid", "192.168.1.255", false, "host_ip: does not resolve"},
+		{"web01.example.invalid", "", true, ""},              // 名前解決しない
+		{"web01.example.invalid", "192.168.1.255", true, ""}, // 整合性の確認を省略する
+		{"192.168.1.10", "10.0.0.255", true, "broadcast_ip: 10.0.0.255 is not the broadcast address of a subnet containing host_ip 192.168.1.10"},
+		{"192.168.1.10", "192.168.1.255", false, ""},
+		{"192.168.1.10", "255.255.255.255", false, ""},
+		{"-web01", "", false, `host_ip: must be an IPv4/IPv6 address or a hostname (got "-web01")`},
+		{"web_01", "", true, `host_ip: must be an IPv4/IPv6 address or a hostname (got "web_01")`},
+		{"web01..example", "", false, `host_ip: must be an IPv4/IPv6 address or a hostname (got "web01..example")`},
+	} {
+		if c.skipLookup {
+			t.Setenv("SKIP_HOST_LOOKUP", "true")
+		} else {
+			t.Setenv("SKIP_HOST_LOOKUP", "")
+		}
+		config := &MonitorTarget{Name: "web01", Type: "host", HostIP: c.hostIP, Port: "22", BroadcastIP: c.broadcastIP, PowerDriver: "ssh", SSHUser: "root"}
+		got := ""
+		if err := ValidateMonitorTarget(config); err != nil {
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("error is not a ValidationError: %v", err)
+			}
+			msgs := make([]string, 0, len(ve.Errors))
+			for _, fe := range ve.Errors {
+				msgs = append(msgs, fe.Field+": "+fe.Message)
+			}
+			got = strings.Join(msgs, "; ")
+		}
+		if got != c.want {
+			t.Errorf("host_ip %q, broadcast_ip %q, skip lookup %t: errors = %q, want %q", c.hostIP, c.broadcastIP, c.skipLookup, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package service
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Webhookドライバ START===========================================================START
+
+// WebhookConfig は、スマートPDUやスマートプラグ (Tasmota/Shelly など) を HTTP で操作するための設定です。
+// monitor_targets.webhook_config に JSON で保存します。
+type WebhookConfig struct {
+	On         *WebhookRequest `json:"on,omitempty"`          // 電源ON
+	Off        *WebhookRequest `json:"off,omitempty"`         // 電源OFF
+	Reboot     *WebhookRequest `json:"reboot,omitempty"`      // 再起動。省略時は off → cycle_delay 秒待機 → on
+	Status     *WebhookStatus  `json:"status,omitempty"`      // 状態取得。省略時は Unknown
+	CycleDelay int             `json:"cycle_delay,omitempty"` // reboot 省略時の off と on の間隔 (秒)。0 の場合は5秒
+}
+
+// maxCycleDelay は、cycle_delay に指定できる最大の秒数です。
+const maxCycleDelay = 300
+
+// webhookTemplateData は、url, headers の値, body のテンプレートに渡す値です。
+// パスワードなどの秘密情報は含めません (認証トークンなどは headers に直接記述します)。
+type webhookTemplateData struct {
+	Name        string
+	Type        string
+	HostIP      string
+	Port        string
+	MacAddress  string
+	BroadcastIP string
+	BMCAddress  string
+	BMCUser     string
+	Tags        []string
+	Action      string // "on", "off", "reboot", "status"
+}
+
+// newWebhookTemplateData は、ターゲットの設定からテンプレートに渡す値を作成します。
+func newWebhookTemplateData(config *MonitorTarget, action string) webhookTemplateData {
+	return webhookTemplateData{
+		Name:        config.Name,
+		Type:        config.Type,
+		HostIP:      config.HostIP,
+		Port:        config.Port,
+		MacAddress:  config.MacAddress,
+		BroadcastIP: config.BroadcastIP,
+		BMCAddress:  config.BMCAddress,
+		BMCUser:     config.BMCUser,
+		Tags:        config.Tags,
+		Action:      action,
+	}
+}
+
+// WebhookRequest は、1つの HTTP リクエストのテンプレートです。
+// url, headers の値, body には text/template でターゲットの設定 ({{.HostIP}}, {{.BMCUser}}, {{.Action}} など) を埋め込めます。
+// ssh_pass・bmc_pass などの秘密情報は埋め込めません。
+type WebhookRequest struct {
+	Method       string            `json:"method,omitempty"` // 省略時は GET
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	ExpectStatus int               `json:"expect_status,omitempty"` // 省略時は 2xx を成功とする
+}
+
+// WebhookStatus は、状態取得リクエストと応答の解釈方法です。
+type WebhookStatus struct {
+	WebhookRequest
+	Path     string `json:"path,omitempty"`      // JSON応答から値を取り出すドット区切りのパス (例: "POWER", "relays.0.ison")
+	Regex    string `json:"regex,omitempty"`     // 応答本文から値を取り出す正規表現 (最初のキャプチャグループ)
+	OnValue  string `json:"on_value,omitempty"`  // 電源ONを表す値。省略時は "on", "true", "1"
+	OffValue string `json:"off_value,omitempty"` // 電源OFFを表す値。省略時は "off", "false", "0"
+}
+
+// IsZero は、Webhook の設定がないかを返します (json の omitzero 用)。
+func (c WebhookConfig) IsZero() bool {
+	return c.On == nil && c.Off == nil && c.Reboot == nil && c.Status == nil && c.CycleDelay == 0
+}
+
+// Scan は DB の JSON 文字列を WebhookConfig に変換します。
+func (c *WebhookConfig) Scan(src interface{}) error {
+	*c = WebhookConfig{}
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported webhook_config type: %T", src)
+	}
+	if len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, c)
+}
+
+// maskedHeaderValue は、一覧やエクスポートで headers の値の代わりに返す値です。
+const maskedHeaderValue = "********"
+
+// Redacted は、headers の値 (認証トークンなど) を伏せ字にしたコピーを返します。
+func (c WebhookConfig) Redacted() WebhookConfig {
+	redact := func(r *WebhookRequest) *WebhookRequest {
+		if r == nil {
+			return nil
+		}
+		copied := *r
+		copied.Headers = nil
+		for key, value := range r.Headers {
+			if copied.Headers == nil {
+				copied.Headers = map[string]string{}
+			}
+			copied.Headers[key] = maskSecret(value)
+		}
+		return &copied
+	}
+	c.On, c.Off, c.Reboot = redact(c.On), redact(c.Off), redact(c.Reboot)
+	if c.Status != nil {
+		status := *c.Status
+		status.WebhookRequest = *redact(&c.Status.WebhookRequest)
+		c.Status = &status
+	}
+	return c
+}
+
+// restoreSecrets は、伏せ字のままの headers の値を old の同じリクエストの値に戻します。
+// Redacted で取得した設定を編集して保存・インポートしても、認証トークンなどが失われないようにします。
+func (c *WebhookConfig) restoreSecrets(old WebhookConfig) {
+	restore := func(r, o *WebhookRequest) {
+		if r == nil || o == nil {
+			return
+		}
+		for key, value := range r.Headers {
+			if prev, ok := o.Headers[key]; ok && value == maskedHeaderValue {
+				r.Headers[key] = prev
+			}
+		}
+	}
+	restore(c.On, old.On)
+	restore(c.Off, old.Off)
+	restore(c.Reboot, old.Reboot)
+	if c.Status != nil && old.Status != nil {
+		restore(&c.Status.WebhookRequest, &old.Status.WebhookRequest)
+	}
+}
+
+// Value は WebhookConfig を DB に保存する JSON 文字列に変換します。
+func (c WebhookConfig) Value() (driver.Value, error) {
+	if c.IsZero() {
+		return "", nil
+	}
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+// webhookDriver は、ターゲットごとに定義した HTTP リクエストで電源を制御するドライバです。
+type webhookDriver struct{}
+
+func init() {
+	RegisterPowerDriver("webhook", &webhookDriver{})
+}
+
+// Validate は、on/off のリクエストとテンプレート、状態の正規表現、cycle_delay が正しいことを確認します。
+func (d *webhookDriver) Validate(config *MonitorTarget) error {
+	wh := config.Webhook
+	if wh.On == nil || wh.Off == nil {
+		return fmt.Errorf("webhook.on and webhook.off are required for webhook driver")
+	}
+	if wh.CycleDelay < 0 || wh.CycleDelay > maxCycleDelay {
+		return fmt.Errorf("webhook.cycle_delay must be between 0 and %d seconds", maxCycleDelay)
+	}
+
+	requests := map[string]*WebhookRequest{"on": wh.On, "off": wh.Off, "reboot": wh.Reboot}
+	if wh.Status != nil {
+		requests["status"] = &wh.Status.WebhookRequest
+		if wh.Status.Path == "" && wh.Status.Regex == "" {
+			return fmt.Errorf("webhook.status requires path or regex")
+		}
+		if wh.Status.Regex != "" {
+			if _, err := regexp.Compile(wh.Status.Regex); err != nil {
+				return fmt.Errorf("invalid webhook.status.regex: %v", err)
+			}
+		}
+	}
+	for name, req := range requests {
+		if req == nil {
+			continue
+		}
+		if req.URL == "" {
+			return fmt.Errorf("webhook.%s.url is required", name)
+		}
+		if _, err := req.build(config, name); err != nil {
+			return fmt.Errorf("invalid webhook.%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (d *webhookDriver) Start(config *MonitorTarget, _ PowerOptions) (string, error) {
+	return d.send(config, "on", config.Webhook.On)
+}
+
+func (d *webhookDriver) Stop(config *MonitorTarget, opts PowerOptions) (string, error) {
+	if opts.Delay > 0 {
+		return "", fmt.Errorf("delayed shutdown is not supported by webhook driver")
+	}
+	return d.send(config, "off", config.Webhook.Off)
+}
+
+// Reboot は、reboot リクエストがあればそれを、なければ off → on で電源を入れ直します。
+// off → on の場合、on は cycle_delay 秒後にバックグラウンドで送信し、API の応答は off の送信後に返します。
+func (d *webhookDriver) Reboot(config *MonitorTarget, _ PowerOptions) (string, error) {
+	if config.Webhook.Reboot != nil {
+		return d.send(config, "reboot", config.Webhook.Reboot)
+	}
+
+	if _, err := d.send(config, "off", config.Webhook.Off); err != nil {
+		return "", err
+	}
+	delay := config.Webhook.CycleDelay
+	if delay <= 0 {
+		delay = 5
+	}
+	target := *config
+	go func() {
+		time.Sleep(time.Duration(delay) * time.Second)
+		if _, err := d.send(&target, "on", target.Webhook.On); err != nil {
+			PublishEvent(EventAlert, Alert{Target: target.Name, Level: "critical", Message: fmt.Sprintf("power cycle via webhook could not turn the power back on: %v", err), At: time.Now()})
+		}
+	}()
+	return fmt.Sprintf("Power cycle started via webhook (off sent, on in %ds)", delay), nil
+}
+
+// Status は、状態取得リクエストの応答から値を取り出して状態を返します。
+func (d *webhookDriver) Status(config *MonitorTarget) string {
+	st := config.Webhook.Status
+	if st == nil {
+		return StatusUnknown
+	}
+
+	body, err := st.WebhookRequest.do(config, "status")
+	if err != nil {
+		log.Printf("[INFO] Health check: webhook status for '%s' failed: %v", config.Name, err)
+		return StatusUnknown
+	}
+	value, err := st.extract(body)
+	if err != nil {
+		log.Printf("[INFO] Health check: webhook status for '%s' could not be parsed: %v", config.Name, err)
+		return StatusUnknown
+	}
+
+	log.Printf("[INFO] Health check: webhook status for '%s' is %q", config.Name, value)
+	switch {
+	case st.matches(value, st.OnValue, "on", "true", "1"):
+		return StatusRunning
+	case st.matches(value, st.OffValue, "off", "false", "0"):
+		return StatusUnreachable
+	default:
+		return StatusUnknown
+	}
+}
+
+// Capabilities は、設定されているリクエストから実行可能な電源操作を返します。
+func (d *webhookDriver) Capabilities(config *MonitorTarget) *PowerCapabilities {
+	caps := &PowerCapabilities{Actions: []string{}}
+	if config.Webhook.On != nil {
+		caps.Actions = append(caps.Actions, "start")
+	}
+	if config.Webhook.Off != nil {
+		caps.Actions = append(caps.Actions, "stop")
+	}
+	if config.Webhook.Reboot != nil || (config.Webhook.On != nil && config.Webhook.Off != nil) {
+		caps.Actions = append(caps.Actions, "reboot")
+	}
+	return caps
+}
+
+// send はリクエストを送信し、結果をログに記録します。
+func (d *webhookDriver) send(config *MonitorTarget, name string, req *WebhookRequest) (string, error) {
+	if req == nil {
+		return "", fmt.Errorf("webhook.%s is not configured for target '%s'", name, config.Name)
+	}
+	if _, err := req.do(config, name); err != nil {
+		log.Printf("[ERROR] webhook %s failed for '%s': %v", name, config.Name, err)
+		return "", err
+	}
+	log.Printf("[INFO] webhook %s succeeded for '%s'", name, config.Name)
+	return fmt.Sprintf("Webhook '%s' request sent successfully", name), nil
+}
+
+// build は、テンプレートを展開して HTTP リクエストを組み立てます。action はリクエストの名前 ("on", "off" など) です。
+func (r *WebhookRequest) build(config *MonitorTarget, action string) (*http.Request, error) {
+	data := newWebhookTemplateData(config, action)
+	render := func(name, text string) (string, error) {
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	url, err := render("url", r.URL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := render("body", r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range r.Headers {
+		rendered, err := render("header", value)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(key, rendered)
+	}
+	return req, nil
+}
+
+// do はリクエストを送信し、期待するステータスコードであれば応答本文を返します。
+func (r *WebhookRequest) do(config *MonitorTarget, action string) ([]byte, error) {
+	req, err := r.build(config, action)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("webhook request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook response: %v", err)
+	}
+
+	ok := resp.StatusCode >= 200 && resp.StatusCode <= 299
+	if r.ExpectStatus != 0 {
+		ok = resp.StatusCode == r.ExpectStatus
+	}
+	if !ok {
+		return nil, fmt.Errorf("webhook returned status code: %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// extract は、応答本文から path または regex で状態の値を取り出します。
+func (s *WebhookStatus) extract(body []byte) (string, error) {
+	if s.Regex != "" {
+		m := regexp.MustCompile(s.Regex).FindSubmatch(body)
+		if m == nil {
+			return "", fmt.Errorf("regex did not match response")
+		}
+		if len(m) > 1 {
+			return string(m[1]), nil
+		}
+		return string(m[0]), nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", fmt.Errorf("response is not JSON: %v", err)
+	}
+	for _, key := range strings.Split(s.Path, ".") {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return "", fmt.Errorf("key '%s' not found in response", key)
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return "", fmt.Errorf("index '%s' out of range in response", key)
+			}
+			doc = node[i]
+		default:
+			return "", fmt.Errorf("cannot descend into '%s'", key)
+		}
+	}
+	return fmt.Sprint(doc), nil
+}
+
+// matches は、値が expected（未指定の場合は defaults のいずれか）と大文字小文字を区別せずに一致するかを返します。
+func (s *WebhookStatus) matches(value string, expected string, defaults ...string) bool {
+	if expected != "" {
+		return strings.EqualFold(value, expected)
+	}
+	for _, d := range defaults {
+		if strings.EqualFold(value, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhookドライバ END===========================================================END
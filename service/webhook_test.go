@@ -0,0 +1,171 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPlug は、電源操作のリクエストを記録し、/status で statusBody を返すテスト用のスマートプラグです。
+type testPlug struct {
+	requests requestLog // "POST /relay?turn=on X-Target=plug01 body" の形式
+
+	mu         sync.Mutex
+	statusBody string
+}
+
+func (p *testPlug) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/status" {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		io.WriteString(w, p.statusBody)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	p.requests.add(strings.TrimSpace(r.Method + " " + r.URL.RequestURI() + " X-Target=" + r.Header.Get("X-Target") + " " + string(body)))
+}
+
+// newTestPlug は、テスト用のスマートプラグと、それを webhook ドライバで操作するターゲットの設定を返します。
+func newTestPlug(t *testing.T) (*testPlug, *MonitorTarget) {
+	t.Helper()
+	plug := &testPlug{}
+	base := "http://" + startTestServer(t, plug, false)
+	return plug, &MonitorTarget{
+		Name: "plug01", Type: "host", HostIP: "172.16.0.13", Port: "80", MacAddress: "01:23:34:56:78:9a", PowerDriver: "webhook",
+		SSHPass: "ssh-secret", BMCPass: "bmc-secret",
+		Webhook: WebhookConfig{
+			On:     &WebhookRequest{Method: "post", URL: base + "/relay?turn=on&host={{.HostIP}}", Headers: map[string]string{"X-Target": "{{.Name}}"}},
+			Off:    &WebhookRequest{Method: "POST", URL: base + "/relay?turn=off", Body: `{"action":"{{.Action}}","mac":"{{.MacAddress}}"}`},
+			Status: &WebhookStatus{WebhookRequest: WebhookRequest{URL: base + "/status"}, Path: "POWER"},
+		},
+	}
+}
+
+func TestWebhookTemplates(t *testing.T) {
+	plug, config := newTestPlug(t)
+	if err := (&webhookDriver{}).Validate(config); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	checkPowerCalls(t, &webhookDriver{}, config, plug.requests.all, []powerCall{
+		{name: "start", call: callStart, want: "POST /relay?turn=on&host=172.16.0.13 X-Target=plug01"},
+		{name: "stop", call: callStop, want: `POST /relay?turn=off X-Target= {"action":"off","mac":"01:23:34:56:78:9a"}`},
+	})
+
+	// テンプレートに渡すのはターゲットの設定の一部のみで、秘密情報は埋め込めない
+	for _, text := range []string{"{{.SSHPass}}", "{{.BMCPass}}", "{{.Webhook}}", "{{.Nope}}"} {
+		bad := *config
+		bad.Webhook.On = &WebhookRequest{URL: "http://127.0.0.1/?x=" + text}
+		if err := (&webhookDriver{}).Validate(&bad); err == nil {
+			t.Errorf("template %s was accepted", text)
+		}
+	}
+}
+
+func TestWebhookCycleDelay(t *testing.T) {
+	plug, config := newTestPlug(t)
+	for _, c := range []struct {
+		delay   int
+		wantErr bool
+	}{
+		{-1, true},
+		{0, false},
+		{maxCycleDelay, false},
+		{maxCycleDelay + 1, true},
+	} {
+		config.Webhook.CycleDelay = c.delay
+		if err := (&webhookDriver{}).Validate(config); (err != nil) != c.wantErr {
+			t.Errorf("cycle_delay %d: err = %v, want error %t", c.delay, err, c.wantErr)
+		}
+	}
+
+	// reboot を省略した場合は off を送って応答し、cycle_delay 秒後に on を送る
+	config.Webhook.CycleDelay = 1
+	message, err := (&webhookDriver{}).Reboot(config, PowerOptions{})
+	if err != nil {
+		t.Fatalf("Reboot: %v", err)
+	}
+	if message != "Power cycle started via webhook (off sent, on in 1s)" {
+		t.Errorf("message = %q", message)
+	}
+	if got := plug.requests.all(); len(got) != 1 || !strings.HasPrefix(got[0], "POST /relay?turn=off") {
+		t.Fatalf("requests right after reboot = %q, want only off", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(plug.requests.all()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := plug.requests.all(); len(got) != 2 || !strings.HasPrefix(got[1], "POST /relay?turn=on") {
+		t.Errorf("requests = %q, want off then on", got)
+	}
+}
+
+func TestWebhookStatusExtraction(t *testing.T) {
+	plug, config := newTestPlug(t)
+	for _, c := range []struct {
+		body, path, regex, onValue string
+		want                       string
+	}{
+		{`{"POWER":"ON"}`, "POWER", "", "", StatusRunning},
+		{`{"POWER":"OFF"}`, "POWER", "", "", StatusUnreachable},
+		{`{"relays":[{"ison":true}]}`, "relays.0.ison", "", "", StatusRunning},
+		{`{"relays":[{"ison":false}]}`, "relays.0.ison", "", "", StatusUnreachable},
+		{`{"relays":[]}`, "relays.0.ison", "", "", StatusUnknown},
+		{`{"state":"active"}`, "state", "", "active", StatusRunning},
+		{`{"state":"on"}`, "state", "", "active", StatusUnknown}, // on_value を指定した場合は既定値と比較しない
+		{`not json`, "POWER", "", "", StatusUnknown},
+		{`<power>1</power>`, "", `<power>(\d)</power>`, "", StatusRunning},
+		{`<power>0</power>`, "", `<power>(\d)</power>`, "", StatusUnreachable},
+		{`<power>?</power>`, "", `<power>(\d)</power>`, "", StatusUnknown},
+		{`relay is off`, "", `off`, "", StatusUnreachable},
+	} {
+		plug.mu.Lock()
+		plug.statusBody = c.body
+		plug.mu.Unlock()
+		config.Webhook.Status.Path, config.Webhook.Status.Regex, config.Webhook.Status.OnValue = c.path, c.regex, c.onValue
+		if got := (&webhookDriver{}).Status(config); got != c.want {
+			t.Errorf("body %s (path %q, regex %q): status = %s, want %s", c.body, c.path, c.regex, got, c.want)
+		}
+	}
+
+	config.Webhook.Status.ExpectStatus = http.StatusNoContent
+	if got := (&webhookDriver{}).Status(config); got != StatusUnknown {
+		t.Errorf("status with unexpected status code = %s, want %s", got, StatusUnknown)
+	}
+}
+
+func TestWebhookHeaderSecrets(t *testing.T) {
+	newTestDB(t)
+	_, config := newTestPlug(t)
+	config.Webhook.On.Headers["Authorization"] = "Bearer abc"
+	saveTestTarget(t, config)
+
+	// 一覧などで返す設定では headers の値を伏せ字にする
+	stored, err := GetTargetConfig(config.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redacted := stored.Redacted()
+	if got := redacted.Webhook.On.Headers["Authorization"]; got != maskedHeaderValue {
+		t.Errorf("redacted Authorization = %q, want %q", got, maskedHeaderValue)
+	}
+	if stored.Webhook.On.Headers["Authorization"] != "Bearer abc" {
+		t.Fatal("Redacted modified the original headers")
+	}
+
+	// 伏せ字のまま保存し直しても元の値を引き継ぎ、変更した値は保存する
+	redacted.Webhook.On.Headers["X-Target"] = "plug-renamed"
+	if err := SaveMonitorTarget(&redacted); err != nil {
+		t.Fatalf("SaveMonitorTarget: %v", err)
+	}
+	stored, err = GetTargetConfig(config.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stored.Webhook.On.Headers; got["Authorization"] != "Bearer abc" || got["X-Target"] != "plug-renamed" {
+		t.Errorf("headers after saving the redacted config = %v", got)
+	}
+}
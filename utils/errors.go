@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"net/http"
+)
+
+// エラーコード。クライアントがメッセージの文言に依存せずにエラーを判定できるよう、応答の error.code に設定します。
+const (
+	CodeBadRequest       = "bad_request"            // リクエストの形式が不正 (JSON の構文エラー、必須パラメータの不足など)
+	CodeUnauthorized     = "unauthorized"           // API トークンが未指定または不正
+	CodeForbidden        = "forbidden"              // 管理者のトークンが必要な操作
+	CodeNotFound         = "not_found"              // パスが存在しない
+	CodeTargetNotFound   = "target_not_found"       // ターゲットが存在しない
+	CodeMethodNotAllowed = "method_not_allowed"     // パスは存在するがメソッドが対応していない
+	CodeConflict         = "conflict"               // 現在の状態と矛盾する (同じ電源操作が進行中など)
+	CodeValidationFailed = "validation_failed"      // 設定の検証に失敗した、または対応していない操作
+	CodePowerFailed      = "power_operation_failed" // 電源操作の実行に失敗した
+	CodeUnavailable      = "service_unavailable"    // DB などが一時的に利用できない
+	CodeInternal         = "internal_error"         // その他のサーバ内部のエラー
+)
+
+// ErrorDetail は、エラー応答の機械可読な詳細です。
+type ErrorDetail struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// WriteError は、共通のエラー形式で応答し、リクエスト ID 付きでログに出力します。
+// resp の Status が空の場合は "error" とし、resp.Message を error.message にも設定します。
+// resp.Error.Details を設定した場合は、その内容を error.details として返します。
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code string, resp JSONResponse) {
+	if resp.Status == "" {
+		resp.Status = "error"
+	}
+	id := RequestID(r.Context())
+	detail := &ErrorDetail{Code: code, Message: resp.Message, RequestID: id}
+	if resp.Error != nil {
+		// 呼び出し元が設定した詳細 (検証エラーの項目の一覧など) は引き継ぐ
+		detail.Details = resp.Error.Details
+	}
+	resp.Error = detail
+	log.Printf("[ERROR] [%s] %s %s -> %d %s: %s", id, r.Method, r.URL.Path, status, code, resp.Message)
+	WriteJSON(w, status, resp)
+}
+
+// requestIDKey は、リクエスト ID を context に保存するキーです。
+type requestIDKey struct{}
+
+// WithRequestID は、リクエスト ID を保存した context を返します。
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID は、context に保存されたリクエスト ID を返します。ない場合は空文字を返します。
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
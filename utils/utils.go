@@ -13,6 +13,7 @@ type JSONResponse struct {
 	Target string `json:"target,omitempty"`
 	Message string `json:"message"`
 	ScriptOutput string `json:"script_output,omitempty"`
+	Error *ErrorDetail `json:"error,omitempty"` // エラー応答のみ (WriteError で設定)
 }
 
 // WriteJSON は、HTTPレスポンスライターにJSONデータを書き込むヘルパー関数です。
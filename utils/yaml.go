@@ -0,0 +1,21 @@
+package utils
+
+import "gopkg.in/yaml.v3"
+
+// JSONToYAML は、JSON を項目の順序を保ったまま YAML に変換します。
+func JSONToYAML(raw []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(raw, &node); err != nil {
+		return nil, err
+	}
+	// JSON はフロー形式として読み込まれるため、ブロック形式で出力されるようスタイルを消去する
+	var clearStyle func(n *yaml.Node)
+	clearStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for _, c := range n.Content {
+			clearStyle(c)
+		}
+	}
+	clearStyle(&node)
+	return yaml.Marshal(&node)
+}
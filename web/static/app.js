@@ -0,0 +1,314 @@
+// srv_mng ダッシュボード
+// /status・/status/metrics・/status/history を読み込み、/events (SSE) で状態変化を受け取って再描画します。
+"use strict";
+
+const API = "/api/v1";
+const POLL_INTERVAL_MS = 15000;
+const HISTORY_LIMIT = 50;
+const SPARK_WIDTH = 100;
+const SPARK_HEIGHT = 22;
+
+const state = {
+  statuses: [],
+  metrics: {},
+  history: [],
+  filter: "",
+};
+
+// ---------------------------------------------------------------- API
+
+// SRVMNG_API_TOKEN が設定されたマネージャではトークンを入力してもらい、ブラウザに保存する
+const TOKEN_KEY = "srvmng_api_token";
+
+function authHeaders(headers) {
+  const token = localStorage.getItem(TOKEN_KEY);
+  return token ? { ...headers, Authorization: `Bearer ${token}` } : headers;
+}
+
+async function apiFetch(path, options) {
+  const opts = options || {};
+  let resp = await fetch(path, { ...opts, headers: authHeaders(opts.headers || {}) });
+  if (resp.status === 401) {
+    const token = prompt("APIトークンを入力してください");
+    if (token) {
+      localStorage.setItem(TOKEN_KEY, token);
+      resp = await fetch(path, { ...opts, headers: authHeaders(opts.headers || {}) });
+    }
+  }
+  return resp;
+}
+
+async function getJSON(path) {
+  const resp = await apiFetch(path, { headers: { Accept: "application/json" } });
+  if (!resp.ok) {
+    throw new Error(`${path}: ${resp.status} ${resp.statusText}`);
+  }
+  return resp.json();
+}
+
+async function loadStatuses() {
+  state.statuses = (await getJSON(`${API}/status`)) || [];
+  renderTargets();
+}
+
+async function loadMetrics() {
+  state.metrics = (await getJSON(`${API}/status/metrics`)) || {};
+  renderTargets();
+}
+
+async function loadHistory() {
+  state.history = (await getJSON(`${API}/status/history?limit=${HISTORY_LIMIT}`)) || [];
+  renderHistory();
+}
+
+async function powerAction(action, target) {
+  if (!confirm(`${target} に ${action} を実行しますか?`)) {
+    return;
+  }
+  try {
+    const resp = await apiFetch(`${API}/power/${action}`, {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ target }),
+    });
+    const body = await resp.json().catch(() => ({}));
+    if (!resp.ok) {
+      toast(`${target}: ${action} に失敗しました (${body.message || resp.status})`, true);
+    }
+  } catch (err) {
+    toast(`${target}: ${action} に失敗しました (${err.message})`, true);
+  }
+}
+
+// ---------------------------------------------------------------- 描画
+
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs || {})) {
+    if (key === "class") {
+      node.className = value;
+    } else if (key.startsWith("on")) {
+      node.addEventListener(key.slice(2), value);
+    } else if (value !== undefined && value !== null && value !== false) {
+      node.setAttribute(key, value);
+    }
+  }
+  for (const child of children.flat()) {
+    if (child === null || child === undefined) continue;
+    node.append(child instanceof Node ? child : document.createTextNode(String(child)));
+  }
+  return node;
+}
+
+function formatTime(value) {
+  if (!value) return "";
+  const d = new Date(value);
+  return d.toLocaleString();
+}
+
+function sparkline(samples, pick, max) {
+  const svgNS = "http://www.w3.org/2000/svg";
+  const svg = document.createElementNS(svgNS, "svg");
+  svg.setAttribute("class", "spark");
+  svg.setAttribute("width", SPARK_WIDTH);
+  svg.setAttribute("height", SPARK_HEIGHT);
+  if (!samples || samples.length === 0) {
+    return svg;
+  }
+
+  const values = samples.map(pick);
+  const top = max || Math.max(1, ...values.filter((v) => v !== null));
+  const step = samples.length > 1 ? SPARK_WIDTH / (samples.length - 1) : 0;
+
+  // 停止中のサンプルは背景を赤く塗る
+  samples.forEach((s, i) => {
+    if (!s.up) {
+      const rect = document.createElementNS(svgNS, "rect");
+      rect.setAttribute("class", "down");
+      rect.setAttribute("x", Math.max(0, i * step - step / 2));
+      rect.setAttribute("y", 0);
+      rect.setAttribute("width", Math.max(step, 2));
+      rect.setAttribute("height", SPARK_HEIGHT);
+      svg.append(rect);
+    }
+  });
+
+  const points = [];
+  values.forEach((v, i) => {
+    if (v === null) return;
+    const y = SPARK_HEIGHT - 1 - (Math.min(v, top) / top) * (SPARK_HEIGHT - 2);
+    points.push(`${(i * step).toFixed(1)},${y.toFixed(1)}`);
+  });
+  const line = document.createElementNS(svgNS, "polyline");
+  line.setAttribute("points", points.join(" "));
+  svg.append(line);
+  return svg;
+}
+
+function lastValue(samples, pick, suffix) {
+  for (let i = (samples || []).length - 1; i >= 0; i--) {
+    const v = pick(samples[i]);
+    if (v !== null) {
+      return el("span", { class: "spark-value" }, `${Math.round(v)}${suffix}`);
+    }
+  }
+  return null;
+}
+
+function matchesFilter(s) {
+  if (!state.filter) return true;
+  const text = `${s.name} ${s.type} ${s.status} ${s.host_port} ${(s.tags || []).join(" ")}`.toLowerCase();
+  return text.includes(state.filter);
+}
+
+function renderSummary() {
+  const counts = {};
+  for (const s of state.statuses) {
+    counts[s.status] = (counts[s.status] || 0) + 1;
+  }
+  const summary = document.getElementById("summary");
+  summary.replaceChildren(
+    el("span", {}, `全 ${state.statuses.length} 台`),
+    ...Object.entries(counts).map(([status, n]) => el("span", {}, el("span", { class: `badge s-${status}` }, status), ` ${n}`)),
+  );
+}
+
+function renderTargets() {
+  renderSummary();
+  const tbody = document.querySelector("#targets tbody");
+  const rows = state.statuses.filter(matchesFilter).map((s) => {
+    const samples = state.metrics[s.name] || [];
+    const latency = (m) => m.latency_ms;
+    const cpu = (m) => (m.cpu_usage === undefined ? null : m.cpu_usage);
+    const busy = s.status === "PoweringOn" || s.status === "ShuttingDown";
+    return el(
+      "tr",
+      {},
+      el("td", {}, el("span", { class: `badge s-${s.status}` }, s.status), s.flapping ? el("span", { class: "flap" }, "FLAPPING") : null),
+      el("td", {}, s.name),
+      el("td", {}, s.type),
+      el("td", {}, s.host_port),
+      el("td", { class: "muted" }, formatTime(s.since)),
+      el("td", {}, sparkline(samples, latency), lastValue(samples, latency, "ms")),
+      el("td", {}, sparkline(samples, cpu, 100), lastValue(samples, cpu, "%")),
+      el(
+        "td",
+        { class: "checks" },
+        (s.checks || []).map((c) => el("span", { class: c.ok ? "check-ok" : "check-fail", title: c.message }, `${c.ok ? "✔" : "✘"} ${c.name}`)),
+      ),
+      el(
+        "td",
+        {},
+        el("button", { onclick: () => powerAction("start", s.name), disabled: busy }, "起動"),
+        el("button", { class: "danger", onclick: () => powerAction("stop", s.name), disabled: busy }, "停止"),
+      ),
+    );
+  });
+  tbody.replaceChildren(...rows);
+  document.getElementById("empty").hidden = state.statuses.length > 0;
+}
+
+function renderHistory() {
+  const list = document.getElementById("history");
+  list.replaceChildren(
+    ...state.history.map((h) =>
+      el(
+        "li",
+        {},
+        el("time", {}, formatTime(h.at)),
+        `${h.target}: `,
+        el("span", { class: `badge s-${h.from}` }, h.from),
+        " → ",
+        el("span", { class: `badge s-${h.to}` }, h.to),
+        h.flapping ? el("span", { class: "flap" }, "FLAPPING") : null,
+      ),
+    ),
+  );
+}
+
+function showAlert(alert) {
+  const box = el(
+    "div",
+    { class: `alert alert-${alert.level}` },
+    el("span", {}, `[${alert.level}] ${alert.target}: ${alert.message} (${formatTime(alert.at)})`),
+    el("button", { onclick: () => box.remove(), title: "閉じる" }, "×"),
+  );
+  document.getElementById("alerts").prepend(box);
+}
+
+function toast(message, failed) {
+  const node = el("div", { class: failed ? "toast toast-failed" : "toast" }, message);
+  document.getElementById("toasts").append(node);
+  setTimeout(() => node.remove(), 6000);
+}
+
+// ---------------------------------------------------------------- イベント
+
+function connectEvents() {
+  // EventSource は切断時に Last-Event-ID を付けて自動で再接続する
+  // EventSource はヘッダーを付けられないため、トークンはクエリで渡す
+  const token = localStorage.getItem(TOKEN_KEY);
+  const source = new EventSource(token ? `${API}/events?access_token=${encodeURIComponent(token)}` : `${API}/events`);
+  const conn = document.getElementById("connection");
+
+  source.onopen = () => {
+    conn.textContent = "接続中";
+    conn.className = "conn conn-up";
+  };
+  source.onerror = () => {
+    conn.textContent = "再接続中";
+    conn.className = "conn conn-down";
+  };
+
+  source.addEventListener("snapshot", (e) => {
+    state.statuses = JSON.parse(e.data) || [];
+    renderTargets();
+    loadHistory().catch(console.error);
+  });
+
+  source.addEventListener("status", (e) => {
+    const t = JSON.parse(e.data);
+    const target = state.statuses.find((s) => s.name === t.target);
+    if (target) {
+      target.status = t.to;
+      target.flapping = t.flapping;
+      target.since = t.at;
+      renderTargets();
+    } else {
+      loadStatuses().catch(console.error);
+    }
+    state.history.unshift(t);
+    state.history.length = Math.min(state.history.length, HISTORY_LIMIT);
+    renderHistory();
+  });
+
+  source.addEventListener("power", (e) => {
+    const p = JSON.parse(e.data);
+    if (p.phase === "started") return;
+    const message = p.message ? ` (${p.message})` : "";
+    toast(`${p.target}: ${p.action} ${p.phase}${message}`, p.phase === "failed");
+  });
+
+  source.addEventListener("alert", (e) => {
+    showAlert(JSON.parse(e.data));
+  });
+}
+
+// ---------------------------------------------------------------- 初期化
+
+document.getElementById("filter").addEventListener("input", (e) => {
+  state.filter = e.target.value.trim().toLowerCase();
+  renderTargets();
+});
+
+// 最初の読み込みでトークンの入力を済ませてからイベントの購読を始める
+loadStatuses()
+  .then(() => Promise.all([loadMetrics(), loadHistory()]))
+  .catch((err) => toast(err.message, true))
+  .finally(connectEvents);
+
+// ヘルスチェックの詳細とメトリクスはイベントで配信されないため、監視結果を定期的に取得する
+setInterval(() => {
+  loadStatuses().catch(console.error);
+  loadMetrics().catch(console.error);
+}, POLL_INTERVAL_MS);
@@ -0,0 +1,23 @@
+// Package web は、マネージャが配信する組み込みの Web ダッシュボードです。
+// 静的ファイルは go:embed でバイナリに含めるため、外部の CDN やファイル配置は不要です。
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler は、ダッシュボードの静的ファイルを配信するハンドラを返します。
+// /dashboard/ などのプレフィックスを除いたパスで呼び出してください。
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		// static は埋め込み済みのため、ここに到達することはない
+		panic(err)
+	}
+	return http.FileServerFS(files)
+}